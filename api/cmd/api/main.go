@@ -12,8 +12,17 @@ import (
 	"clothes-shop/api/internal/auth"
 	"clothes-shop/api/internal/config"
 	"clothes-shop/api/internal/db"
+	"clothes-shop/api/internal/gst"
 	"clothes-shop/api/internal/httpapi"
+	"clothes-shop/api/internal/invoice"
+	"clothes-shop/api/internal/jobs"
 	"clothes-shop/api/internal/migrate"
+	"clothes-shop/api/internal/notify"
+	"clothes-shop/api/internal/payments"
+	"clothes-shop/api/internal/razorpay"
+	"clothes-shop/api/internal/shipping"
+	"clothes-shop/api/internal/sms"
+	"clothes-shop/api/internal/storage"
 	"clothes-shop/api/internal/store"
 )
 
@@ -47,8 +56,34 @@ func main() {
 	}
 
 	st := store.New(pool)
-	authSvc := auth.NewService(cfg.JWTSecret, cfg.JWTAccessTTL)
-	srv := httpapi.New(cfg, st, authSvc)
+	authSvc := auth.NewService(cfg.JWTSecret, cfg.JWTAccessTTL, cfg.CustomerTokenTTL)
+	media, err := storage.NewLocal(cfg.MediaDir, cfg.MediaBaseURL)
+	if err != nil {
+		log.Fatalf("media storage error: %v", err)
+	}
+	enabled := []payments.Provider{payments.NewRazorpay(st, cfg.RazorpayKeyID, cfg.RazorpayKeySecret)}
+	if cfg.CODEnabled {
+		enabled = append(enabled, payments.NewCashOnDelivery(st))
+	}
+	providers := payments.NewRegistry(enabled...)
+	links := auth.NewLinkSigner(cfg.JWTSecret)
+	var invoices *invoice.Issuer
+	if cfg.SellerGSTIN != "" {
+		sellerState, _ := gst.LookupState(cfg.SellerState)
+		seller := invoice.Seller{Name: cfg.SellerName, GSTIN: cfg.SellerGSTIN, Address: cfg.SellerAddress, State: sellerState}
+		invoices = invoice.NewIssuer(st, seller, links, cfg.PublicAPIURL, cfg.InvoiceLinkTTL)
+	}
+	var courier shipping.Provider
+	if cfg.ShiprocketEmail != "" {
+		courier = shipping.NewShiprocket(cfg.ShiprocketAPIURL, cfg.ShiprocketEmail, cfg.ShiprocketPassword, cfg.ShiprocketPickupLocation)
+	}
+	var texts sms.Sender = sms.Console{}
+	srv := httpapi.New(cfg, st, authSvc, media, providers, links, invoices, courier, texts)
+
+	var notifier notify.Notifier = notify.Log{}
+	if cfg.Notifier == "file" {
+		notifier = notify.NewFile(cfg.NotifyFile)
+	}
 
 	httpServer := &http.Server{
 		Addr:         cfg.Addr,
@@ -58,6 +93,29 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	var rzc *razorpay.Client
+	if cfg.RazorpayKeyID != "" && cfg.RazorpayKeySecret != "" {
+		rzc = razorpay.NewClient(cfg.RazorpayKeyID, cfg.RazorpayKeySecret)
+	}
+	if cfg.ReservationTTL > 0 && cfg.ReservationSweepInterval > 0 {
+		go jobs.RunReservationExpiry(ctx, st, rzc, cfg.ReservationTTL, max(cfg.AuthorizedPaymentTTL, cfg.ReservationTTL), cfg.ReservationSweepInterval)
+	}
+	if cfg.WebhookPollInterval > 0 {
+		go jobs.RunWebhookWorker(ctx, st, providers, cfg.WebhookPollInterval, max(cfg.WebhookMaxAttempts, 1))
+	}
+	if cfg.IdempotencyKeyTTL > 0 {
+		go jobs.RunIdempotencyKeyPurge(ctx, st, cfg.IdempotencyKeyTTL, time.Hour)
+	}
+	if cfg.CartAbandonAfter > 0 && cfg.CartRecoveryInterval > 0 {
+		go jobs.RunCartRecovery(ctx, st, notifier, links, cfg.StorefrontURL, cfg.CartAbandonAfter, cfg.CartRecoveryLinkTTL, cfg.CartRecoveryInterval)
+	}
+	if invoices != nil && cfg.InvoiceInterval > 0 {
+		go jobs.RunInvoicing(ctx, st, invoices, notifier, cfg.InvoiceInterval)
+	}
+	if cfg.PaymentReconcileInterval > 0 && rzc != nil {
+		go jobs.RunPaymentReconciliation(ctx, st, rzc, cfg.PaymentReconcileStaleAfter, cfg.PaymentReconcileInterval)
+	}
+
 	go func() {
 		log.Printf("api listening on %s", cfg.Addr)
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"clothes-shop/api/internal/shipping"
+)
+
+func main() {
+	addr := flag.String("addr", envOr("SHIPSTUB_ADDR", ":8090"), "listen address")
+	webhookURL := flag.String("webhook-url", os.Getenv("SHIPSTUB_WEBHOOK_URL"), "tracking webhook URL, e.g. http://localhost:8081/v1/webhooks/courier")
+	webhookToken := flag.String("webhook-token", os.Getenv("SHIPSTUB_WEBHOOK_TOKEN"), "token sent in the x-api-key header of webhooks")
+	flag.Parse()
+
+	stub := shipping.NewStub(*webhookURL, *webhookToken)
+	log.Printf("shipping stub listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, stub.Handler()); err != nil {
+		log.Fatalf("listen error: %v", err)
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
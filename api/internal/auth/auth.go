@@ -14,7 +14,8 @@ import (
 type Role string
 
 const (
-	RoleAdmin Role = "admin"
+	RoleAdmin    Role = "admin"
+	RoleCustomer Role = "customer"
 )
 
 type Claims struct {
@@ -39,22 +40,33 @@ func PrincipalFrom(ctx context.Context) (Principal, bool) {
 }
 
 type Service struct {
-	secret []byte
-	ttl    time.Duration
+	secret      []byte
+	ttl         time.Duration
+	customerTTL time.Duration
 }
 
-func NewService(secret string, accessTTL time.Duration) *Service {
-	return &Service{secret: []byte(secret), ttl: accessTTL}
+// NewService returns a token service; admin tokens last accessTTL and
+// customer tokens customerTTL.
+func NewService(secret string, accessTTL, customerTTL time.Duration) *Service {
+	return &Service{secret: []byte(secret), ttl: accessTTL, customerTTL: customerTTL}
 }
 
 func (s *Service) IssueAdminToken(userID uuid.UUID) (string, error) {
+	return s.issue(userID, RoleAdmin, s.ttl)
+}
+
+func (s *Service) IssueCustomerToken(userID uuid.UUID) (string, error) {
+	return s.issue(userID, RoleCustomer, s.customerTTL)
+}
+
+func (s *Service) issue(userID uuid.UUID, role Role, ttl time.Duration) (string, error) {
 	now := time.Now()
 	claims := Claims{
-		Role: string(RoleAdmin),
+		Role: string(role),
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   userID.String(),
 			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 		},
 	}
 	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -81,12 +93,11 @@ func (s *Service) Parse(token string) (Principal, error) {
 
 func (s *Service) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		h := r.Header.Get("Authorization")
-		if h == "" || !strings.HasPrefix(strings.ToLower(h), "bearer ") {
+		token, ok := bearerToken(r)
+		if !ok {
 			http.Error(w, "missing bearer token", http.StatusUnauthorized)
 			return
 		}
-		token := strings.TrimSpace(h[len("Bearer "):])
 		p, err := s.Parse(token)
 		if err != nil {
 			http.Error(w, "invalid token", http.StatusUnauthorized)
@@ -96,6 +107,27 @@ func (s *Service) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// Optional is Middleware for routes that also serve guests: requests with a
+// valid bearer token carry its principal, others pass through without one.
+func (s *Service) Optional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			if p, err := s.Parse(token); err == nil {
+				r = r.WithContext(WithPrincipal(r.Context(), p))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if h == "" || !strings.HasPrefix(strings.ToLower(h), "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[len("Bearer "):]), true
+}
+
 func RequireRole(role Role) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// NewOTP returns a random six-digit one-time code.
+func NewOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// HashOTP returns the form a one-time code for phone is stored in. Codes are
+// short, so they are keyed with the service secret rather than hashed plainly.
+func (s *Service) HashOTP(phone, code string) string {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte("otp|" + phone + "|" + code))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// NormalizePhone returns an Indian mobile number as +91 and its 10 digits,
+// accepting spaces, dashes and a +91, 91 or 0 prefix. ok is false for
+// anything else.
+func NormalizePhone(phone string) (string, bool) {
+	var d []byte
+	for i := 0; i < len(phone); i++ {
+		switch c := phone[i]; {
+		case c >= '0' && c <= '9':
+			d = append(d, c)
+		case c == ' ' || c == '-' || c == '(' || c == ')' || (c == '+' && i == 0):
+		default:
+			return "", false
+		}
+	}
+	digits := string(d)
+	switch {
+	case len(digits) == 12 && strings.HasPrefix(digits, "91"):
+		digits = digits[2:]
+	case len(digits) == 11 && digits[0] == '0':
+		digits = digits[1:]
+	}
+	if len(digits) != 10 || digits[0] < '6' {
+		return "", false
+	}
+	return "+91" + digits, true
+}
+
@@ -4,7 +4,10 @@ import (
 	"errors"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"clothes-shop/api/internal/gst"
 )
 
 type Config struct {
@@ -15,15 +18,60 @@ type Config struct {
 
 	JWTSecret        string
 	JWTAccessTTL     time.Duration
+	CustomerTokenTTL time.Duration
 	DevAllowAllCORS  bool
 	AllowedCORSOrigin string
 
 	ShippingFlatINR int
-	TaxRateBps      int // basis points, e.g. 1800 = 18%
+	TaxRateBps      int    // GST for products without a gst_rates match, in basis points, e.g. 1800 = 18%
+	SellerState     string // code of the state the seller is registered for GST in, e.g. "KA"
+
+	SellerName      string
+	SellerGSTIN     string // invoices are only issued when set
+	SellerAddress   string // printed on invoices; a literal \n separates lines
+	PublicAPIURL    string // public API base URL, used in invoice links sent to customers
+	InvoiceInterval time.Duration
+	InvoiceLinkTTL  time.Duration
+
+	ReservationTTL           time.Duration // 0 disables expiry of pending_payment orders
+	AuthorizedPaymentTTL     time.Duration // expiry of pending_payment orders whose payment is authorized
+	ReservationSweepInterval time.Duration
 
 	RazorpayKeyID        string
 	RazorpayKeySecret    string
 	RazorpayWebhookSecret string
+
+	CODEnabled bool // offer cash on delivery at checkout
+
+	ShiprocketEmail          string // courier bookings are only enabled when set
+	ShiprocketPassword       string
+	ShiprocketAPIURL         string // the shipping stub's URL in development
+	ShiprocketPickupLocation string // nickname of the pickup address in Shiprocket
+	ShiprocketWebhookToken   string // x-api-key of tracking webhooks; they are rejected when empty
+
+	ReturnWindow time.Duration // how long after delivery customers can open a return; 0 for no limit
+
+	OTPTTL    time.Duration // how long a customer login code is valid
+	SMSSender string        // "console" (dev) is the only sender so far
+
+	WebhookPollInterval time.Duration
+	WebhookMaxAttempts  int
+
+	PaymentReconcileInterval   time.Duration // 0 disables reconciliation against Razorpay
+	PaymentReconcileStaleAfter time.Duration
+
+	IdempotencyKeyTTL time.Duration // how long Idempotency-Key responses are replayed; 0 ignores the header
+
+	CartAbandonAfter     time.Duration // idle time before an open cart is abandoned; 0 disables recovery
+	CartRecoveryInterval time.Duration
+	CartRecoveryLinkTTL  time.Duration
+	StorefrontURL        string // public storefront base URL, used in links sent to customers
+
+	Notifier   string // "log" or "file"
+	NotifyFile string // output of the file notifier
+
+	MediaDir     string // local directory for uploaded images
+	MediaBaseURL string // public URL prefix the stored images are served from
 }
 
 func Load() (Config, error) {
@@ -35,23 +83,90 @@ func Load() (Config, error) {
 
 	c.JWTSecret = os.Getenv("JWT_SECRET")
 	c.JWTAccessTTL = envDuration("JWT_ACCESS_TTL", 24*time.Hour)
+	c.CustomerTokenTTL = envDuration("CUSTOMER_TOKEN_TTL", 30*24*time.Hour)
 
 	c.DevAllowAllCORS = envBool("DEV_ALLOW_ALL_CORS", true)
 	c.AllowedCORSOrigin = envOr("ALLOWED_CORS_ORIGIN", "")
 
 	c.ShippingFlatINR = envInt("SHIPPING_FLAT_INR", 0)
 	c.TaxRateBps = envInt("TAX_RATE_BPS", 0)
+	c.SellerState = os.Getenv("SELLER_STATE")
+
+	c.SellerName = os.Getenv("SELLER_NAME")
+	c.SellerGSTIN = strings.ToUpper(strings.TrimSpace(os.Getenv("SELLER_GSTIN")))
+	c.SellerAddress = strings.ReplaceAll(os.Getenv("SELLER_ADDRESS"), `\n`, "\n")
+	c.PublicAPIURL = envOr("PUBLIC_API_URL", "http://localhost:8081")
+	c.InvoiceInterval = envDuration("INVOICE_INTERVAL", time.Minute)
+	c.InvoiceLinkTTL = envDuration("INVOICE_LINK_TTL", 90*24*time.Hour)
+
+	c.ReservationTTL = envDuration("RESERVATION_TTL", 30*time.Minute)
+	c.AuthorizedPaymentTTL = envDuration("AUTHORIZED_PAYMENT_TTL", 24*time.Hour)
+	c.ReservationSweepInterval = envDuration("RESERVATION_SWEEP_INTERVAL", time.Minute)
 
 	c.RazorpayKeyID = os.Getenv("RAZORPAY_KEY_ID")
 	c.RazorpayKeySecret = os.Getenv("RAZORPAY_KEY_SECRET")
 	c.RazorpayWebhookSecret = os.Getenv("RAZORPAY_WEBHOOK_SECRET")
 
+	c.CODEnabled = envBool("COD_ENABLED", false)
+
+	c.ShiprocketEmail = os.Getenv("SHIPROCKET_EMAIL")
+	c.ShiprocketPassword = os.Getenv("SHIPROCKET_PASSWORD")
+	c.ShiprocketAPIURL = envOr("SHIPROCKET_API_URL", "https://apiv2.shiprocket.in")
+	c.ShiprocketPickupLocation = envOr("SHIPROCKET_PICKUP_LOCATION", "Primary")
+	c.ShiprocketWebhookToken = os.Getenv("SHIPROCKET_WEBHOOK_TOKEN")
+
+	c.ReturnWindow = envDuration("RETURN_WINDOW", 14*24*time.Hour)
+
+	c.OTPTTL = envDuration("OTP_TTL", 5*time.Minute)
+	c.SMSSender = envOr("SMS_SENDER", "console")
+
+	c.WebhookPollInterval = envDuration("WEBHOOK_POLL_INTERVAL", 2*time.Second)
+	c.WebhookMaxAttempts = envInt("WEBHOOK_MAX_ATTEMPTS", 8)
+
+	c.PaymentReconcileInterval = envDuration("PAYMENT_RECONCILE_INTERVAL", 5*time.Minute)
+	c.PaymentReconcileStaleAfter = envDuration("PAYMENT_RECONCILE_STALE_AFTER", 10*time.Minute)
+
+	c.IdempotencyKeyTTL = envDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+
+	c.CartAbandonAfter = envDuration("CART_ABANDON_AFTER", 24*time.Hour)
+	c.CartRecoveryInterval = envDuration("CART_RECOVERY_INTERVAL", 10*time.Minute)
+	c.CartRecoveryLinkTTL = envDuration("CART_RECOVERY_LINK_TTL", 7*24*time.Hour)
+	c.StorefrontURL = envOr("STOREFRONT_URL", "http://localhost:3001")
+
+	c.Notifier = envOr("NOTIFIER", "log")
+	c.NotifyFile = envOr("NOTIFY_FILE", "notifications.jsonl")
+
+	c.MediaDir = envOr("MEDIA_DIR", "media")
+	c.MediaBaseURL = envOr("MEDIA_BASE_URL", "http://localhost:8081/media")
+
 	if c.DatabaseURL == "" {
 		return Config{}, errors.New("DATABASE_URL is required")
 	}
 	if c.JWTSecret == "" {
 		return Config{}, errors.New("JWT_SECRET is required")
 	}
+	seller, ok := gst.LookupState(c.SellerState)
+	if !ok {
+		return Config{}, errors.New("SELLER_STATE must be an Indian state or union territory")
+	}
+	c.SellerState = seller.Code
+	if c.SellerGSTIN != "" {
+		if !gst.ValidGSTIN(c.SellerGSTIN) || c.SellerGSTIN[:2] != seller.GSTCode {
+			return Config{}, errors.New("SELLER_GSTIN must be a valid GSTIN registered in SELLER_STATE")
+		}
+		if c.SellerName == "" || c.SellerAddress == "" {
+			return Config{}, errors.New("SELLER_NAME and SELLER_ADDRESS are required with SELLER_GSTIN")
+		}
+	}
+	if c.ShiprocketEmail != "" && c.ShiprocketPassword == "" {
+		return Config{}, errors.New("SHIPROCKET_PASSWORD is required with SHIPROCKET_EMAIL")
+	}
+	if c.SMSSender != "console" {
+		return Config{}, errors.New("SMS_SENDER must be console")
+	}
+	if c.Notifier != "log" && c.Notifier != "file" {
+		return Config{}, errors.New("NOTIFIER must be log or file")
+	}
 	return c, nil
 }
 
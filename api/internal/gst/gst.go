@@ -0,0 +1,110 @@
+package gst
+
+import "strings"
+
+// Rate is the GST slab for products whose HSN code starts with HSNPrefix:
+// RateBps applies while the value per unit is at most ThresholdINR (paise),
+// AboveRateBps above it. Without a threshold RateBps always applies.
+type Rate struct {
+	HSNPrefix    string
+	ThresholdINR int // 0 = no threshold
+	RateBps      int
+	AboveRateBps int
+}
+
+// RateFor returns the rate in basis points for a unit value in paise.
+func (r Rate) RateFor(unitValueINR int) int {
+	if r.ThresholdINR > 0 && unitValueINR > r.ThresholdINR {
+		return r.AboveRateBps
+	}
+	return r.RateBps
+}
+
+type Rates []Rate
+
+// Lookup returns the rate with the longest HSN prefix matching hsn.
+func (rs Rates) Lookup(hsn string) (Rate, bool) {
+	var best Rate
+	found := false
+	for _, r := range rs {
+		if strings.HasPrefix(hsn, r.HSNPrefix) && (!found || len(r.HSNPrefix) > len(best.HSNPrefix)) {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
+
+// ValidHSN reports whether code is a 4, 6 or 8 digit HSN code.
+func ValidHSN(code string) bool {
+	switch len(code) {
+	case 4, 6, 8:
+	default:
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidGSTIN reports whether gstin is a well-formed GSTIN with a correct check
+// character: state code, PAN, entity number, "Z" and the check character.
+func ValidGSTIN(gstin string) bool {
+	const chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	if len(gstin) != 15 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 14; i++ {
+		v := strings.IndexByte(chars, gstin[i])
+		if v < 0 {
+			return false
+		}
+		p := v * (1 + i%2)
+		sum += p/36 + p%36
+	}
+	return gstin[14] == chars[(36-sum%36)%36]
+}
+
+// Tax is the GST on one taxable amount. Intra-state supplies split the tax
+// evenly into CGST and SGST (UTGST in union territories without a
+// legislature); inter-state supplies pay IGST.
+type Tax struct {
+	TaxableINR int
+	RateBps    int
+	CGSTINR    int
+	SGSTINR    int
+	IGSTINR    int
+}
+
+func (t Tax) Total() int {
+	return t.CGSTINR + t.SGSTINR + t.IGSTINR
+}
+
+// Compute returns the tax on taxableINR at rateBps, rounding each component
+// to the nearest paisa.
+func Compute(taxableINR, rateBps int, interState bool) Tax {
+	t := Tax{TaxableINR: taxableINR, RateBps: rateBps}
+	if interState {
+		t.IGSTINR = roundBps(taxableINR, rateBps)
+		return t
+	}
+	// Each half is rounded on its own, as on the invoice.
+	half := (taxableINR*rateBps + 10000) / 20000
+	t.CGSTINR = half
+	t.SGSTINR = half
+	return t
+}
+
+// InterState reports whether a supply from the seller's state to the place of
+// supply is inter-state.
+func InterState(sellerState, placeOfSupply string) bool {
+	return sellerState != placeOfSupply
+}
+
+func roundBps(amount, bps int) int {
+	return (amount*bps + 5000) / 10000
+}
+
@@ -0,0 +1,109 @@
+package gst
+
+import "strings"
+
+// State is an Indian state or union territory as used for GST: the place of
+// supply decides between CGST+SGST and IGST.
+type State struct {
+	Code    string `json:"code"` // two-letter code, e.g. "KA"
+	Name    string `json:"name"`
+	GSTCode string `json:"gst_code"` // first two digits of a GSTIN, e.g. "29"
+	// UTGST is set for union territories without a legislature, where UTGST
+	// is charged instead of SGST.
+	UTGST bool `json:"utgst"`
+}
+
+// States lists the 28 states and 8 union territories, by name.
+var States = []State{
+	{Code: "AN", Name: "Andaman and Nicobar Islands", GSTCode: "35", UTGST: true},
+	{Code: "AP", Name: "Andhra Pradesh", GSTCode: "37"},
+	{Code: "AR", Name: "Arunachal Pradesh", GSTCode: "12"},
+	{Code: "AS", Name: "Assam", GSTCode: "18"},
+	{Code: "BR", Name: "Bihar", GSTCode: "10"},
+	{Code: "CH", Name: "Chandigarh", GSTCode: "04", UTGST: true},
+	{Code: "CG", Name: "Chhattisgarh", GSTCode: "22"},
+	{Code: "DH", Name: "Dadra and Nagar Haveli and Daman and Diu", GSTCode: "26", UTGST: true},
+	{Code: "DL", Name: "Delhi", GSTCode: "07"},
+	{Code: "GA", Name: "Goa", GSTCode: "30"},
+	{Code: "GJ", Name: "Gujarat", GSTCode: "24"},
+	{Code: "HR", Name: "Haryana", GSTCode: "06"},
+	{Code: "HP", Name: "Himachal Pradesh", GSTCode: "02"},
+	{Code: "JK", Name: "Jammu and Kashmir", GSTCode: "01"},
+	{Code: "JH", Name: "Jharkhand", GSTCode: "20"},
+	{Code: "KA", Name: "Karnataka", GSTCode: "29"},
+	{Code: "KL", Name: "Kerala", GSTCode: "32"},
+	{Code: "LA", Name: "Ladakh", GSTCode: "38", UTGST: true},
+	{Code: "LD", Name: "Lakshadweep", GSTCode: "31", UTGST: true},
+	{Code: "MP", Name: "Madhya Pradesh", GSTCode: "23"},
+	{Code: "MH", Name: "Maharashtra", GSTCode: "27"},
+	{Code: "MN", Name: "Manipur", GSTCode: "14"},
+	{Code: "ML", Name: "Meghalaya", GSTCode: "17"},
+	{Code: "MZ", Name: "Mizoram", GSTCode: "15"},
+	{Code: "NL", Name: "Nagaland", GSTCode: "13"},
+	{Code: "OD", Name: "Odisha", GSTCode: "21"},
+	{Code: "PY", Name: "Puducherry", GSTCode: "34"},
+	{Code: "PB", Name: "Punjab", GSTCode: "03"},
+	{Code: "RJ", Name: "Rajasthan", GSTCode: "08"},
+	{Code: "SK", Name: "Sikkim", GSTCode: "11"},
+	{Code: "TN", Name: "Tamil Nadu", GSTCode: "33"},
+	{Code: "TS", Name: "Telangana", GSTCode: "36"},
+	{Code: "TR", Name: "Tripura", GSTCode: "16"},
+	{Code: "UP", Name: "Uttar Pradesh", GSTCode: "09"},
+	{Code: "UK", Name: "Uttarakhand", GSTCode: "05"},
+	{Code: "WB", Name: "West Bengal", GSTCode: "19"},
+}
+
+// stateAliases maps older codes and common spellings to state codes.
+var stateAliases = map[string]string{
+	"or":                              "OD",
+	"orissa":                          "OD",
+	"tg":                              "TS",
+	"ua":                              "UK",
+	"uttaranchal":                     "UK",
+	"pondicherry":                     "PY",
+	"newdelhi":                        "DL",
+	"nctofdelhi":                      "DL",
+	"nationalcapitalterritoryofdelhi": "DL",
+	"damananddiu":                     "DH",
+	"dadraandnagarhaveli":             "DH",
+	"dd":                              "DH",
+	"dn":                              "DH",
+	"andamanandnicobar":               "AN",
+	"jandk":                           "JK",
+}
+
+var stateIndex = func() map[string]State {
+	byCode := map[string]State{}
+	for _, s := range States {
+		byCode[s.Code] = s
+	}
+	idx := map[string]State{}
+	for _, s := range States {
+		idx[stateKey(s.Code)] = s
+		idx[stateKey(s.Name)] = s
+		idx[s.GSTCode] = s
+	}
+	for alias, code := range stateAliases {
+		idx[alias] = byCode[code]
+	}
+	return idx
+}()
+
+// LookupState finds a state by code, name, GST code or a common alias,
+// ignoring case, spacing and punctuation ("&" reads as "and").
+func LookupState(s string) (State, bool) {
+	st, ok := stateIndex[stateKey(s)]
+	return st, ok
+}
+
+func stateKey(s string) string {
+	s = strings.ReplaceAll(strings.ToLower(s), "&", "and")
+	var b strings.Builder
+	for _, r := range s {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
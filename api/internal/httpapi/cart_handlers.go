@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/store"
+)
+
+type cartContactRequest struct {
+	Name  string `json:"customer_name"`
+	Phone string `json:"customer_phone"`
+	Email string `json:"customer_email"`
+}
+
+// handleSetCartContact stores the contact details typed into the checkout
+// form, so the cart can be recovered if the customer leaves before paying.
+func (s *Server) handleSetCartContact(w http.ResponseWriter, r *http.Request) {
+	cid, err := uuid.Parse(chi.URLParam(r, "cartID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid cart_id")
+		return
+	}
+	var req cartContactRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	c := store.CartContact{
+		Name:  strings.TrimSpace(req.Name),
+		Phone: strings.TrimSpace(req.Phone),
+		Email: strings.TrimSpace(req.Email),
+	}
+	if c.Phone == "" && c.Email == "" {
+		writeError(w, http.StatusBadRequest, "customer_phone or customer_email is required")
+		return
+	}
+	if err := s.store.SetCartContact(r.Context(), cid, c); err != nil {
+		if !writeCartError(w, err) {
+			writeError(w, http.StatusInternalServerError, "failed to save contact")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+type recoverCartRequest struct {
+	Token string `json:"token"`
+}
+
+// handleRecoverCart reopens the cart named by a recovery link token and
+// returns it.
+func (s *Server) handleRecoverCart(w http.ResponseWriter, r *http.Request) {
+	var req recoverCartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	subject, err := s.links.Verify(auth.LinkCartRecovery, req.Token)
+	if err != nil {
+		if errors.Is(err, auth.ErrExpiredLinkToken) {
+			writeError(w, http.StatusGone, "recovery link expired")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "invalid recovery link")
+		return
+	}
+	cid, err := uuid.Parse(subject)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid recovery link")
+		return
+	}
+	if err := s.store.RecoverCart(r.Context(), cid); err != nil {
+		if errors.Is(err, store.ErrCartNotOpen) {
+			writeError(w, http.StatusConflict, "cart was already checked out")
+			return
+		}
+		if !writeCartError(w, err) {
+			writeError(w, http.StatusInternalServerError, "failed to recover cart")
+		}
+		return
+	}
+	cart, err := s.store.GetCart(r.Context(), cid)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load cart")
+		return
+	}
+	writeJSON(w, http.StatusOK, cart)
+}
+
@@ -0,0 +1,101 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/store"
+)
+
+func (s *Server) handleListCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := s.store.ListCategories(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list categories")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"categories": categories})
+}
+
+type adminCategoryRequest struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+func (s *Server) handleAdminCreateCategory(w http.ResponseWriter, r *http.Request) {
+	var req adminCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if req.Name == "" || req.Slug == "" {
+		writeError(w, http.StatusBadRequest, "name and slug required")
+		return
+	}
+	c, err := s.store.AdminCreateCategory(r.Context(), req.Name, req.Slug)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func (s *Server) handleAdminUpdateCategory(w http.ResponseWriter, r *http.Request) {
+	cid, err := uuid.Parse(chi.URLParam(r, "categoryID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid category_id")
+		return
+	}
+	var req adminCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if req.Name == "" || req.Slug == "" {
+		writeError(w, http.StatusBadRequest, "name and slug required")
+		return
+	}
+	if err := s.store.AdminUpdateCategory(r.Context(), cid, req.Name, req.Slug); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "category not found")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+func (s *Server) handleAdminDeleteCategory(w http.ResponseWriter, r *http.Request) {
+	cid, err := uuid.Parse(chi.URLParam(r, "categoryID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid category_id")
+		return
+	}
+	if err := s.store.AdminDeleteCategory(r.Context(), cid); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "category not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to delete category")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+// parseUUIDs parses a list of ids from a request body, e.g. category_ids.
+func parseUUIDs(raw []string) ([]uuid.UUID, error) {
+	out := make([]uuid.UUID, 0, len(raw))
+	for _, v := range raw {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
@@ -0,0 +1,328 @@
+package httpapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/shipping"
+	"clothes-shop/api/internal/store"
+)
+
+type adminBookShipmentRequest struct {
+	Note string `json:"note"`
+	// Items to ship; omitted ships everything not shipped yet.
+	Items []struct {
+		VariantID uuid.UUID `json:"variant_id"`
+		Quantity  int       `json:"quantity"`
+	} `json:"items"`
+}
+
+// handleAdminBookShipment books a shipment of some or all of an order's items
+// with the courier aggregator, stores its label and records it like a manual
+// shipment.
+func (s *Server) handleAdminBookShipment(w http.ResponseWriter, r *http.Request) {
+	if s.courier == nil {
+		writeError(w, http.StatusServiceUnavailable, "courier bookings are not configured")
+		return
+	}
+	oid, err := uuid.Parse(chi.URLParam(r, "orderID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order_id")
+		return
+	}
+	var req adminBookShipmentRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+	}
+	var items []store.ShipmentItem
+	for _, it := range req.Items {
+		items = append(items, store.ShipmentItem{VariantID: it.VariantID, Quantity: it.Quantity})
+	}
+
+	order, err := s.store.AdminGetOrder(r.Context(), oid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "order not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to load order")
+		return
+	}
+	lines, err := s.store.PlanShipment(r.Context(), oid, items)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(w, http.StatusNotFound, "order not found")
+		case errors.Is(err, store.ErrNotShippable):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, store.ErrInvalidShipment):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to plan shipment")
+		}
+		return
+	}
+	shipmentID := uuid.New()
+	booking, err := shipping.RequestFromOrder(shipmentID, order, lines)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	b, err := s.courier.CreateShipment(r.Context(), booking)
+	if err != nil {
+		log.Printf("book shipment for order %s: %v", oid, err)
+		writeError(w, http.StatusBadGateway, "courier booking failed")
+		return
+	}
+	// The label can be fetched again later; a booking without one is still
+	// worth keeping.
+	label, err := s.courier.Label(r.Context(), b)
+	if err != nil {
+		log.Printf("label of shipment %s: %v", shipmentID, err)
+		label = nil
+	}
+
+	in := store.ShipmentInput{
+		ID:                 shipmentID,
+		Carrier:            b.Carrier,
+		TrackingNumber:     b.TrackingNumber,
+		Note:               strings.TrimSpace(req.Note),
+		ShippedAt:          time.Now(),
+		Provider:           s.courier.Name(),
+		ProviderOrderID:    b.ProviderOrderID,
+		ProviderShipmentID: b.ProviderShipmentID,
+		LabelPDF:           label,
+		TrackingStatus:     store.TrackingBooked,
+	}
+	for _, l := range lines {
+		in.Items = append(in.Items, store.ShipmentItem{VariantID: l.VariantID, Quantity: l.Quantity})
+	}
+	p, _ := auth.PrincipalFrom(r.Context())
+	sh, err := s.store.AdminCreateShipment(r.Context(), oid, in, store.AdminActor(p.UserID))
+	if err != nil {
+		// Don't leave a booking behind that the shop knows nothing about.
+		if cerr := s.courier.Cancel(r.Context(), b); cerr != nil {
+			log.Printf("cancel orphaned booking %s (AWB %s): %v", b.ProviderOrderID, b.TrackingNumber, cerr)
+		}
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(w, http.StatusNotFound, "order not found")
+		case errors.Is(err, store.ErrNotShippable), errors.Is(err, store.ErrTrackingNumberTaken):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, store.ErrInvalidShipment):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to create shipment")
+		}
+		return
+	}
+	writeJSON(w, http.StatusCreated, sh)
+}
+
+// handleAdminGetShipmentLabel serves a courier shipment's label, fetching and
+// storing it first if the booking did not.
+func (s *Server) handleAdminGetShipmentLabel(w http.ResponseWriter, r *http.Request) {
+	sid, err := uuid.Parse(chi.URLParam(r, "shipmentID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid shipment_id")
+		return
+	}
+	label, err := s.store.ShipmentLabel(r.Context(), sid)
+	if errors.Is(err, store.ErrNotFound) {
+		label, err = s.fetchShipmentLabel(r, sid)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(w, http.StatusNotFound, "label not found")
+		case errors.Is(err, errCourierFailed):
+			writeError(w, http.StatusBadGateway, "failed to fetch label from the courier")
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to load label")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="label-`+sid.String()+`.pdf"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(label)
+}
+
+var errCourierFailed = errors.New("courier request failed")
+
+func (s *Server) fetchShipmentLabel(r *http.Request, shipmentID uuid.UUID) ([]byte, error) {
+	sh, err := s.store.GetShipment(r.Context(), shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	if s.courier == nil || sh.Provider != s.courier.Name() || sh.Status == store.ShipmentCancelled {
+		return nil, store.ErrNotFound
+	}
+	label, err := s.courier.Label(r.Context(), shipping.BookingOf(sh))
+	if err != nil {
+		log.Printf("label of shipment %s: %v", shipmentID, err)
+		return nil, errCourierFailed
+	}
+	if err := s.store.SetShipmentLabel(r.Context(), shipmentID, label); err != nil {
+		return nil, err
+	}
+	return label, nil
+}
+
+// handleAdminTrackShipment asks the courier for a shipment's latest tracking
+// status, for when a webhook went missing.
+func (s *Server) handleAdminTrackShipment(w http.ResponseWriter, r *http.Request) {
+	sid, err := uuid.Parse(chi.URLParam(r, "shipmentID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid shipment_id")
+		return
+	}
+	sh, err := s.store.GetShipment(r.Context(), sid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "shipment not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to load shipment")
+		return
+	}
+	if sh.Provider == "" {
+		writeError(w, http.StatusConflict, "shipment was not booked with a courier")
+		return
+	}
+	if s.courier == nil || sh.Provider != s.courier.Name() {
+		writeError(w, http.StatusServiceUnavailable, "courier bookings are not configured")
+		return
+	}
+
+	t, err := s.courier.Track(r.Context(), sh.TrackingNumber)
+	if err != nil {
+		if errors.Is(err, shipping.ErrNotFound) {
+			writeError(w, http.StatusConflict, "courier has no tracking for this shipment yet")
+			return
+		}
+		log.Printf("track shipment %s: %v", sid, err)
+		writeError(w, http.StatusBadGateway, "failed to fetch tracking from the courier")
+		return
+	}
+	p, _ := auth.PrincipalFrom(r.Context())
+	sh, err = s.store.UpdateShipmentTracking(r.Context(), sh.Provider, sh.TrackingNumber, t, store.AdminActor(p.UserID))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update shipment")
+		return
+	}
+	writeJSON(w, http.StatusOK, sh)
+}
+
+type adminCancelShipmentRequest struct {
+	Reason string `json:"reason"`
+}
+
+// handleAdminCancelShipment cancels a shipment that has not been delivered,
+// with the courier first if it was booked with one.
+func (s *Server) handleAdminCancelShipment(w http.ResponseWriter, r *http.Request) {
+	sid, err := uuid.Parse(chi.URLParam(r, "shipmentID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid shipment_id")
+		return
+	}
+	var req adminCancelShipmentRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+	}
+
+	sh, err := s.store.GetShipment(r.Context(), sid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "shipment not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to load shipment")
+		return
+	}
+	// A shipment being returned or lost can no longer be cancelled with the
+	// courier; it is only closed here.
+	stuck := sh.TrackingStatus == store.TrackingReturned || sh.TrackingStatus == store.TrackingException
+	if sh.Provider != "" && sh.Status == store.ShipmentShipped && !stuck {
+		if s.courier == nil || sh.Provider != s.courier.Name() {
+			writeError(w, http.StatusServiceUnavailable, "courier bookings are not configured")
+			return
+		}
+		if err := s.courier.Cancel(r.Context(), shipping.BookingOf(sh)); err != nil {
+			log.Printf("cancel shipment %s: %v", sid, err)
+			writeError(w, http.StatusBadGateway, "courier refused to cancel the shipment")
+			return
+		}
+	}
+
+	p, _ := auth.PrincipalFrom(r.Context())
+	sh, err = s.store.AdminCancelShipment(r.Context(), sid, store.AdminActor(p.UserID), strings.TrimSpace(req.Reason))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(w, http.StatusNotFound, "shipment not found")
+		case errors.Is(err, store.ErrInvalidShipment):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to cancel shipment")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, sh)
+}
+
+// handleCourierWebhook applies a courier's tracking update. Shiprocket sends
+// the token configured in its panel in the x-api-key header and retries
+// anything but a 200, so updates for unknown AWBs are acknowledged.
+func (s *Server) handleCourierWebhook(w http.ResponseWriter, r *http.Request) {
+	if s.courier == nil || s.cfg.ShiprocketWebhookToken == "" {
+		writeError(w, http.StatusBadRequest, "webhook not configured")
+		return
+	}
+	key := r.Header.Get("x-api-key")
+	if subtle.ConstantTimeCompare([]byte(key), []byte(s.cfg.ShiprocketWebhookToken)) != 1 {
+		writeError(w, http.StatusUnauthorized, "invalid api key")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	awb, t, err := shipping.ParseShiprocketWebhook(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook payload")
+		return
+	}
+
+	_, err = s.store.UpdateShipmentTracking(r.Context(), s.courier.Name(), awb, t, store.Actor{Source: store.ActorSourceCourier})
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeJSON(w, http.StatusOK, map[string]any{"ok": true, "ignored": true})
+			return
+		}
+		log.Printf("courier webhook for AWB %s: %v", awb, err)
+		writeError(w, http.StatusInternalServerError, "failed to update shipment")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
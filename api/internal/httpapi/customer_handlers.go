@@ -0,0 +1,201 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/store"
+)
+
+type requestOTPRequest struct {
+	Phone string `json:"phone"`
+}
+
+// handleRequestOTP texts a login code to a customer's phone. The same code
+// signs up a phone that has no account yet.
+func (s *Server) handleRequestOTP(w http.ResponseWriter, r *http.Request) {
+	var req requestOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	phone, ok := auth.NormalizePhone(req.Phone)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "phone must be an Indian mobile number")
+		return
+	}
+	code, err := auth.NewOTP()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create login code")
+		return
+	}
+	if err := s.store.CreatePhoneOTP(r.Context(), phone, s.auth.HashOTP(phone, code), s.cfg.OTPTTL); err != nil {
+		if errors.Is(err, store.ErrOTPRateLimited) {
+			writeError(w, http.StatusTooManyRequests, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to create login code")
+		return
+	}
+	text := fmt.Sprintf("%s is your login code. It is valid for %d minutes; do not share it.", code, int(s.cfg.OTPTTL.Minutes()))
+	if err := s.sms.Send(r.Context(), phone, text); err != nil {
+		writeError(w, http.StatusBadGateway, "failed to send login code")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]any{"phone": phone, "expires_in": int(s.cfg.OTPTTL.Seconds())})
+}
+
+type verifyOTPRequest struct {
+	Phone string `json:"phone"`
+	Code  string `json:"code"`
+	Name  string `json:"name"` // used when the login signs the customer up
+}
+
+// handleVerifyOTP logs a customer in with a login code, signing them up on
+// their first login, and links their guest orders to the account.
+func (s *Server) handleVerifyOTP(w http.ResponseWriter, r *http.Request) {
+	var req verifyOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	phone, ok := auth.NormalizePhone(req.Phone)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "phone must be an Indian mobile number")
+		return
+	}
+	code := strings.TrimSpace(req.Code)
+	if code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+	c, linked, err := s.store.LoginCustomerWithOTP(r.Context(), phone, s.auth.HashOTP(phone, code), strings.TrimSpace(req.Name))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidOTP):
+			writeError(w, http.StatusUnauthorized, err.Error())
+		case errors.Is(err, store.ErrAccountDisabled):
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to log in")
+		}
+		return
+	}
+	token, err := s.auth.IssueCustomerToken(c.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to issue token")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"token": token, "role": "customer", "customer": c, "linked_orders": linked})
+}
+
+func (s *Server) handleGetMe(w http.ResponseWriter, r *http.Request) {
+	p, _ := auth.PrincipalFrom(r.Context())
+	c, err := s.store.GetCustomer(r.Context(), p.UserID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "customer not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get customer")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// handleListMyOrders lists the logged-in customer's orders, including guest
+// orders placed with their verified phone.
+func (s *Server) handleListMyOrders(w http.ResponseWriter, r *http.Request) {
+	p, _ := auth.PrincipalFrom(r.Context())
+	orders, err := s.store.ListCustomerOrders(r.Context(), p.UserID, 50)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list orders")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"orders": orders})
+}
+
+func (s *Server) handleListMyAddresses(w http.ResponseWriter, r *http.Request) {
+	p, _ := auth.PrincipalFrom(r.Context())
+	addrs, err := s.store.ListCustomerAddresses(r.Context(), p.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list addresses")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"addresses": addrs})
+}
+
+type myAddressRequest struct {
+	Label string `json:"label"`
+	store.Address
+}
+
+func (s *Server) handleCreateMyAddress(w http.ResponseWriter, r *http.Request) {
+	var req myAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	p, _ := auth.PrincipalFrom(r.Context())
+	a, err := s.store.CreateCustomerAddress(r.Context(), p.UserID, req.Label, req.Address)
+	if err != nil {
+		writeAddressError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, a)
+}
+
+func (s *Server) handleUpdateMyAddress(w http.ResponseWriter, r *http.Request) {
+	aid, err := uuid.Parse(chi.URLParam(r, "addressID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid address_id")
+		return
+	}
+	var req myAddressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	p, _ := auth.PrincipalFrom(r.Context())
+	a, err := s.store.UpdateCustomerAddress(r.Context(), p.UserID, aid, req.Label, req.Address)
+	if err != nil {
+		writeAddressError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a)
+}
+
+func (s *Server) handleDeleteMyAddress(w http.ResponseWriter, r *http.Request) {
+	aid, err := uuid.Parse(chi.URLParam(r, "addressID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid address_id")
+		return
+	}
+	p, _ := auth.PrincipalFrom(r.Context())
+	if err := s.store.DeleteCustomerAddress(r.Context(), p.UserID, aid); err != nil {
+		writeAddressError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+func writeAddressError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "address not found")
+	case errors.Is(err, store.ErrInvalidAddress):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, store.ErrAddressBookFull):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "failed to save address")
+	}
+}
+
@@ -0,0 +1,148 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/store"
+)
+
+func (s *Server) handleAdminListDiscounts(w http.ResponseWriter, r *http.Request) {
+	discounts, err := s.store.AdminListDiscounts(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list discounts")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"discounts": discounts})
+}
+
+type adminDiscountRequest struct {
+	// Code is omitted for an automatic promotion.
+	Code           string     `json:"code"`
+	Name           string     `json:"name"`
+	Kind           string     `json:"kind"`
+	Value          int        `json:"value"`
+	MaxDiscountINR *int       `json:"max_discount_inr"`
+	MinOrderINR    int        `json:"min_order_inr"`
+	UsageLimit     *int       `json:"usage_limit"`
+	PerPhoneLimit  *int       `json:"per_phone_limit"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+	Active         *bool      `json:"active"`
+	ProductIDs     []string   `json:"product_ids"`
+	CategoryIDs    []string   `json:"category_ids"`
+}
+
+// discountInput validates an admin discount request, returning a message for
+// the client when it is invalid.
+func (req adminDiscountRequest) discountInput() (store.DiscountInput, string) {
+	in := store.DiscountInput{
+		Code:           strings.ToUpper(strings.TrimSpace(req.Code)),
+		Name:           strings.TrimSpace(req.Name),
+		Kind:           req.Kind,
+		Value:          req.Value,
+		MaxDiscountINR: req.MaxDiscountINR,
+		MinOrderINR:    req.MinOrderINR,
+		UsageLimit:     req.UsageLimit,
+		PerPhoneLimit:  req.PerPhoneLimit,
+		StartsAt:       req.StartsAt,
+		EndsAt:         req.EndsAt,
+		Active:         req.Active == nil || *req.Active,
+	}
+	if in.Name == "" {
+		return in, "name is required"
+	}
+	switch in.Kind {
+	case store.DiscountPercent:
+		if in.Value < 1 || in.Value > 100 {
+			return in, "value must be a percentage between 1 and 100"
+		}
+	case store.DiscountFixed:
+		if in.Value <= 0 {
+			return in, "value must be positive"
+		}
+	default:
+		return in, "kind must be percent or fixed"
+	}
+	if in.MaxDiscountINR != nil && *in.MaxDiscountINR <= 0 {
+		return in, "max_discount_inr must be positive"
+	}
+	if in.MinOrderINR < 0 {
+		return in, "min_order_inr cannot be negative"
+	}
+	if (in.UsageLimit != nil && *in.UsageLimit <= 0) || (in.PerPhoneLimit != nil && *in.PerPhoneLimit <= 0) {
+		return in, "usage limits must be positive"
+	}
+	if in.StartsAt != nil && in.EndsAt != nil && !in.StartsAt.Before(*in.EndsAt) {
+		return in, "starts_at must be before ends_at"
+	}
+	var err error
+	if in.ProductIDs, err = parseUUIDs(req.ProductIDs); err != nil {
+		return in, "invalid product_ids"
+	}
+	if in.CategoryIDs, err = parseUUIDs(req.CategoryIDs); err != nil {
+		return in, "invalid category_ids"
+	}
+	return in, ""
+}
+
+func (s *Server) handleAdminCreateDiscount(w http.ResponseWriter, r *http.Request) {
+	var req adminDiscountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	in, msg := req.discountInput()
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	id, err := s.store.AdminCreateDiscount(r.Context(), in)
+	if err != nil {
+		if errors.Is(err, store.ErrDiscountCodeTaken) {
+			writeError(w, http.StatusConflict, "discount code already exists")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"id": id})
+}
+
+func (s *Server) handleAdminUpdateDiscount(w http.ResponseWriter, r *http.Request) {
+	did, err := uuid.Parse(chi.URLParam(r, "discountID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid discount_id")
+		return
+	}
+	var req adminDiscountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	in, msg := req.discountInput()
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if err := s.store.AdminUpdateDiscount(r.Context(), did, in); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "discount not found")
+			return
+		}
+		if errors.Is(err, store.ErrDiscountCodeTaken) {
+			writeError(w, http.StatusConflict, "discount code already exists")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
@@ -3,23 +3,95 @@ package httpapi
 import (
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
 	"clothes-shop/api/internal/auth"
-	"clothes-shop/api/internal/razorpay"
+	"clothes-shop/api/internal/gst"
+	"clothes-shop/api/internal/payments"
 	"clothes-shop/api/internal/store"
 )
 
 func (s *Server) handleListProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := s.store.ListProductsWithVariants(r.Context(), true)
+	q, err := parseCatalogQuery(r.URL.Query())
 	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := s.store.ListCatalog(r.Context(), q)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to list products")
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"products": products})
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseCatalogQuery reads catalog filters from the query string. size and color
+// may be repeated or comma-separated; prices are in paise.
+func parseCatalogQuery(v url.Values) (store.CatalogQuery, error) {
+	q := store.CatalogQuery{
+		CategorySlug: v.Get("category"),
+		Sizes:        splitQueryList(v["size"]),
+		Colors:       splitQueryList(v["color"]),
+		Sort:         v.Get("sort"),
+		Cursor:       v.Get("cursor"),
+	}
+	switch q.Sort {
+	case "", store.CatalogSortNewest, store.CatalogSortPriceAsc, store.CatalogSortPriceDesc:
+	default:
+		return store.CatalogQuery{}, errors.New("invalid sort")
+	}
+	for _, f := range []struct {
+		name string
+		dst  **int
+	}{{"min_price", &q.MinPriceINR}, {"max_price", &q.MaxPriceINR}} {
+		raw := v.Get(f.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return store.CatalogQuery{}, errors.New("invalid " + f.name)
+		}
+		*f.dst = &n
+	}
+	if raw := v.Get("in_stock"); raw != "" {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return store.CatalogQuery{}, errors.New("invalid in_stock")
+		}
+		q.InStockOnly = b
+	}
+	if raw := v.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 100 {
+			return store.CatalogQuery{}, errors.New("invalid limit")
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+func splitQueryList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
 }
 
 func (s *Server) handleGetProduct(w http.ResponseWriter, r *http.Request) {
@@ -36,6 +108,33 @@ func (s *Server) handleGetProduct(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, p)
 }
 
+func (s *Server) handleSearchProducts(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "q required")
+		return
+	}
+	if len(q) > 200 {
+		writeError(w, http.StatusBadRequest, "q too long")
+		return
+	}
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 || n > 50 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	res, err := s.store.SearchProducts(r.Context(), q, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to search products")
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
 func (s *Server) handleCreateCart(w http.ResponseWriter, r *http.Request) {
 	id, err := s.store.CreateCart(r.Context())
 	if err != nil {
@@ -88,11 +187,15 @@ func (s *Server) handleUpsertCartItem(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid variant_id")
 		return
 	}
-	if err := s.store.UpsertCartItem(r.Context(), cid, vid, req.Quantity); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to update cart item")
+	qty, err := s.store.UpsertCartItem(r.Context(), cid, vid, req.Quantity)
+	if err != nil {
+		if !writeCartError(w, err) {
+			writeError(w, http.StatusInternalServerError, "failed to update cart item")
+		}
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	// quantity is lower than requested when stock ran short.
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "quantity": qty})
 }
 
 func (s *Server) handleDeleteCartItem(w http.ResponseWriter, r *http.Request) {
@@ -107,18 +210,44 @@ func (s *Server) handleDeleteCartItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.store.DeleteCartItem(r.Context(), cid, vid); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to delete cart item")
+		if !writeCartError(w, err) {
+			writeError(w, http.StatusInternalServerError, "failed to delete cart item")
+		}
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 }
 
+// writeCartError responds to the cart errors shared by cart changes and
+// checkout, and reports whether err was one of them.
+func writeCartError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "cart or variant not found")
+	case errors.Is(err, store.ErrCartNotOpen):
+		writeError(w, http.StatusConflict, "cart is not open")
+	case errors.Is(err, store.ErrProductUnavailable):
+		writeError(w, http.StatusConflict, "product is not available")
+	case errors.Is(err, store.ErrInsufficientStock):
+		writeError(w, http.StatusConflict, "insufficient stock")
+	default:
+		return false
+	}
+	return true
+}
+
 type checkoutRequest struct {
 	CartID string         `json:"cart_id"`
 	Name   string         `json:"customer_name"`
 	Phone  string         `json:"customer_phone"`
 	Email  string         `json:"customer_email"`
-	Addr   map[string]any `json:"shipping_address"`
+	Addr   *store.Address `json:"shipping_address"`
+	// AddressID picks a saved address of the logged-in customer instead of
+	// shipping_address.
+	AddressID *uuid.UUID `json:"address_id"`
+	// Provider is "razorpay" (default) or "cod".
+	Provider     string `json:"payment_provider"`
+	DiscountCode string `json:"discount_code"`
 }
 
 func (s *Server) handleCheckoutFromCart(w http.ResponseWriter, r *http.Request) {
@@ -136,57 +265,97 @@ func (s *Server) handleCheckoutFromCart(w http.ResponseWriter, r *http.Request)
 		writeError(w, http.StatusBadRequest, "customer_name and customer_phone are required")
 		return
 	}
-	res, err := s.store.CheckoutFromCart(
-		r.Context(),
-		cid,
-		store.CheckoutCustomer{Name: req.Name, Phone: req.Phone, Email: req.Email, Address: req.Addr},
-		s.cfg.ShippingFlatINR,
-		s.cfg.TaxRateBps,
-	)
-	if err != nil {
-		if errors.Is(err, store.ErrInsufficientStock) {
-			writeError(w, http.StatusConflict, "insufficient stock")
-			return
-		}
-		writeError(w, http.StatusBadRequest, err.Error())
+	if req.Provider == "" {
+		req.Provider = "razorpay"
+	}
+	provider, ok := s.payments[req.Provider]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "unsupported payment_provider")
 		return
 	}
-	var rz *struct {
-		KeyID    string `json:"key_id"`
-		OrderID  string `json:"order_id"`
-		AmountINR int   `json:"amount_inr"`
-		Currency string `json:"currency"`
+	customer := store.CheckoutCustomer{Name: req.Name, Phone: req.Phone, Email: req.Email}
+	if p, ok := auth.PrincipalFrom(r.Context()); ok && p.Role == auth.RoleCustomer {
+		customer.UserID = &p.UserID
 	}
-	if s.cfg.RazorpayKeyID != "" && s.cfg.RazorpayKeySecret != "" {
-		rzc := razorpay.NewClient(s.cfg.RazorpayKeyID, s.cfg.RazorpayKeySecret)
-		rzOrderID, err := rzc.CreateOrder(r.Context(), res.AmountINR, res.Currency, res.OrderID.String())
+	// Keep the contact on the cart first, so a checkout that fails (e.g. on
+	// stock) can still be followed up if the customer gives up.
+	if err := s.store.SetCartContact(r.Context(), cid, store.CartContact{Name: req.Name, Phone: req.Phone, Email: req.Email}); err != nil && !errors.Is(err, store.ErrCartNotOpen) {
+		// A checked-out cart is handled by the checkout below.
+		log.Printf("cart %s: failed to save contact: %v", cid, err)
+	}
+
+	switch {
+	case req.AddressID != nil && req.Addr != nil:
+		writeError(w, http.StatusBadRequest, "give shipping_address or address_id, not both")
+		return
+	case req.AddressID != nil:
+		if customer.UserID == nil {
+			writeError(w, http.StatusUnauthorized, "log in to use a saved address")
+			return
+		}
+		saved, err := s.store.GetCustomerAddress(r.Context(), *customer.UserID, *req.AddressID)
 		if err != nil {
-			writeError(w, http.StatusBadGateway, "failed to create razorpay order")
+			if errors.Is(err, store.ErrNotFound) {
+				writeError(w, http.StatusNotFound, "address not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "failed to get address")
 			return
 		}
-		if err := s.store.SetPaymentRazorpayOrderID(r.Context(), res.PaymentID, rzOrderID); err != nil {
-			writeError(w, http.StatusInternalServerError, "failed to persist razorpay order")
+		customer.Address = saved.Address
+	case req.Addr != nil:
+		customer.Address = *req.Addr
+	default:
+		writeError(w, http.StatusBadRequest, "shipping_address or address_id is required")
+		return
+	}
+	res, err := s.store.CheckoutFromCart(
+		r.Context(),
+		cid,
+		customer,
+		provider.Name(),
+		req.DiscountCode,
+		store.ShippingOptions{FlatINR: s.cfg.ShippingFlatINR, CashOnDelivery: provider.ConfirmsAtCheckout()},
+		store.GSTSettings{SellerState: s.cfg.SellerState, FallbackRateBps: s.cfg.TaxRateBps},
+	)
+	if errors.Is(err, store.ErrCartNotOpen) {
+		// A cart whose order still waits for its payment to start checks out
+		// as that order again, so a retry after the payment could not be set
+		// up (502 below) gets it instead of failing on the cart.
+		if pending, perr := s.store.PendingCartCheckout(r.Context(), cid); perr == nil && pending.Provider == provider.Name() {
+			res, err = pending, nil
+		}
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrDiscountRejected) || errors.Is(err, store.ErrNotServiceable) {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
 			return
 		}
-		rz = &struct {
-			KeyID    string `json:"key_id"`
-			OrderID  string `json:"order_id"`
-			AmountINR int   `json:"amount_inr"`
-			Currency string `json:"currency"`
-		}{
-			KeyID:    s.cfg.RazorpayKeyID,
-			OrderID:  rzOrderID,
-			AmountINR: res.AmountINR,
-			Currency: res.Currency,
+		if !writeCartError(w, err) {
+			writeError(w, http.StatusBadRequest, err.Error())
 		}
+		return
 	}
+	intent, err := provider.CreateIntent(r.Context(), payments.Intent{
+		OrderID:         res.OrderID,
+		PaymentID:       res.PaymentID,
+		AmountINR:       res.AmountINR,
+		Currency:        res.Currency,
+		ProviderOrderID: res.ProviderOrderID,
+	})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "failed to create "+res.Provider+" payment")
+		return
+	}
+	// Provider-specific payment data (e.g. the Razorpay order) is returned
+	// under the provider's name.
 	writeJSON(w, http.StatusCreated, map[string]any{
 		"order_id":   res.OrderID,
 		"payment_id": res.PaymentID,
 		"amount_inr": res.AmountINR,
 		"currency":   res.Currency,
 		"provider":   res.Provider,
-		"razorpay":   rz,
+		res.Provider: intent,
 	})
 }
 
@@ -225,7 +394,7 @@ func (s *Server) handleAdminLogin(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleAdminListProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := s.store.ListProductsWithVariants(r.Context(), false)
+	products, err := s.store.ListProductsWithVariants(r.Context(), false, r.URL.Query().Get("category"))
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to list products")
 		return
@@ -234,17 +403,20 @@ func (s *Server) handleAdminListProducts(w http.ResponseWriter, r *http.Request)
 }
 
 type adminCreateProductRequest struct {
-	Slug        string `json:"slug"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Status      string `json:"status"`
+	Slug        string   `json:"slug"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Status      string   `json:"status"`
+	HSNCode     string   `json:"hsn_code"`
+	CategoryIDs []string `json:"category_ids"`
 	Variants    []struct {
-		SKU       string `json:"sku"`
-		Title     string `json:"title"`
-		Size      string `json:"size"`
-		Color     string `json:"color"`
-		PriceINR  int    `json:"price_inr"`
-		OnHand    int    `json:"on_hand"`
+		SKU         string `json:"sku"`
+		Title       string `json:"title"`
+		Size        string `json:"size"`
+		Color       string `json:"color"`
+		PriceINR    int    `json:"price_inr"`
+		WeightGrams int    `json:"weight_grams"`
+		OnHand      int    `json:"on_hand"`
 	} `json:"variants"`
 }
 
@@ -261,19 +433,29 @@ func (s *Server) handleAdminCreateProduct(w http.ResponseWriter, r *http.Request
 	if req.Status == "" {
 		req.Status = "draft"
 	}
+	if req.HSNCode != "" && !gst.ValidHSN(req.HSNCode) {
+		writeError(w, http.StatusBadRequest, "hsn_code must be 4, 6 or 8 digits")
+		return
+	}
+	categoryIDs, err := parseUUIDs(req.CategoryIDs)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid category_ids")
+		return
+	}
 	var variants []store.CreateVariantInput
 	for _, v := range req.Variants {
-		if v.SKU == "" || v.PriceINR < 0 || v.OnHand < 0 {
+		if v.SKU == "" || v.PriceINR < 0 || v.OnHand < 0 || v.WeightGrams < 0 {
 			writeError(w, http.StatusBadRequest, "invalid variant")
 			return
 		}
 		variants = append(variants, store.CreateVariantInput{
-			SKU:      v.SKU,
-			Title:    v.Title,
-			Size:     v.Size,
-			Color:    v.Color,
-			PriceINR: v.PriceINR,
-			OnHand:   v.OnHand,
+			SKU:         v.SKU,
+			Title:       v.Title,
+			Size:        v.Size,
+			Color:       v.Color,
+			PriceINR:    v.PriceINR,
+			WeightGrams: v.WeightGrams,
+			OnHand:      v.OnHand,
 		})
 	}
 	p, err := s.store.AdminCreateProduct(r.Context(), store.CreateProductInput{
@@ -281,6 +463,8 @@ func (s *Server) handleAdminCreateProduct(w http.ResponseWriter, r *http.Request
 		Name:        req.Name,
 		Description: req.Description,
 		Status:      req.Status,
+		HSNCode:     req.HSNCode,
+		CategoryIDs: categoryIDs,
 		Variants:    variants,
 	})
 	if err != nil {
@@ -291,10 +475,12 @@ func (s *Server) handleAdminCreateProduct(w http.ResponseWriter, r *http.Request
 }
 
 type adminUpdateProductRequest struct {
-	Slug        string `json:"slug"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Status      string `json:"status"`
+	Slug        string    `json:"slug"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Status      string    `json:"status"`
+	HSNCode     *string   `json:"hsn_code"`
+	CategoryIDs *[]string `json:"category_ids"`
 }
 
 func (s *Server) handleAdminUpdateProduct(w http.ResponseWriter, r *http.Request) {
@@ -312,7 +498,20 @@ func (s *Server) handleAdminUpdateProduct(w http.ResponseWriter, r *http.Request
 		writeError(w, http.StatusBadRequest, "slug, name, status required")
 		return
 	}
-	if err := s.store.AdminUpdateProduct(r.Context(), pid, req.Slug, req.Name, req.Description, req.Status); err != nil {
+	if req.HSNCode != nil && *req.HSNCode != "" && !gst.ValidHSN(*req.HSNCode) {
+		writeError(w, http.StatusBadRequest, "hsn_code must be 4, 6 or 8 digits")
+		return
+	}
+	// Omitting category_ids keeps the current categories; an empty list clears them.
+	var categoryIDs []uuid.UUID
+	if req.CategoryIDs != nil {
+		categoryIDs, err = parseUUIDs(*req.CategoryIDs)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid category_ids")
+			return
+		}
+	}
+	if err := s.store.AdminUpdateProduct(r.Context(), pid, req.Slug, req.Name, req.Description, req.Status, req.HSNCode, categoryIDs); err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			writeError(w, http.StatusNotFound, "product not found")
 			return
@@ -324,12 +523,13 @@ func (s *Server) handleAdminUpdateProduct(w http.ResponseWriter, r *http.Request
 }
 
 type adminCreateVariantRequest struct {
-	SKU      string `json:"sku"`
-	Title    string `json:"title"`
-	Size     string `json:"size"`
-	Color    string `json:"color"`
-	PriceINR int    `json:"price_inr"`
-	OnHand   int    `json:"on_hand"`
+	SKU         string `json:"sku"`
+	Title       string `json:"title"`
+	Size        string `json:"size"`
+	Color       string `json:"color"`
+	PriceINR    int    `json:"price_inr"`
+	WeightGrams int    `json:"weight_grams"`
+	OnHand      int    `json:"on_hand"`
 }
 
 func (s *Server) handleAdminCreateVariant(w http.ResponseWriter, r *http.Request) {
@@ -343,17 +543,18 @@ func (s *Server) handleAdminCreateVariant(w http.ResponseWriter, r *http.Request
 		writeError(w, http.StatusBadRequest, "invalid json body")
 		return
 	}
-	if req.SKU == "" || req.PriceINR < 0 || req.OnHand < 0 {
+	if req.SKU == "" || req.PriceINR < 0 || req.OnHand < 0 || req.WeightGrams < 0 {
 		writeError(w, http.StatusBadRequest, "invalid variant")
 		return
 	}
 	v, err := s.store.AdminCreateVariant(r.Context(), pid, store.CreateVariantForProductInput{
-		SKU:      req.SKU,
-		Title:    req.Title,
-		Size:     req.Size,
-		Color:    req.Color,
-		PriceINR: req.PriceINR,
-		OnHand:   req.OnHand,
+		SKU:         req.SKU,
+		Title:       req.Title,
+		Size:        req.Size,
+		Color:       req.Color,
+		PriceINR:    req.PriceINR,
+		WeightGrams: req.WeightGrams,
+		OnHand:      req.OnHand,
 	})
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
@@ -363,10 +564,11 @@ func (s *Server) handleAdminCreateVariant(w http.ResponseWriter, r *http.Request
 }
 
 type adminUpdateVariantRequest struct {
-	Title    string `json:"title"`
-	Size     string `json:"size"`
-	Color    string `json:"color"`
-	PriceINR int    `json:"price_inr"`
+	Title       string `json:"title"`
+	Size        string `json:"size"`
+	Color       string `json:"color"`
+	PriceINR    int    `json:"price_inr"`
+	WeightGrams *int   `json:"weight_grams"`
 }
 
 func (s *Server) handleAdminUpdateVariant(w http.ResponseWriter, r *http.Request) {
@@ -384,7 +586,11 @@ func (s *Server) handleAdminUpdateVariant(w http.ResponseWriter, r *http.Request
 		writeError(w, http.StatusBadRequest, "invalid price_inr")
 		return
 	}
-	if err := s.store.AdminUpdateVariant(r.Context(), vid, req.Title, req.Size, req.Color, req.PriceINR, nil); err != nil {
+	if req.WeightGrams != nil && *req.WeightGrams < 0 {
+		writeError(w, http.StatusBadRequest, "invalid weight_grams")
+		return
+	}
+	if err := s.store.AdminUpdateVariant(r.Context(), vid, req.Title, req.Size, req.Color, req.PriceINR, nil, req.WeightGrams); err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			writeError(w, http.StatusNotFound, "variant not found")
 			return
@@ -398,6 +604,7 @@ func (s *Server) handleAdminUpdateVariant(w http.ResponseWriter, r *http.Request
 type adminAdjustInventoryRequest struct {
 	VariantID string `json:"variant_id"`
 	Delta     int    `json:"delta"`
+	Note      string `json:"note"`
 }
 
 func (s *Server) handleAdminAdjustInventory(w http.ResponseWriter, r *http.Request) {
@@ -411,8 +618,13 @@ func (s *Server) handleAdminAdjustInventory(w http.ResponseWriter, r *http.Reque
 		writeError(w, http.StatusBadRequest, "invalid variant_id")
 		return
 	}
-	onHand, reserved, err := s.store.AdminAdjustInventory(r.Context(), vid, req.Delta)
+	p, _ := auth.PrincipalFrom(r.Context())
+	onHand, reserved, err := s.store.AdminAdjustInventory(r.Context(), vid, req.Delta, p.UserID, req.Note)
 	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "variant not found")
+			return
+		}
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -0,0 +1,147 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/store"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+	// maxIdempotentBodyBytes bounds the request bodies buffered for
+	// fingerprinting; it fits an image upload.
+	maxIdempotentBodyBytes = maxImageBytes + 1<<20
+)
+
+// idempotent makes mutating requests sent with an Idempotency-Key header safe
+// to retry. The first request with a key runs normally and its response is
+// stored; a retry with the same key and body gets the stored response back
+// (marked with Idempotent-Replayed: true) without running the handler again.
+// Reusing a key for a different request is rejected with 422, and a retry
+// that arrives while the first request is still running gets 409. Keys are
+// scoped per logged-in user, and for anonymous callers per cart_id of the
+// request body, so unrelated shoppers never share keys. Responses with a 5xx
+// status are not stored, so the request can be retried with the same key.
+func (s *Server) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+		if key == "" || s.cfg.IdempotencyKeyTTL <= 0 || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			writeError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+		if err != nil {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		h := sha256.New()
+		h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		h.Write(body)
+		fingerprint := hex.EncodeToString(h.Sum(nil))
+
+		var scope string
+		if p, ok := auth.PrincipalFrom(r.Context()); ok {
+			scope = string(p.Role) + ":" + p.UserID.String()
+		} else {
+			var cart struct {
+				CartID string `json:"cart_id"`
+			}
+			_ = json.Unmarshal(body, &cart)
+			scope = "cart:" + strings.TrimSpace(cart.CartID)
+		}
+
+		existing, claimed, err := s.store.ClaimIdempotencyKey(r.Context(), scope, key, fingerprint, s.cfg.IdempotencyKeyTTL)
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusConflict, "request with this Idempotency-Key is in progress")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to check Idempotency-Key")
+			return
+		}
+		if !claimed {
+			switch {
+			case existing.RequestHash != fingerprint:
+				writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			case existing.Status == 0:
+				writeError(w, http.StatusConflict, "request with this Idempotency-Key is in progress")
+			default:
+				if existing.ContentType != "" {
+					w.Header().Set("Content-Type", existing.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(existing.Status)
+				_, _ = w.Write(existing.Body)
+			}
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+		defer func() {
+			// The request context may be cancelled by now (timeout, client
+			// gone); the key must still be settled.
+			ctx := context.WithoutCancel(r.Context())
+			if !completed {
+				_ = s.store.ReleaseIdempotencyKey(ctx, scope, key)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+
+		if rec.status >= 500 {
+			return
+		}
+		ctx := context.WithoutCancel(r.Context())
+		if err := s.store.CompleteIdempotencyKey(ctx, scope, key, store.IdempotentResponse{
+			RequestHash: fingerprint,
+			Status:      rec.status,
+			ContentType: rec.Header().Get("Content-Type"),
+			Body:        rec.body.Bytes(),
+		}); err == nil {
+			completed = true
+		}
+	})
+}
+
+// responseRecorder passes a response through while keeping a copy of its
+// status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if !rr.wroteHeader {
+		rr.status = status
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if !rr.wroteHeader {
+		rr.WriteHeader(http.StatusOK)
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
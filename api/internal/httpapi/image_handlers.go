@@ -0,0 +1,160 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/store"
+)
+
+const maxImageBytes = 10 << 20
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+}
+
+func (s *Server) handleAdminUploadProductImage(w http.ResponseWriter, r *http.Request) {
+	pid, err := uuid.Parse(chi.URLParam(r, "productID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product_id")
+		return
+	}
+	s.uploadImage(w, r, store.ImageOwner{ProductID: &pid}, "products/"+pid.String())
+}
+
+func (s *Server) handleAdminUploadVariantImage(w http.ResponseWriter, r *http.Request) {
+	vid, err := uuid.Parse(chi.URLParam(r, "variantID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid variant_id")
+		return
+	}
+	s.uploadImage(w, r, store.ImageOwner{VariantID: &vid}, "variants/"+vid.String())
+}
+
+// uploadImage stores the multipart "file" field under keyPrefix and attaches it to owner.
+func (s *Server) uploadImage(w http.ResponseWriter, r *http.Request, owner store.ImageOwner, keyPrefix string) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageBytes+1<<20)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "multipart field \"file\" required")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImageBytes+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read file")
+		return
+	}
+	if len(data) > maxImageBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, "image too large")
+		return
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "unsupported image type")
+		return
+	}
+
+	key := keyPrefix + "/" + uuid.NewString() + ext
+	url, err := s.media.Put(r.Context(), key, bytes.NewReader(data), contentType)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to store image")
+		return
+	}
+	img, err := s.store.AdminAddImage(r.Context(), owner, url, key)
+	if err != nil {
+		_ = s.media.Delete(r.Context(), key)
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "image owner not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to save image")
+		return
+	}
+	writeJSON(w, http.StatusCreated, img)
+}
+
+type adminReorderImagesRequest struct {
+	ImageIDs []string `json:"image_ids"`
+}
+
+func (s *Server) handleAdminReorderProductImages(w http.ResponseWriter, r *http.Request) {
+	pid, err := uuid.Parse(chi.URLParam(r, "productID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product_id")
+		return
+	}
+	s.reorderImages(w, r, store.ImageOwner{ProductID: &pid})
+}
+
+func (s *Server) handleAdminReorderVariantImages(w http.ResponseWriter, r *http.Request) {
+	vid, err := uuid.Parse(chi.URLParam(r, "variantID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid variant_id")
+		return
+	}
+	s.reorderImages(w, r, store.ImageOwner{VariantID: &vid})
+}
+
+func (s *Server) reorderImages(w http.ResponseWriter, r *http.Request, owner store.ImageOwner) {
+	var req adminReorderImagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	ids := make([]uuid.UUID, 0, len(req.ImageIDs))
+	for _, raw := range req.ImageIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid image_ids")
+			return
+		}
+		ids = append(ids, id)
+	}
+	if err := s.store.AdminReorderImages(r.Context(), owner, ids); err != nil {
+		if errors.Is(err, store.ErrImageOrderMismatch) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to reorder images")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+func (s *Server) handleAdminDeleteImage(w http.ResponseWriter, r *http.Request) {
+	iid, err := uuid.Parse(chi.URLParam(r, "imageID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid image_id")
+		return
+	}
+	key, err := s.store.AdminDeleteImage(r.Context(), iid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "image not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to delete image")
+		return
+	}
+	// Images added before uploads were supported have no storage key.
+	if key != "" {
+		if err := s.media.Delete(r.Context(), key); err != nil {
+			log.Printf("delete stored image %s: %v", key, err)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
@@ -0,0 +1,44 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/store"
+)
+
+func (s *Server) handleAdminListInventoryMovements(w http.ResponseWriter, r *http.Request) {
+	vid, err := uuid.Parse(chi.URLParam(r, "variantID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid variant_id")
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	page, err := s.store.AdminListInventoryMovements(r.Context(), vid, limit, r.URL.Query().Get("cursor"))
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to list inventory movements")
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) handleAdminReconcileInventory(w http.ResponseWriter, r *http.Request) {
+	discrepancies, err := s.store.ReconcileInventory(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to reconcile inventory")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ok":            len(discrepancies) == 0,
+		"discrepancies": discrepancies,
+	})
+}
+
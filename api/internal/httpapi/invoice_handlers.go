@@ -0,0 +1,92 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/store"
+)
+
+// handleAdminIssueInvoice issues the order's invoice if it has none yet and
+// returns it with a customer download link.
+func (s *Server) handleAdminIssueInvoice(w http.ResponseWriter, r *http.Request) {
+	oid, err := uuid.Parse(chi.URLParam(r, "orderID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order_id")
+		return
+	}
+	if s.invoices == nil {
+		writeError(w, http.StatusServiceUnavailable, "invoicing is not configured")
+		return
+	}
+	inv, err := s.invoices.Issue(r.Context(), oid)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(w, http.StatusNotFound, "order not found")
+		case errors.Is(err, store.ErrOrderNotInvoiceable):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to issue invoice")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"invoice": inv, "customer_url": s.invoices.Link(oid)})
+}
+
+func (s *Server) handleAdminGetInvoicePDF(w http.ResponseWriter, r *http.Request) {
+	oid, err := uuid.Parse(chi.URLParam(r, "orderID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order_id")
+		return
+	}
+	s.writeInvoicePDF(w, r, oid)
+}
+
+// handleGetInvoicePDF serves an invoice to a customer holding a signed link.
+func (s *Server) handleGetInvoicePDF(w http.ResponseWriter, r *http.Request) {
+	subject, err := s.links.Verify(auth.LinkInvoice, chi.URLParam(r, "token"))
+	if err != nil {
+		if errors.Is(err, auth.ErrExpiredLinkToken) {
+			writeError(w, http.StatusGone, "invoice link expired")
+			return
+		}
+		writeError(w, http.StatusNotFound, "invoice not found")
+		return
+	}
+	oid, err := uuid.Parse(subject)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "invoice not found")
+		return
+	}
+	s.writeInvoicePDF(w, r, oid)
+}
+
+func (s *Server) writeInvoicePDF(w http.ResponseWriter, r *http.Request, orderID uuid.UUID) {
+	inv, doc, err := s.store.GetInvoicePDF(r.Context(), orderID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "invoice not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to load invoice")
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+invoiceFilename(inv.Number)+`"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(doc)
+}
+
+// invoiceFilename turns an invoice number such as "INV/26-27/000042" into
+// "INV-26-27-000042.pdf".
+func invoiceFilename(number string) string {
+	return strings.ReplaceAll(number, "/", "-") + ".pdf"
+}
+
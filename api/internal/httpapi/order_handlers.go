@@ -0,0 +1,86 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/store"
+)
+
+type adminOrderActionRequest struct {
+	Reason string `json:"reason"`
+}
+
+func (s *Server) handleAdminCancelOrder(w http.ResponseWriter, r *http.Request) {
+	s.orderAction(w, r, true, func(oid uuid.UUID, actor store.Actor, req adminOrderActionRequest) error {
+		return s.store.AdminCancelOrder(r.Context(), oid, actor, req.Reason)
+	})
+}
+
+func (s *Server) handleAdminFulfillOrder(w http.ResponseWriter, r *http.Request) {
+	s.orderAction(w, r, false, func(oid uuid.UUID, actor store.Actor, req adminOrderActionRequest) error {
+		return s.store.AdminFulfillOrder(r.Context(), oid, actor, req.Reason)
+	})
+}
+
+// handleAdminAcceptPayment accepts a capture held in payment_mismatch.
+func (s *Server) handleAdminAcceptPayment(w http.ResponseWriter, r *http.Request) {
+	s.orderAction(w, r, true, func(oid uuid.UUID, actor store.Actor, req adminOrderActionRequest) error {
+		return s.store.AdminAcceptPayment(r.Context(), oid, actor, req.Reason)
+	})
+}
+
+// orderAction runs an admin status change on the order in the URL and responds
+// with the updated order. An empty body is accepted when no reason is required.
+func (s *Server) orderAction(w http.ResponseWriter, r *http.Request, reasonRequired bool, apply func(uuid.UUID, store.Actor, adminOrderActionRequest) error) {
+	oid, err := uuid.Parse(chi.URLParam(r, "orderID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order_id")
+		return
+	}
+	var req adminOrderActionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if reasonRequired && req.Reason == "" {
+		writeError(w, http.StatusBadRequest, "reason is required")
+		return
+	}
+
+	p, _ := auth.PrincipalFrom(r.Context())
+	if err := apply(oid, store.AdminActor(p.UserID), req); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "order not found")
+			return
+		}
+		if errors.Is(err, store.ErrInvalidTransition) || errors.Is(err, store.ErrInsufficientStock) ||
+			errors.Is(err, store.ErrPaymentAuthorized) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to update order")
+		return
+	}
+	s.writeOrder(w, r, oid, http.StatusOK)
+}
+
+// writeOrder responds with the admin view of an order after a change to it.
+func (s *Server) writeOrder(w http.ResponseWriter, r *http.Request, orderID uuid.UUID, status int) {
+	o, err := s.store.AdminGetOrder(r.Context(), orderID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load order")
+		return
+	}
+	writeJSON(w, status, o)
+}
+
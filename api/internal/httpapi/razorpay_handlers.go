@@ -1,11 +1,16 @@
 package httpapi
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 
+	"clothes-shop/api/internal/payments"
 	"clothes-shop/api/internal/razorpay"
+	"clothes-shop/api/internal/store"
 )
 
 type razorpayVerifyRequest struct {
@@ -15,11 +20,6 @@ type razorpayVerifyRequest struct {
 }
 
 func (s *Server) handleRazorpayVerify(w http.ResponseWriter, r *http.Request) {
-	if s.cfg.RazorpayKeySecret == "" {
-		writeError(w, http.StatusBadRequest, "razorpay not configured")
-		return
-	}
-
 	var req razorpayVerifyRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid json body")
@@ -29,32 +29,39 @@ func (s *Server) handleRazorpayVerify(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "missing razorpay fields")
 		return
 	}
-	if !razorpay.VerifyPaymentSignature(req.RazorpayOrderID, req.RazorpayPaymentID, req.RazorpaySignature, s.cfg.RazorpayKeySecret) {
-		writeError(w, http.StatusUnauthorized, "invalid signature")
+
+	p, ok := s.payments["razorpay"]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "razorpay not configured")
 		return
 	}
-
-	if err := s.store.MarkPaymentAuthorized(r.Context(), req.RazorpayOrderID, req.RazorpayPaymentID, req.RazorpaySignature); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to persist payment")
+	err := p.Verify(r.Context(), payments.Verification{
+		ProviderOrderID:   req.RazorpayOrderID,
+		ProviderPaymentID: req.RazorpayPaymentID,
+		Signature:         req.RazorpaySignature,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, payments.ErrNotConfigured):
+			writeError(w, http.StatusBadRequest, "razorpay not configured")
+		case errors.Is(err, payments.ErrInvalidSignature):
+			writeError(w, http.StatusUnauthorized, "invalid signature")
+		case errors.Is(err, store.ErrNotFound):
+			writeError(w, http.StatusNotFound, "payment not found")
+		case errors.Is(err, store.ErrInvalidTransition):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to persist payment")
+		}
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 }
 
-type razorpayWebhook struct {
-	Event   string `json:"event"`
-	Payload struct {
-		Payment struct {
-			Entity struct {
-				ID      string `json:"id"`
-				OrderID string `json:"order_id"`
-				Status  string `json:"status"`
-			} `json:"entity"`
-		} `json:"payment"`
-	} `json:"payload"`
-}
-
+// handleRazorpayWebhook stores verified events in the webhook inbox and leaves
+// processing to the webhook worker, so a failure is retried and never lost.
+// Redeliveries of a stored event are acknowledged without storing it again.
 func (s *Server) handleRazorpayWebhook(w http.ResponseWriter, r *http.Request) {
 	if s.cfg.RazorpayWebhookSecret == "" {
 		writeError(w, http.StatusBadRequest, "webhook not configured")
@@ -75,30 +82,24 @@ func (s *Server) handleRazorpayWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var evt razorpayWebhook
-	if err := json.Unmarshal(body, &evt); err != nil {
+	evt, err := razorpay.ParseWebhookEvent(body)
+	if err != nil {
 		writeError(w, http.StatusBadRequest, "invalid json")
 		return
 	}
-
-	orderID := evt.Payload.Payment.Entity.OrderID
-	paymentID := evt.Payload.Payment.Entity.ID
-	if orderID == "" || paymentID == "" {
-		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
-		return
+	eventID := r.Header.Get("X-Razorpay-Event-Id")
+	if eventID == "" {
+		// Razorpay always sends the header; fall back to the body so a
+		// redelivery is still recognised.
+		sum := sha256.Sum256(body)
+		eventID = "sha256:" + hex.EncodeToString(sum[:])
 	}
 
-	switch evt.Event {
-	case "payment.authorized":
-		_ = s.store.MarkPaymentAuthorized(r.Context(), orderID, paymentID, "")
-	case "payment.captured":
-		_ = s.store.MarkPaymentCaptured(r.Context(), orderID, paymentID)
-	case "payment.failed":
-		_ = s.store.MarkPaymentFailed(r.Context(), orderID, paymentID)
-	default:
-		// ignore
+	duplicate, err := s.store.RecordWebhookEvent(r.Context(), "razorpay", eventID, evt.Event, body)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to store webhook")
+		return
 	}
-
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "duplicate": duplicate})
 }
 
@@ -0,0 +1,43 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/store"
+)
+
+func (s *Server) handleAdminListReconciliationIssues(w http.ResponseWriter, r *http.Request) {
+	includeResolved, _ := strconv.ParseBool(r.URL.Query().Get("include_resolved"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	issues, err := s.store.AdminListReconciliationIssues(r.Context(), includeResolved, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list reconciliation issues")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"issues": issues})
+}
+
+func (s *Server) handleAdminResolveReconciliationIssue(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "issueID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid issue_id")
+		return
+	}
+	p, _ := auth.PrincipalFrom(r.Context())
+	if err := s.store.AdminResolveReconciliationIssue(r.Context(), id, p.UserID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "issue not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to resolve issue")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
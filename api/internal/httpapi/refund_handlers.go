@@ -0,0 +1,135 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/payments"
+	"clothes-shop/api/internal/store"
+)
+
+type adminRefundOrderRequest struct {
+	// AmountINR is in paise; 0 refunds everything not yet refunded.
+	AmountINR int    `json:"amount_inr"`
+	Reason    string `json:"reason"`
+	Restock   bool   `json:"restock"`
+}
+
+// handleAdminRefundOrder refunds an order's captured payment through its
+// payment provider. The refund stays pending until the provider reports it
+// processed, either in its response or through a webhook.
+func (s *Server) handleAdminRefundOrder(w http.ResponseWriter, r *http.Request) {
+	oid, err := uuid.Parse(chi.URLParam(r, "orderID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order_id")
+		return
+	}
+	var req adminRefundOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		writeError(w, http.StatusBadRequest, "reason is required")
+		return
+	}
+	if req.AmountINR < 0 {
+		writeError(w, http.StatusBadRequest, "amount_inr must not be negative")
+		return
+	}
+
+	p, _ := auth.PrincipalFrom(r.Context())
+	actor := store.AdminActor(p.UserID)
+	rf, err := s.store.AdminCreateRefund(r.Context(), oid, req.AmountINR, req.Restock, actor, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(w, http.StatusNotFound, "order not found")
+		case errors.Is(err, store.ErrNotRefundable):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, store.ErrRefundAmount), errors.Is(err, store.ErrRestockNeedsFull):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to create refund")
+		}
+		return
+	}
+
+	processed, err := s.submitRefund(r.Context(), rf, actor)
+	if err != nil {
+		writeRefundSubmitError(w, rf, err)
+		return
+	}
+	if !processed {
+		s.writeOrder(w, r, oid, http.StatusAccepted)
+		return
+	}
+	s.writeOrder(w, r, oid, http.StatusOK)
+}
+
+var (
+	errRefundProviderDisabled = errors.New("payment provider not enabled")
+	errRefundProviderFailed   = errors.New("payment provider refund failed")
+)
+
+// submitRefund sends a pending refund to its payment provider and records
+// the outcome, reporting whether the refund has been processed already.
+// Refunds the provider rejects are marked failed. When the outcome is unknown,
+// e.g. after a timeout, the refund stays pending until the provider's webhook
+// or payment reconciliation settles it.
+func (s *Server) submitRefund(ctx context.Context, rf store.Refund, actor store.Actor) (bool, error) {
+	settled := store.ProviderRefund{Receipt: rf.ID.String()}
+	provider, ok := s.payments[rf.Provider]
+	if !ok {
+		if ferr := s.store.MarkRefundFailed(ctx, settled, errRefundProviderDisabled.Error()); ferr != nil {
+			log.Printf("refund %s: failed to record failure: %v", rf.ID, ferr)
+		}
+		return false, errRefundProviderDisabled
+	}
+	res, err := provider.Refund(ctx, rf)
+	if err != nil && !errors.Is(err, payments.ErrRefundRejected) {
+		log.Printf("refund %s: outcome unknown, left pending: %v", rf.ID, err)
+		return false, nil
+	}
+	if err != nil {
+		if ferr := s.store.MarkRefundFailed(ctx, settled, err.Error()); ferr != nil {
+			log.Printf("refund %s: failed to record failure: %v", rf.ID, ferr)
+		}
+		return false, errRefundProviderFailed
+	}
+	if res.ProviderRefundID != "" {
+		if err := s.store.SetRefundSubmitted(ctx, rf.ID, res.ProviderRefundID); err != nil {
+			return false, fmt.Errorf("persist provider refund: %w", err)
+		}
+		settled.ID = res.ProviderRefundID
+	}
+	if !res.Processed {
+		return false, nil
+	}
+	if err := s.store.MarkRefundProcessed(ctx, settled, actor); err != nil {
+		return false, fmt.Errorf("record refund: %w", err)
+	}
+	return true, nil
+}
+
+func writeRefundSubmitError(w http.ResponseWriter, rf store.Refund, err error) {
+	switch {
+	case errors.Is(err, errRefundProviderDisabled):
+		writeError(w, http.StatusConflict, "payment provider "+rf.Provider+" is not enabled")
+	case errors.Is(err, errRefundProviderFailed):
+		writeError(w, http.StatusBadGateway, "failed to create refund with payment provider")
+	default:
+		writeError(w, http.StatusInternalServerError, "failed to record refund")
+	}
+}
+
@@ -0,0 +1,247 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/store"
+)
+
+type openReturnRequest struct {
+	// Phone identifies the customer: the number given at checkout. Admins
+	// leave it out.
+	Phone      string `json:"phone"`
+	Reason     string `json:"reason"`
+	Resolution string `json:"resolution"` // refund, store_credit or exchange
+	Items      []struct {
+		VariantID         uuid.UUID  `json:"variant_id"`
+		Quantity          int        `json:"quantity"`
+		ExchangeVariantID *uuid.UUID `json:"exchange_variant_id"`
+	} `json:"items"`
+}
+
+func (req openReturnRequest) input() store.ReturnInput {
+	in := store.ReturnInput{Reason: req.Reason, Resolution: strings.TrimSpace(req.Resolution)}
+	for _, it := range req.Items {
+		in.Items = append(in.Items, store.ReturnItemInput{VariantID: it.VariantID, Quantity: it.Quantity, ExchangeVariantID: it.ExchangeVariantID})
+	}
+	return in
+}
+
+// handleOpenReturn opens a return for the customer who placed the order,
+// within RETURN_WINDOW of delivery.
+func (s *Server) handleOpenReturn(w http.ResponseWriter, r *http.Request) {
+	oid, err := uuid.Parse(chi.URLParam(r, "orderID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order_id")
+		return
+	}
+	var req openReturnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if strings.TrimSpace(req.Phone) == "" {
+		writeError(w, http.StatusBadRequest, "phone is required")
+		return
+	}
+	rt, err := s.store.OpenCustomerReturn(r.Context(), oid, req.Phone, req.input(), s.cfg.ReturnWindow)
+	if err != nil {
+		writeReturnError(w, "order", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rt)
+}
+
+// handleListReturns lists an order's returns for the customer who placed it.
+func (s *Server) handleListReturns(w http.ResponseWriter, r *http.Request) {
+	oid, err := uuid.Parse(chi.URLParam(r, "orderID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order_id")
+		return
+	}
+	phone := r.URL.Query().Get("phone")
+	if strings.TrimSpace(phone) == "" {
+		writeError(w, http.StatusBadRequest, "phone is required")
+		return
+	}
+	returns, err := s.store.ListCustomerReturns(r.Context(), oid, phone)
+	if err != nil {
+		writeReturnError(w, "order", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"returns": returns})
+}
+
+func (s *Server) handleAdminOpenReturn(w http.ResponseWriter, r *http.Request) {
+	oid, err := uuid.Parse(chi.URLParam(r, "orderID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order_id")
+		return
+	}
+	var req openReturnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	p, _ := auth.PrincipalFrom(r.Context())
+	rt, err := s.store.AdminOpenReturn(r.Context(), oid, req.input(), store.AdminActor(p.UserID))
+	if err != nil {
+		writeReturnError(w, "order", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rt)
+}
+
+func (s *Server) handleAdminListReturns(w http.ResponseWriter, r *http.Request) {
+	returns, err := s.store.AdminListReturns(r.Context(), r.URL.Query().Get("status"), 50)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list returns")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"returns": returns})
+}
+
+func (s *Server) handleAdminGetReturn(w http.ResponseWriter, r *http.Request) {
+	rid, err := uuid.Parse(chi.URLParam(r, "returnID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid return_id")
+		return
+	}
+	rt, err := s.store.GetReturn(r.Context(), rid)
+	if err != nil {
+		writeReturnError(w, "return", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rt)
+}
+
+func (s *Server) handleAdminApproveReturn(w http.ResponseWriter, r *http.Request) {
+	s.returnAction(w, r, false, s.store.AdminApproveReturn)
+}
+
+func (s *Server) handleAdminReceiveReturn(w http.ResponseWriter, r *http.Request) {
+	s.returnAction(w, r, false, s.store.AdminReceiveReturn)
+}
+
+func (s *Server) handleAdminRejectReturn(w http.ResponseWriter, r *http.Request) {
+	s.returnAction(w, r, true, s.store.AdminRejectReturn)
+}
+
+func (s *Server) handleAdminCancelReturn(w http.ResponseWriter, r *http.Request) {
+	s.returnAction(w, r, false, s.store.AdminCancelReturn)
+}
+
+type adminReturnActionRequest struct {
+	Note string `json:"note"`
+}
+
+// returnAction moves a return along with apply, taking an optional (or,
+// with noteRequired, mandatory) note.
+func (s *Server) returnAction(w http.ResponseWriter, r *http.Request, noteRequired bool, apply func(ctx context.Context, returnID uuid.UUID, note string) (store.Return, error)) {
+	rid, err := uuid.Parse(chi.URLParam(r, "returnID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid return_id")
+		return
+	}
+	var req adminReturnActionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if noteRequired && req.Note == "" {
+		writeError(w, http.StatusBadRequest, "note is required")
+		return
+	}
+	rt, err := apply(r.Context(), rid, req.Note)
+	if err != nil {
+		writeReturnError(w, "return", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rt)
+}
+
+type adminInspectReturnRequest struct {
+	Resolution string `json:"resolution"` // overrides the requested one: refund or store_credit
+	Note       string `json:"note"`
+	// Items not listed are accepted in full and not restocked.
+	Items []struct {
+		VariantID        uuid.UUID `json:"variant_id"`
+		AcceptedQuantity int       `json:"accepted_quantity"`
+		RestockQuantity  int       `json:"restock_quantity"`
+	} `json:"items"`
+}
+
+// handleAdminInspectReturn records the inspection of a received return and
+// settles it. A refund is submitted to the payment provider like one from
+// handleAdminRefundOrder; the return is answered with 202 while the refund
+// is pending.
+func (s *Server) handleAdminInspectReturn(w http.ResponseWriter, r *http.Request) {
+	rid, err := uuid.Parse(chi.URLParam(r, "returnID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid return_id")
+		return
+	}
+	var req adminInspectReturnRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+	}
+	in := store.InspectionInput{Resolution: strings.TrimSpace(req.Resolution), Note: req.Note}
+	for _, it := range req.Items {
+		in.Items = append(in.Items, store.InspectionItem{VariantID: it.VariantID, AcceptedQuantity: it.AcceptedQuantity, RestockQuantity: it.RestockQuantity})
+	}
+
+	p, _ := auth.PrincipalFrom(r.Context())
+	actor := store.AdminActor(p.UserID)
+	rt, rf, err := s.store.AdminInspectReturn(r.Context(), rid, in, actor)
+	if err != nil {
+		writeReturnError(w, "return", err)
+		return
+	}
+	if rf == nil {
+		writeJSON(w, http.StatusOK, rt)
+		return
+	}
+	// The return is settled either way; a refund that fails here is marked
+	// failed and can be issued again from the order.
+	processed, err := s.submitRefund(r.Context(), *rf, actor)
+	if err != nil {
+		writeRefundSubmitError(w, *rf, err)
+		return
+	}
+	if !processed {
+		writeJSON(w, http.StatusAccepted, rt)
+		return
+	}
+	writeJSON(w, http.StatusOK, rt)
+}
+
+// writeReturnError writes err from a return operation on subject ("order"
+// or "return").
+func writeReturnError(w http.ResponseWriter, subject string, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, subject+" not found")
+	case errors.Is(err, store.ErrInvalidReturn), errors.Is(err, store.ErrRefundAmount):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, store.ErrNotReturnable), errors.Is(err, store.ErrInvalidTransition),
+		errors.Is(err, store.ErrNotRefundable), errors.Is(err, store.ErrInsufficientStock):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "failed to update return")
+	}
+}
+
@@ -2,6 +2,8 @@ package httpapi
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -10,17 +12,28 @@ import (
 
 	"clothes-shop/api/internal/auth"
 	"clothes-shop/api/internal/config"
+	"clothes-shop/api/internal/invoice"
+	"clothes-shop/api/internal/payments"
+	"clothes-shop/api/internal/shipping"
+	"clothes-shop/api/internal/sms"
+	"clothes-shop/api/internal/storage"
 	"clothes-shop/api/internal/store"
 )
 
 type Server struct {
-	cfg   config.Config
-	store *store.Store
-	auth  *auth.Service
+	cfg      config.Config
+	store    *store.Store
+	auth     *auth.Service
+	media    storage.Storage
+	payments payments.Registry
+	links    *auth.LinkSigner
+	invoices *invoice.Issuer   // nil when invoicing is not configured
+	courier  shipping.Provider // nil when courier bookings are not configured
+	sms      sms.Sender
 }
 
-func New(cfg config.Config, store *store.Store, authSvc *auth.Service) *Server {
-	return &Server{cfg: cfg, store: store, auth: authSvc}
+func New(cfg config.Config, store *store.Store, authSvc *auth.Service, media storage.Storage, providers payments.Registry, links *auth.LinkSigner, invoices *invoice.Issuer, courier shipping.Provider, texts sms.Sender) *Server {
+	return &Server{cfg: cfg, store: store, auth: authSvc, media: media, payments: providers, links: links, invoices: invoices, courier: courier, sms: texts}
 }
 
 func (s *Server) Router() http.Handler {
@@ -34,7 +47,7 @@ func (s *Server) Router() http.Handler {
 
 	corsOpts := cors.Options{
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Requested-With"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Requested-With", "Idempotency-Key"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}
@@ -50,18 +63,51 @@ func (s *Server) Router() http.Handler {
 		_, _ = w.Write([]byte("ok"))
 	})
 
+	// Serve uploaded media ourselves when it is stored on the local filesystem.
+	if local, ok := s.media.(*storage.Local); ok {
+		if u, err := url.Parse(s.cfg.MediaBaseURL); err == nil {
+			prefix := strings.TrimRight(u.Path, "/")
+			if prefix != "" {
+				r.Handle(prefix+"/*", http.StripPrefix(prefix, local.Handler()))
+			}
+		}
+	}
+
 	r.Route("/v1", func(r chi.Router) {
 		r.Get("/products", s.handleListProducts)
 		r.Get("/products/{slug}", s.handleGetProduct)
+		r.Get("/categories", s.handleListCategories)
+		r.Get("/search", s.handleSearchProducts)
 
 		r.Post("/cart", s.handleCreateCart)
 		r.Get("/cart/{cartID}", s.handleGetCart)
 		r.Post("/cart/{cartID}/items", s.handleUpsertCartItem)
 		r.Delete("/cart/{cartID}/items/{variantID}", s.handleDeleteCartItem)
+		r.Put("/cart/{cartID}/contact", s.handleSetCartContact)
+		r.Post("/cart/recover", s.handleRecoverCart)
 
-		r.Post("/checkout", s.handleCheckoutFromCart)
+		r.With(s.auth.Optional, s.idempotent).Post("/checkout", s.handleCheckoutFromCart)
 		r.Post("/payments/razorpay/verify", s.handleRazorpayVerify)
 		r.Post("/webhooks/razorpay", s.handleRazorpayWebhook)
+		r.Post("/webhooks/courier", s.handleCourierWebhook)
+		r.Get("/invoices/{token}", s.handleGetInvoicePDF)
+		r.Get("/orders/{orderID}/returns", s.handleListReturns)
+		r.Post("/orders/{orderID}/returns", s.handleOpenReturn)
+
+		r.Post("/auth/otp", s.handleRequestOTP)
+		r.Post("/auth/otp/verify", s.handleVerifyOTP)
+
+		r.Route("/me", func(r chi.Router) {
+			r.Use(s.auth.Middleware)
+			r.Use(auth.RequireRole(auth.RoleCustomer))
+
+			r.Get("/", s.handleGetMe)
+			r.Get("/orders", s.handleListMyOrders)
+			r.Get("/addresses", s.handleListMyAddresses)
+			r.Post("/addresses", s.handleCreateMyAddress)
+			r.Put("/addresses/{addressID}", s.handleUpdateMyAddress)
+			r.Delete("/addresses/{addressID}", s.handleDeleteMyAddress)
+		})
 
 		r.Route("/admin", func(r chi.Router) {
 			r.Post("/login", s.handleAdminLogin)
@@ -69,16 +115,64 @@ func (s *Server) Router() http.Handler {
 			r.Group(func(r chi.Router) {
 				r.Use(s.auth.Middleware)
 				r.Use(auth.RequireRole(auth.RoleAdmin))
+				r.Use(s.idempotent)
 
 				r.Get("/products", s.handleAdminListProducts)
 				r.Post("/products", s.handleAdminCreateProduct)
 				r.Put("/products/{productID}", s.handleAdminUpdateProduct)
 				r.Post("/products/{productID}/variants", s.handleAdminCreateVariant)
 				r.Put("/variants/{variantID}", s.handleAdminUpdateVariant)
+				r.Post("/products/{productID}/images", s.handleAdminUploadProductImage)
+				r.Put("/products/{productID}/images/order", s.handleAdminReorderProductImages)
+				r.Post("/variants/{variantID}/images", s.handleAdminUploadVariantImage)
+				r.Put("/variants/{variantID}/images/order", s.handleAdminReorderVariantImages)
+				r.Delete("/images/{imageID}", s.handleAdminDeleteImage)
 				r.Post("/inventory/adjust", s.handleAdminAdjustInventory)
+				r.Get("/inventory/reconciliation", s.handleAdminReconcileInventory)
+				r.Get("/variants/{variantID}/inventory/movements", s.handleAdminListInventoryMovements)
+
+				r.Get("/categories", s.handleListCategories)
+				r.Post("/categories", s.handleAdminCreateCategory)
+				r.Put("/categories/{categoryID}", s.handleAdminUpdateCategory)
+				r.Delete("/categories/{categoryID}", s.handleAdminDeleteCategory)
 
 				r.Get("/orders", s.handleAdminListOrders)
 				r.Get("/orders/{orderID}", s.handleAdminGetOrder)
+				r.Post("/orders/{orderID}/cancel", s.handleAdminCancelOrder)
+				r.Post("/orders/{orderID}/fulfill", s.handleAdminFulfillOrder)
+				r.Post("/orders/{orderID}/refund", s.handleAdminRefundOrder)
+				r.Post("/orders/{orderID}/accept-payment", s.handleAdminAcceptPayment)
+				r.Post("/orders/{orderID}/invoice", s.handleAdminIssueInvoice)
+				r.Get("/orders/{orderID}/invoice", s.handleAdminGetInvoicePDF)
+				r.Post("/orders/{orderID}/shipments", s.handleAdminCreateShipment)
+				r.Post("/orders/{orderID}/shipments/book", s.handleAdminBookShipment)
+				r.Post("/shipments/{shipmentID}/deliver", s.handleAdminDeliverShipment)
+				r.Post("/shipments/{shipmentID}/cancel", s.handleAdminCancelShipment)
+				r.Get("/shipments/{shipmentID}/label", s.handleAdminGetShipmentLabel)
+				r.Post("/shipments/{shipmentID}/track", s.handleAdminTrackShipment)
+
+				r.Post("/orders/{orderID}/returns", s.handleAdminOpenReturn)
+				r.Get("/returns", s.handleAdminListReturns)
+				r.Get("/returns/{returnID}", s.handleAdminGetReturn)
+				r.Post("/returns/{returnID}/approve", s.handleAdminApproveReturn)
+				r.Post("/returns/{returnID}/reject", s.handleAdminRejectReturn)
+				r.Post("/returns/{returnID}/receive", s.handleAdminReceiveReturn)
+				r.Post("/returns/{returnID}/inspect", s.handleAdminInspectReturn)
+				r.Post("/returns/{returnID}/cancel", s.handleAdminCancelReturn)
+
+				r.Get("/discounts", s.handleAdminListDiscounts)
+				r.Post("/discounts", s.handleAdminCreateDiscount)
+				r.Put("/discounts/{discountID}", s.handleAdminUpdateDiscount)
+
+				r.Get("/shipping/zones", s.handleAdminListShippingZones)
+				r.Post("/shipping/zones", s.handleAdminCreateShippingZone)
+				r.Put("/shipping/zones/{zoneID}", s.handleAdminUpdateShippingZone)
+				r.Delete("/shipping/zones/{zoneID}", s.handleAdminDeleteShippingZone)
+
+				r.Get("/webhooks", s.handleAdminListWebhookEvents)
+				r.Post("/webhooks/{eventID}/replay", s.handleAdminReplayWebhookEvent)
+				r.Get("/payments/reconciliation", s.handleAdminListReconciliationIssues)
+				r.Post("/payments/reconciliation/{issueID}/resolve", s.handleAdminResolveReconciliationIssue)
 			})
 		})
 	})
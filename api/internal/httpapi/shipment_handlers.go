@@ -0,0 +1,126 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/store"
+)
+
+type adminCreateShipmentRequest struct {
+	Carrier        string     `json:"carrier"`
+	TrackingNumber string     `json:"tracking_number"`
+	Note           string     `json:"note"`
+	ShippedAt      *time.Time `json:"shipped_at"`
+	// Items to ship; omitted ships everything not shipped yet.
+	Items []struct {
+		VariantID uuid.UUID `json:"variant_id"`
+		Quantity  int       `json:"quantity"`
+	} `json:"items"`
+}
+
+// handleAdminCreateShipment records a shipment of some or all of an order's
+// items; the order moves to partially_shipped or shipped.
+func (s *Server) handleAdminCreateShipment(w http.ResponseWriter, r *http.Request) {
+	oid, err := uuid.Parse(chi.URLParam(r, "orderID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid order_id")
+		return
+	}
+	var req adminCreateShipmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	in := store.ShipmentInput{
+		Carrier:        strings.TrimSpace(req.Carrier),
+		TrackingNumber: strings.TrimSpace(req.TrackingNumber),
+		Note:           strings.TrimSpace(req.Note),
+		ShippedAt:      time.Now(),
+	}
+	if in.Carrier == "" {
+		writeError(w, http.StatusBadRequest, "carrier is required")
+		return
+	}
+	if req.ShippedAt != nil {
+		if req.ShippedAt.After(time.Now()) {
+			writeError(w, http.StatusBadRequest, "shipped_at cannot be in the future")
+			return
+		}
+		in.ShippedAt = *req.ShippedAt
+	}
+	for _, it := range req.Items {
+		in.Items = append(in.Items, store.ShipmentItem{VariantID: it.VariantID, Quantity: it.Quantity})
+	}
+
+	p, _ := auth.PrincipalFrom(r.Context())
+	sh, err := s.store.AdminCreateShipment(r.Context(), oid, in, store.AdminActor(p.UserID))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(w, http.StatusNotFound, "order not found")
+		case errors.Is(err, store.ErrNotShippable), errors.Is(err, store.ErrTrackingNumberTaken):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, store.ErrInvalidShipment):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to create shipment")
+		}
+		return
+	}
+	writeJSON(w, http.StatusCreated, sh)
+}
+
+type adminDeliverShipmentRequest struct {
+	DeliveredAt *time.Time `json:"delivered_at"`
+}
+
+// handleAdminDeliverShipment records a shipment's delivery; once everything
+// has been delivered the order is fulfilled.
+func (s *Server) handleAdminDeliverShipment(w http.ResponseWriter, r *http.Request) {
+	sid, err := uuid.Parse(chi.URLParam(r, "shipmentID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid shipment_id")
+		return
+	}
+	var req adminDeliverShipmentRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json body")
+			return
+		}
+	}
+	deliveredAt := time.Now()
+	if req.DeliveredAt != nil {
+		if req.DeliveredAt.After(deliveredAt) {
+			writeError(w, http.StatusBadRequest, "delivered_at cannot be in the future")
+			return
+		}
+		deliveredAt = *req.DeliveredAt
+	}
+
+	p, _ := auth.PrincipalFrom(r.Context())
+	sh, err := s.store.AdminMarkShipmentDelivered(r.Context(), sid, deliveredAt, store.AdminActor(p.UserID))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(w, http.StatusNotFound, "shipment not found")
+		case errors.Is(err, store.ErrInvalidShipment):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, store.ErrInvalidTransition):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to update shipment")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, sh)
+}
+
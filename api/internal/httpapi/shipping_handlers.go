@@ -0,0 +1,155 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/gst"
+	"clothes-shop/api/internal/store"
+)
+
+func (s *Server) handleAdminListShippingZones(w http.ResponseWriter, r *http.Request) {
+	zones, err := s.store.AdminListShippingZones(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list shipping zones")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"zones": zones})
+}
+
+type adminShippingZoneRequest struct {
+	Name            string               `json:"name"`
+	PincodePrefixes []string             `json:"pincode_prefixes"`
+	States          []string             `json:"states"`
+	Serviceable     *bool                `json:"serviceable"`
+	FreeAboveINR    *int                 `json:"free_above_inr"`
+	CODSurchargeINR int                  `json:"cod_surcharge_inr"`
+	Active          *bool                `json:"active"`
+	Rates           []store.ShippingRate `json:"rates"`
+}
+
+// shippingZoneInput validates an admin shipping zone request, returning a
+// message for the client when it is invalid.
+func (req adminShippingZoneRequest) shippingZoneInput() (store.ShippingZoneInput, string) {
+	in := store.ShippingZoneInput{
+		Name:            strings.TrimSpace(req.Name),
+		Serviceable:     req.Serviceable == nil || *req.Serviceable,
+		FreeAboveINR:    req.FreeAboveINR,
+		CODSurchargeINR: req.CODSurchargeINR,
+		Active:          req.Active == nil || *req.Active,
+		Rates:           req.Rates,
+	}
+	if in.Name == "" {
+		return in, "name is required"
+	}
+	for _, p := range req.PincodePrefixes {
+		p = strings.TrimSpace(p)
+		if p == "" || len(p) > 6 || strings.Trim(p, "0123456789") != "" {
+			return in, "pincode_prefixes must be 1 to 6 digits"
+		}
+		in.PincodePrefixes = append(in.PincodePrefixes, p)
+	}
+	for _, name := range req.States {
+		st, ok := gst.LookupState(name)
+		if !ok {
+			return in, "unknown state " + name
+		}
+		in.States = append(in.States, st.Code)
+	}
+	if len(in.PincodePrefixes) == 0 && len(in.States) == 0 {
+		return in, "pincode_prefixes or states are required"
+	}
+	if in.FreeAboveINR != nil && *in.FreeAboveINR < 0 {
+		return in, "free_above_inr cannot be negative"
+	}
+	if in.CODSurchargeINR < 0 {
+		return in, "cod_surcharge_inr cannot be negative"
+	}
+	if in.Serviceable && len(in.Rates) == 0 {
+		return in, "a serviceable zone needs at least one rate"
+	}
+	seen := map[int]bool{}
+	for _, rt := range in.Rates {
+		if rt.RateINR < 0 || (rt.MaxWeightGrams != nil && *rt.MaxWeightGrams <= 0) {
+			return in, "rates need a positive max_weight_grams (or none) and a rate_inr of 0 or more"
+		}
+		w := 0
+		if rt.MaxWeightGrams != nil {
+			w = *rt.MaxWeightGrams
+		}
+		if seen[w] {
+			return in, "rates must have distinct max_weight_grams"
+		}
+		seen[w] = true
+	}
+	return in, ""
+}
+
+func (s *Server) handleAdminCreateShippingZone(w http.ResponseWriter, r *http.Request) {
+	var req adminShippingZoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	in, msg := req.shippingZoneInput()
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	id, err := s.store.AdminCreateShippingZone(r.Context(), in)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"id": id})
+}
+
+func (s *Server) handleAdminUpdateShippingZone(w http.ResponseWriter, r *http.Request) {
+	zid, err := uuid.Parse(chi.URLParam(r, "zoneID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid zone_id")
+		return
+	}
+	var req adminShippingZoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	in, msg := req.shippingZoneInput()
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if err := s.store.AdminUpdateShippingZone(r.Context(), zid, in); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "shipping zone not found")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
+func (s *Server) handleAdminDeleteShippingZone(w http.ResponseWriter, r *http.Request) {
+	zid, err := uuid.Parse(chi.URLParam(r, "zoneID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid zone_id")
+		return
+	}
+	if err := s.store.AdminDeleteShippingZone(r.Context(), zid); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "shipping zone not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to delete shipping zone")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/store"
+)
+
+func (s *Server) handleAdminListWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status := q.Get("status")
+	switch status {
+	case "", store.WebhookPending, store.WebhookProcessed, store.WebhookFailed:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	page, err := s.store.AdminListWebhookEvents(r.Context(), status, limit, q.Get("cursor"))
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to list webhook events")
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) handleAdminReplayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "eventID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid event_id")
+		return
+	}
+	if err := s.store.ReplayWebhookEvent(r.Context(), id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "webhook event not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to replay webhook event")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
+
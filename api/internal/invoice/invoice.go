@@ -0,0 +1,316 @@
+package invoice
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"clothes-shop/api/internal/gst"
+	"clothes-shop/api/internal/store"
+)
+
+// Seller is the supplier printed on invoices.
+type Seller struct {
+	Name    string
+	GSTIN   string
+	Address string // may span lines
+	State   gst.State
+}
+
+const (
+	margin     = 40.0
+	right      = pageWidth - margin
+	bodySize   = 8.5
+	lineHeight = 12.0
+	// bottom is the lowest baseline for table rows before a page break.
+	bottom = 90.0
+)
+
+// table columns: left edge for text, right edge for amounts.
+const (
+	colNo      = margin
+	colDesc    = margin + 16
+	colHSN     = 196.0
+	colQty     = 268.0
+	colTaxable = 330.0
+	colRate    = 365.0
+	colCGST    = 415.0
+	colSGST    = 465.0
+	colIGST    = 510.0
+	colTotal   = right
+	descWidth  = colHSN - colDesc - 4
+)
+
+// Render lays out the GST tax invoice for an order as a PDF: supplier and
+// recipient details, place of supply, and per line the HSN code, taxable
+// value, rate and CGST/SGST (UTGST) or IGST.
+func Render(seller Seller, inv store.Invoice, o store.OrderDetail) ([]byte, error) {
+	if len(o.Tax.Lines) == 0 {
+		return nil, fmt.Errorf("order %s has no lines", o.ID)
+	}
+	pos, ok := gst.LookupState(o.Tax.PlaceOfSupply)
+	if !ok {
+		return nil, fmt.Errorf("order %s has no place of supply", o.ID)
+	}
+	sgstLabel := "SGST"
+	if seller.State.UTGST {
+		sgstLabel = "UTGST"
+	}
+
+	p := newPDF()
+	y := pageHeight - 50
+	p.text(margin, y, 16, true, "TAX INVOICE")
+	p.textRight(right, y, bodySize, false, "Original for recipient")
+	y -= 28
+
+	// Supplier on the left, invoice details on the right.
+	top := y
+	p.text(margin, y, 11, true, seller.Name)
+	y -= lineHeight + 2
+	for _, l := range strings.Split(seller.Address, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			p.text(margin, y, bodySize, false, l)
+			y -= lineHeight
+		}
+	}
+	p.text(margin, y, bodySize, false, "State: "+stateLabel(seller.State))
+	y -= lineHeight
+	p.text(margin, y, bodySize, true, "GSTIN: "+seller.GSTIN)
+	y -= lineHeight
+
+	ry := top
+	for _, kv := range [][2]string{
+		{"Invoice No.", inv.Number},
+		{"Invoice Date", inv.IssuedAt.In(ist).Format("02-01-2006")},
+		{"Order", o.ID.String()},
+		{"Order Date", o.CreatedAt.In(ist).Format("02-01-2006")},
+		{"Place of Supply", stateLabel(pos)},
+		{"Reverse Charge", "No"},
+	} {
+		p.text(300, ry, bodySize, true, kv[0])
+		p.textRight(right, ry, bodySize, false, kv[1])
+		ry -= lineHeight
+	}
+	y = min(y, ry) - 10
+	p.line(margin, y, right, y, 0.5)
+	y -= 16
+
+	// Recipient. Goods are billed and shipped to the same address.
+	p.text(margin, y, bodySize, true, "Bill to / Ship to")
+	y -= lineHeight + 2
+	p.text(margin, y, bodySize+1, true, o.CustomerName)
+	y -= lineHeight
+	for _, l := range addressLines(o.ShippingAddr) {
+		p.text(margin, y, bodySize, false, l)
+		y -= lineHeight
+	}
+	p.text(margin, y, bodySize, false, "State: "+stateLabel(pos))
+	y -= lineHeight
+	if o.CustomerPhone != "" {
+		p.text(margin, y, bodySize, false, "Phone: "+o.CustomerPhone)
+		y -= lineHeight
+	}
+	y -= 8
+
+	header := func() {
+		p.line(margin, y+lineHeight, right, y+lineHeight, 0.5)
+		p.text(colNo, y, bodySize, true, "#")
+		p.text(colDesc, y, bodySize, true, "Description")
+		p.text(colHSN, y, bodySize, true, "HSN")
+		p.textRight(colQty, y, bodySize, true, "Qty")
+		p.textRight(colTaxable, y, bodySize, true, "Taxable")
+		p.textRight(colRate, y, bodySize, true, "Rate")
+		p.textRight(colCGST, y, bodySize, true, "CGST")
+		p.textRight(colSGST, y, bodySize, true, sgstLabel)
+		p.textRight(colIGST, y, bodySize, true, "IGST")
+		p.textRight(colTotal, y, bodySize, true, "Amount")
+		p.line(margin, y-5, right, y-5, 0.5)
+		y -= lineHeight + 6
+	}
+	header()
+
+	var sum store.TaxLine
+	rows := o.Tax.Lines
+	if o.Tax.Shipping.TaxableINR > 0 {
+		rows = append(rows[:len(rows):len(rows)], o.Tax.Shipping)
+	}
+	for i, l := range rows {
+		if y < bottom {
+			p.addPage()
+			y = pageHeight - 50
+			p.text(margin, y, bodySize, false, fmt.Sprintf("Invoice %s (continued)", inv.Number))
+			y -= 2 * lineHeight
+			header()
+		}
+		p.text(colNo, y, bodySize, false, fmt.Sprint(i+1))
+		p.text(colDesc, y, bodySize, false, fitText(l.Description, descWidth, bodySize, false))
+		p.text(colHSN, y, bodySize, false, l.HSNCode)
+		p.textRight(colQty, y, bodySize, false, fmt.Sprint(l.Quantity))
+		p.textRight(colTaxable, y, bodySize, false, amount(l.TaxableINR))
+		p.textRight(colRate, y, bodySize, false, rate(l.RateBps))
+		p.textRight(colCGST, y, bodySize, false, amount(l.CGSTINR))
+		p.textRight(colSGST, y, bodySize, false, amount(l.SGSTINR))
+		p.textRight(colIGST, y, bodySize, false, amount(l.IGSTINR))
+		p.textRight(colTotal, y, bodySize, false, amount(l.TaxableINR+l.CGSTINR+l.SGSTINR+l.IGSTINR))
+		y -= lineHeight
+
+		sum.TaxableINR += l.TaxableINR
+		sum.CGSTINR += l.CGSTINR
+		sum.SGSTINR += l.SGSTINR
+		sum.IGSTINR += l.IGSTINR
+	}
+	p.line(margin, y+lineHeight-4, right, y+lineHeight-4, 0.5)
+	y -= 2
+	p.text(colDesc, y, bodySize, true, "Total")
+	p.textRight(colTaxable, y, bodySize, true, amount(sum.TaxableINR))
+	p.textRight(colCGST, y, bodySize, true, amount(sum.CGSTINR))
+	p.textRight(colSGST, y, bodySize, true, amount(sum.SGSTINR))
+	p.textRight(colIGST, y, bodySize, true, amount(sum.IGSTINR))
+	p.textRight(colTotal, y, bodySize, true, amount(sum.TaxableINR+sum.CGSTINR+sum.SGSTINR+sum.IGSTINR))
+	y -= 2 * lineHeight
+
+	// Summary and signature need about 200pt.
+	if y < 230 {
+		p.addPage()
+		y = pageHeight - 50
+	}
+	summary := [][2]string{
+		{"Gross value", amount(o.SubtotalINR)},
+	}
+	if o.DiscountINR > 0 {
+		summary = append(summary, [2]string{"Discount", "-" + amount(o.DiscountINR)})
+	}
+	if o.ShippingINR > 0 {
+		summary = append(summary, [2]string{"Shipping", amount(o.ShippingINR)})
+	}
+	summary = append(summary, [2]string{"Taxable value", amount(sum.TaxableINR)})
+	if sum.IGSTINR > 0 {
+		summary = append(summary, [2]string{"IGST", amount(sum.IGSTINR)})
+	} else {
+		summary = append(summary,
+			[2]string{"CGST", amount(sum.CGSTINR)},
+			[2]string{sgstLabel, amount(sum.SGSTINR)})
+	}
+	for _, kv := range summary {
+		p.text(380, y, bodySize, false, kv[0])
+		p.textRight(right, y, bodySize, false, kv[1])
+		y -= lineHeight
+	}
+	p.line(380, y+lineHeight-4, right, y+lineHeight-4, 0.5)
+	y -= 4
+	p.text(380, y, 10, true, "Invoice total")
+	p.textRight(right, y, 10, true, "Rs. "+amount(o.TotalINR))
+	y -= 2 * lineHeight
+	p.text(margin, y, bodySize, true, "Amount in words:")
+	p.text(margin+75, y, bodySize, false, fitText(inWords(o.TotalINR), right-margin-75, bodySize, false))
+	y -= 3 * lineHeight
+
+	p.textRight(right, y, bodySize, true, "For "+seller.Name)
+	y -= 3 * lineHeight
+	p.textRight(right, y, bodySize, false, "Authorised Signatory")
+
+	p.line(margin, 60, right, 60, 0.5)
+	p.text(margin, 48, 7.5, false, "This is a computer-generated invoice. Tax is not payable on reverse charge.")
+	return p.bytes(), nil
+}
+
+// ist is Indian Standard Time, in which invoice dates are printed.
+var ist = time.FixedZone("IST", 5*3600+1800)
+
+func stateLabel(s gst.State) string {
+	return fmt.Sprintf("%s (%s)", s.Name, s.GSTCode)
+}
+
+// addressLines formats the street, city and pincode of a shipping address.
+func addressLines(addr store.Address) []string {
+	var out []string
+	for _, l := range []string{addr.Line1, addr.Line2} {
+		if l != "" {
+			out = append(out, l)
+		}
+	}
+	city := addr.City
+	if addr.Pincode != "" {
+		if city != "" {
+			city += " - "
+		}
+		city += addr.Pincode
+	}
+	if city != "" {
+		out = append(out, city)
+	}
+	return out
+}
+
+// amount formats paise as rupees with Indian digit grouping, e.g. 12345678
+// as "1,23,456.78".
+func amount(paise int) string {
+	sign := ""
+	if paise < 0 {
+		sign, paise = "-", -paise
+	}
+	rupees := fmt.Sprint(paise / 100)
+	if len(rupees) > 3 {
+		head, tail := rupees[:len(rupees)-3], rupees[len(rupees)-3:]
+		var groups []string
+		for len(head) > 2 {
+			groups = append([]string{head[len(head)-2:]}, groups...)
+			head = head[:len(head)-2]
+		}
+		groups = append([]string{head}, groups...)
+		rupees = strings.Join(groups, ",") + "," + tail
+	}
+	return fmt.Sprintf("%s%s.%02d", sign, rupees, paise%100)
+}
+
+// rate formats basis points as a percentage, e.g. 250 as "2.5%".
+func rate(bps int) string {
+	s := fmt.Sprintf("%d.%02d", bps/100, bps%100)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return s + "%"
+}
+
+var (
+	ones = []string{"", "One", "Two", "Three", "Four", "Five", "Six", "Seven", "Eight", "Nine", "Ten",
+		"Eleven", "Twelve", "Thirteen", "Fourteen", "Fifteen", "Sixteen", "Seventeen", "Eighteen", "Nineteen"}
+	tens = []string{"", "", "Twenty", "Thirty", "Forty", "Fifty", "Sixty", "Seventy", "Eighty", "Ninety"}
+)
+
+// inWords spells out an amount in paise the Indian way, e.g. 150050 as
+// "Rupees One Thousand Five Hundred and Fifty Paise Only".
+func inWords(paise int) string {
+	rupees := paise / 100
+	s := "Rupees " + numberWords(rupees)
+	if paise%100 > 0 {
+		s += " and " + numberWords(paise%100) + " Paise"
+	}
+	return s + " Only"
+}
+
+func numberWords(n int) string {
+	if n == 0 {
+		return "Zero"
+	}
+	var parts []string
+	for _, u := range []struct {
+		size int
+		name string
+	}{{10000000, "Crore"}, {100000, "Lakh"}, {1000, "Thousand"}, {100, "Hundred"}} {
+		if n >= u.size {
+			parts = append(parts, numberWords(n/u.size)+" "+u.name)
+			n %= u.size
+		}
+	}
+	switch {
+	case n >= 20:
+		w := tens[n/10]
+		if n%10 > 0 {
+			w += " " + ones[n%10]
+		}
+		parts = append(parts, w)
+	case n > 0:
+		parts = append(parts, ones[n])
+	}
+	return strings.Join(parts, " ")
+}
+
@@ -0,0 +1,43 @@
+package invoice
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/store"
+)
+
+// Issuer issues invoices for one seller and makes the signed links customers
+// download them with.
+type Issuer struct {
+	store   *store.Store
+	seller  Seller
+	links   *auth.LinkSigner
+	baseURL string
+	linkTTL time.Duration
+}
+
+// NewIssuer returns an issuer whose customer links point at apiURL (the
+// public API base URL) and stay valid for linkTTL.
+func NewIssuer(st *store.Store, seller Seller, links *auth.LinkSigner, apiURL string, linkTTL time.Duration) *Issuer {
+	return &Issuer{store: st, seller: seller, links: links, baseURL: strings.TrimRight(apiURL, "/"), linkTTL: linkTTL}
+}
+
+// Issue issues the invoice for a paid order, or returns the one it already has.
+func (i *Issuer) Issue(ctx context.Context, orderID uuid.UUID) (store.Invoice, error) {
+	return i.store.IssueInvoice(ctx, orderID, i.seller.GSTIN, func(inv store.Invoice, o store.OrderDetail) ([]byte, error) {
+		return Render(i.seller, inv, o)
+	})
+}
+
+// Link returns a customer download link for an order's invoice.
+func (i *Issuer) Link(orderID uuid.UUID) string {
+	token := i.links.Sign(auth.LinkInvoice, orderID.String(), time.Now().Add(i.linkTTL))
+	return i.baseURL + "/v1/invoices/" + url.PathEscape(token)
+}
+
@@ -0,0 +1,86 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/notify"
+	"clothes-shop/api/internal/store"
+)
+
+// cartBatchSize caps how many carts one run abandons or notifies.
+const cartBatchSize = 100
+
+// RunCartRecovery marks carts idle for idleAfter as abandoned and sends each
+// abandoned cart with contact details one reminder, with a recovery link to
+// storefrontURL valid for linkTTL, every interval until ctx is done.
+func RunCartRecovery(ctx context.Context, st *store.Store, n notify.Notifier, links *auth.LinkSigner, storefrontURL string, idleAfter, linkTTL, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := recoverCarts(ctx, st, n, links, storefrontURL, idleAfter, linkTTL); err != nil && ctx.Err() == nil {
+			log.Printf("cart recovery: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func recoverCarts(ctx context.Context, st *store.Store, n notify.Notifier, links *auth.LinkSigner, storefrontURL string, idleAfter, linkTTL time.Duration) error {
+	abandoned, err := st.AbandonIdleCarts(ctx, idleAfter, cartBatchSize)
+	if err != nil {
+		return err
+	}
+	if abandoned > 0 {
+		log.Printf("cart recovery: marked %d carts abandoned", abandoned)
+	}
+
+	carts, err := st.ListCartsDueForRecovery(ctx, cartBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, c := range carts {
+		token := links.Sign(auth.LinkCartRecovery, c.ID.String(), time.Now().Add(linkTTL))
+		link := strings.TrimRight(storefrontURL, "/") + "/cart?recover=" + url.QueryEscape(token)
+		if err := n.Notify(ctx, cartRecoveryMessage(c, link)); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("cart recovery: cart %s: %v", c.ID, err)
+			continue
+		}
+		if err := st.MarkCartRecoverySent(ctx, c.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cartRecoveryMessage(c store.AbandonedCart, link string) notify.Message {
+	greeting := "Hi"
+	if c.Contact.Name != "" {
+		greeting = "Hi " + c.Contact.Name
+	}
+	items := "1 item"
+	if c.ItemCount != 1 {
+		items = fmt.Sprintf("%d items", c.ItemCount)
+	}
+	return notify.Message{
+		Kind:    "cart_recovery",
+		ToName:  c.Contact.Name,
+		ToPhone: c.Contact.Phone,
+		ToEmail: c.Contact.Email,
+		Subject: "You left something in your cart",
+		Body: fmt.Sprintf("%s, you left %s (₹%d.%02d) in your cart. Pick up where you left off: %s",
+			greeting, items, c.SubtotalINR/100, c.SubtotalINR%100, link),
+	}
+}
+
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"clothes-shop/api/internal/store"
+)
+
+// RunIdempotencyKeyPurge deletes stored Idempotency-Key responses once they are
+// older than ttl, every interval until ctx is done.
+func RunIdempotencyKeyPurge(ctx context.Context, st *store.Store, ttl, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		n, err := st.PurgeIdempotencyKeys(ctx, ttl)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("idempotency key purge: %v", err)
+		}
+		if n > 0 {
+			log.Printf("idempotency key purge: deleted %d keys", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
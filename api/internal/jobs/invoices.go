@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"clothes-shop/api/internal/invoice"
+	"clothes-shop/api/internal/notify"
+	"clothes-shop/api/internal/store"
+)
+
+// invoiceBatchSize caps how many invoices one run issues or sends.
+const invoiceBatchSize = 50
+
+// RunInvoicing issues invoices for paid orders, in the order they were placed,
+// and sends each customer a link to theirs, every interval until ctx is done.
+func RunInvoicing(ctx context.Context, st *store.Store, issuer *invoice.Issuer, n notify.Notifier, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := issueInvoices(ctx, st, issuer, n); err != nil && ctx.Err() == nil {
+			log.Printf("invoicing: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func issueInvoices(ctx context.Context, st *store.Store, issuer *invoice.Issuer, n notify.Notifier) error {
+	due, err := st.ListOrdersDueForInvoice(ctx, invoiceBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, orderID := range due {
+		if _, err := issuer.Issue(ctx, orderID); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("invoicing: order %s: %v", orderID, err)
+		}
+	}
+
+	notices, err := st.ListInvoicesDueForNotice(ctx, invoiceBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, inv := range notices {
+		if err := n.Notify(ctx, invoiceMessage(inv, issuer.Link(inv.OrderID))); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("invoicing: invoice %s: %v", inv.Number, err)
+			continue
+		}
+		if err := st.MarkInvoiceNotified(ctx, inv.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func invoiceMessage(inv store.InvoiceNotice, link string) notify.Message {
+	greeting := "Hi"
+	if inv.CustomerName != "" {
+		greeting = "Hi " + inv.CustomerName
+	}
+	return notify.Message{
+		Kind:    "invoice",
+		ToName:  inv.CustomerName,
+		ToPhone: inv.CustomerPhone,
+		ToEmail: inv.CustomerEmail,
+		Subject: "Your invoice " + inv.Number,
+		Body: fmt.Sprintf("%s, thank you for your order. Your tax invoice %s for ₹%d.%02d is ready: %s",
+			greeting, inv.Number, inv.TotalINR/100, inv.TotalINR%100, link),
+	}
+}
+
@@ -0,0 +1,197 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"clothes-shop/api/internal/razorpay"
+	"clothes-shop/api/internal/store"
+)
+
+// reconcileBatchSize caps how many payments one run looks up at Razorpay.
+const reconcileBatchSize = 50
+
+// RunPaymentReconciliation periodically asks Razorpay about payments that have
+// stayed created or authorized for staleAfter, in case both the Checkout
+// callback and the webhook were lost, and about recently failed payments,
+// which Razorpay may still capture. Local state converges through the same
+// capture/fail paths the webhook uses; anything that cannot be applied safely
+// is written to the reconciliation report for an admin instead. Refunds left
+// pending for staleAfter are settled the same way.
+func RunPaymentReconciliation(ctx context.Context, st *store.Store, rzc *razorpay.Client, staleAfter, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := reconcilePayments(ctx, st, rzc, staleAfter); err != nil && ctx.Err() == nil {
+			log.Printf("payment reconciliation: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func reconcilePayments(ctx context.Context, st *store.Store, rzc *razorpay.Client, staleAfter time.Duration) error {
+	payments, err := st.ListUnsettledPayments(ctx, staleAfter, reconcileBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, p := range payments {
+		if err := reconcilePayment(ctx, st, rzc, p); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("payment reconciliation: payment %s: %v", p.ID, err)
+			continue
+		}
+		if err := st.MarkPaymentReconciled(ctx, p.ID); err != nil {
+			return err
+		}
+	}
+
+	refunds, err := st.ListPendingRefunds(ctx, staleAfter, reconcileBatchSize)
+	if err != nil {
+		return err
+	}
+	for _, rf := range refunds {
+		if err := reconcileRefund(ctx, st, rzc, rf); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("payment reconciliation: refund %s: %v", rf.ID, err)
+			continue
+		}
+		if err := st.MarkRefundReconciled(ctx, rf.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileRefund settles a refund whose outcome never arrived, e.g. because
+// the refund request timed out and no webhook followed. A refund Razorpay has
+// no record of was never made; it is marked failed so it can be issued again.
+func reconcileRefund(ctx context.Context, st *store.Store, rzc *razorpay.Client, rf store.Refund) error {
+	remote, err := rzc.FetchPaymentRefunds(ctx, rf.RazorpayPaymentID)
+	if err != nil {
+		return err
+	}
+	for _, rr := range remote {
+		if rr.Receipt != rf.ID.String() && (rf.RazorpayRefundID == nil || rr.ID != *rf.RazorpayRefundID) {
+			continue
+		}
+		settled := store.ProviderRefund{ID: rr.ID, PaymentID: rr.PaymentID, Receipt: rf.ID.String(), AmountINR: rr.Amount}
+		switch rr.Status {
+		case "processed":
+			return st.MarkRefundProcessed(ctx, settled, store.Actor{Source: store.ActorSourceReconciliation})
+		case "failed":
+			return st.MarkRefundFailed(ctx, settled, "refund failed at razorpay")
+		}
+		return nil
+	}
+	return st.MarkRefundFailed(ctx, store.ProviderRefund{Receipt: rf.ID.String()}, "refund not found at razorpay")
+}
+
+func reconcilePayment(ctx context.Context, st *store.Store, rzc *razorpay.Client, p store.UnsettledPayment) error {
+	remote, err := rzc.FetchOrderPayments(ctx, p.RazorpayOrderID)
+	if errors.Is(err, razorpay.ErrNotFound) {
+		return st.RecordReconciliationIssue(ctx, store.ReconciliationIssue{
+			PaymentID:         p.ID,
+			Kind:              store.IssueOrderNotFound,
+			ExpectedAmountINR: p.AmountINR,
+			Detail:            "razorpay order " + p.RazorpayOrderID + " does not exist",
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	var captured, authorized []razorpay.Payment
+	failed := 0
+	for _, rp := range remote {
+		switch rp.Status {
+		case "captured", "refunded":
+			captured = append(captured, rp)
+		case "authorized":
+			authorized = append(authorized, rp)
+		case "failed":
+			failed++
+		}
+	}
+
+	actor := store.Actor{Source: store.ActorSourceReconciliation}
+	switch {
+	case len(captured) > 0:
+		settle := captured[0]
+		for _, rp := range captured {
+			if rp.ID == p.RazorpayPaymentID {
+				settle = rp
+			}
+		}
+		// Further captures against the same order are money we have no
+		// order for; an admin has to refund them.
+		for _, rp := range captured {
+			if rp.ID == settle.ID {
+				continue
+			}
+			if err := st.RecordReconciliationIssue(ctx, store.ReconciliationIssue{
+				PaymentID:         p.ID,
+				Kind:              store.IssueUnknownPayment,
+				RazorpayPaymentID: rp.ID,
+				ActualAmountINR:   rp.Amount,
+				Currency:          rp.Currency,
+				Detail:            "additional " + rp.Status + " payment for razorpay order " + p.RazorpayOrderID,
+			}); err != nil {
+				return err
+			}
+		}
+		// A mismatched capture still settles the payment; the order is held
+		// in payment_mismatch and the report records why.
+		if settle.Amount != p.AmountINR || !strings.EqualFold(settle.Currency, p.Currency) {
+			if err := st.RecordReconciliationIssue(ctx, store.ReconciliationIssue{
+				PaymentID:         p.ID,
+				Kind:              store.IssueAmountMismatch,
+				RazorpayPaymentID: settle.ID,
+				ExpectedAmountINR: p.AmountINR,
+				ActualAmountINR:   settle.Amount,
+				Currency:          settle.Currency,
+				Detail:            fmt.Sprintf("captured %d %s, expected %d %s", settle.Amount, settle.Currency, p.AmountINR, p.Currency),
+			}); err != nil {
+				return err
+			}
+		}
+		err = st.MarkPaymentCaptured(ctx, p.RazorpayOrderID, settle.ID, settle.Amount, settle.Currency, actor)
+		return recordRejected(ctx, st, p, settle.ID, err)
+	case len(authorized) > 0:
+		err = st.MarkPaymentAuthorized(ctx, p.RazorpayOrderID, authorized[0].ID, "", actor)
+		return recordRejected(ctx, st, p, authorized[0].ID, err)
+	case failed > 0 && failed == len(remote):
+		last := remote[0]
+		err = st.MarkPaymentFailed(ctx, p.RazorpayOrderID, last.ID, actor)
+		return recordRejected(ctx, st, p, last.ID, err)
+	}
+	return nil
+}
+
+// recordRejected reports a change the state machine refused, e.g. an
+// authorization of a payment that already failed here; other errors are
+// returned.
+func recordRejected(ctx context.Context, st *store.Store, p store.UnsettledPayment, razorpayPaymentID string, err error) error {
+	if !errors.Is(err, store.ErrInvalidTransition) {
+		return err
+	}
+	return st.RecordReconciliationIssue(ctx, store.ReconciliationIssue{
+		PaymentID:         p.ID,
+		Kind:              store.IssueTransitionRejected,
+		RazorpayPaymentID: razorpayPaymentID,
+		ExpectedAmountINR: p.AmountINR,
+		Detail:            err.Error(),
+	})
+}
+
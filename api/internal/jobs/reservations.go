@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"clothes-shop/api/internal/razorpay"
+	"clothes-shop/api/internal/store"
+)
+
+// expireBatchSize caps how many orders one sweep cancels, so a large backlog is
+// worked off over several ticks instead of one long run.
+const expireBatchSize = 100
+
+// RunReservationExpiry cancels abandoned pending_payment orders every interval
+// until ctx is done, releasing the stock they reserved: those whose payment is
+// still created ttl after checkout, and those whose payment is still
+// authorized after the longer authorizedTTL. With a Razorpay client, each
+// payment is first reconciled with Razorpay, so one that went through without
+// its callback and webhook arriving is captured instead of failed.
+func RunReservationExpiry(ctx context.Context, st *store.Store, rzc *razorpay.Client, ttl, authorizedTTL, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		n, err := expireReservations(ctx, st, rzc, ttl, authorizedTTL)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("reservation expiry: %v", err)
+		}
+		if n > 0 {
+			log.Printf("reservation expiry: cancelled %d pending orders", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func expireReservations(ctx context.Context, st *store.Store, rzc *razorpay.Client, ttl, authorizedTTL time.Duration) (int, error) {
+	payments, err := st.ListExpiringPayments(ctx, ttl, authorizedTTL, expireBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, p := range payments {
+		if rzc != nil && p.RazorpayOrderID != "" {
+			// Leave the order for the next sweep when Razorpay cannot be asked.
+			if err := reconcilePayment(ctx, st, rzc, p); err != nil {
+				if ctx.Err() != nil {
+					return expired, ctx.Err()
+				}
+				log.Printf("reservation expiry: payment %s: %v", p.ID, err)
+				continue
+			}
+			if err := st.MarkPaymentReconciled(ctx, p.ID); err != nil {
+				return expired, err
+			}
+		}
+		ok, err := st.ExpirePendingOrder(ctx, p.ID, ttl, authorizedTTL)
+		if err != nil {
+			return expired, err
+		}
+		if ok {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"clothes-shop/api/internal/payments"
+	"clothes-shop/api/internal/store"
+)
+
+const (
+	// webhookLease is how long a claimed event is hidden from other workers.
+	webhookLease = 2 * time.Minute
+
+	webhookRetryBase = 30 * time.Second
+	webhookRetryMax  = time.Hour
+)
+
+// RunWebhookWorker drains the webhook inbox every interval until ctx is done.
+// A failed event is retried with exponential backoff and marked failed after
+// maxAttempts; events the state machine rejects are failed straight away since
+// retrying cannot change the outcome.
+func RunWebhookWorker(ctx context.Context, st *store.Store, providers payments.Registry, interval time.Duration, maxAttempts int) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		for ctx.Err() == nil {
+			evt, ok, err := st.ClaimWebhookEvent(ctx, webhookLease)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("webhook worker: %v", err)
+				}
+				break
+			}
+			if !ok {
+				break
+			}
+			processWebhookEvent(ctx, st, providers, evt, maxAttempts)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func processWebhookEvent(ctx context.Context, st *store.Store, providers payments.Registry, evt store.WebhookEvent, maxAttempts int) {
+	err := handleWebhookEvent(ctx, providers, evt)
+	if err == nil {
+		if err := st.MarkWebhookEventProcessed(ctx, evt.ID); err != nil {
+			log.Printf("webhook worker: event %s: %v", evt.EventID, err)
+		}
+		return
+	}
+
+	log.Printf("webhook worker: event %s (%s) attempt %d: %v", evt.EventID, evt.EventType, evt.Attempts, err)
+	if errors.Is(err, store.ErrInvalidTransition) || evt.Attempts >= maxAttempts {
+		err = st.MarkWebhookEventFailed(ctx, evt.ID, err.Error())
+	} else {
+		err = st.RetryWebhookEvent(ctx, evt.ID, err.Error(), webhookBackoff(evt.Attempts))
+	}
+	if err != nil {
+		log.Printf("webhook worker: event %s: %v", evt.EventID, err)
+	}
+}
+
+// webhookBackoff doubles the delay after every attempt, up to webhookRetryMax.
+func webhookBackoff(attempts int) time.Duration {
+	d := webhookRetryBase
+	for i := 1; i < attempts && d < webhookRetryMax; i++ {
+		d *= 2
+	}
+	return min(d, webhookRetryMax)
+}
+
+func handleWebhookEvent(ctx context.Context, providers payments.Registry, evt store.WebhookEvent) error {
+	p, ok := providers[evt.Provider]
+	if !ok {
+		return fmt.Errorf("unknown webhook provider %q", evt.Provider)
+	}
+	return p.HandleWebhook(ctx, evt.Payload)
+}
+
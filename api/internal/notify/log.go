@@ -0,0 +1,15 @@
+package notify
+
+import (
+	"context"
+	"log"
+)
+
+// Log writes notifications to the server log instead of sending them (dev).
+type Log struct{}
+
+func (Log) Notify(ctx context.Context, m Message) error {
+	log.Printf("notify %s to %q phone=%q email=%q: %s\n%s", m.Kind, m.ToName, m.ToPhone, m.ToEmail, m.Subject, m.Body)
+	return nil
+}
+
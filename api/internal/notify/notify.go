@@ -0,0 +1,20 @@
+package notify
+
+import "context"
+
+// Message is a notification to a customer. Delivery picks whichever contact
+// it supports (phone for SMS/WhatsApp, email for mail).
+type Message struct {
+	Kind    string `json:"kind"` // e.g. "cart_recovery"
+	ToName  string `json:"to_name"`
+	ToPhone string `json:"to_phone"`
+	ToEmail string `json:"to_email"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Notifier delivers customer notifications.
+type Notifier interface {
+	Notify(ctx context.Context, m Message) error
+}
+
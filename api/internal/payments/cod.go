@@ -0,0 +1,50 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+
+	"clothes-shop/api/internal/store"
+)
+
+// CashOnDelivery takes orders that checkout confirms without collecting money;
+// the courier collects it on delivery, which an admin records by fulfilling
+// the order. Refunds of collected cash are paid out by hand and recorded as
+// processed.
+type CashOnDelivery struct {
+	store *store.Store
+}
+
+func NewCashOnDelivery(st *store.Store) *CashOnDelivery {
+	return &CashOnDelivery{store: st}
+}
+
+func (p *CashOnDelivery) Name() string { return "cod" }
+
+func (p *CashOnDelivery) ConfirmsAtCheckout() bool { return true }
+
+func (p *CashOnDelivery) CreateIntent(ctx context.Context, in Intent) (any, error) {
+	return nil, nil
+}
+
+func (p *CashOnDelivery) Verify(ctx context.Context, v Verification) error {
+	return ErrNotSupported
+}
+
+func (p *CashOnDelivery) HandleWebhook(ctx context.Context, payload []byte) error {
+	return ErrNotSupported
+}
+
+// Refund is only accepted for a payment captured on delivery; there is
+// nothing to return before the cash was collected.
+func (p *CashOnDelivery) Refund(ctx context.Context, rf store.Refund) (RefundResult, error) {
+	status, err := p.store.PaymentStatus(ctx, rf.PaymentID)
+	if err != nil {
+		return RefundResult{}, fmt.Errorf("%w: %w", ErrRefundRejected, err)
+	}
+	if status != store.PaymentCaptured {
+		return RefundResult{}, fmt.Errorf("%w: cash was not collected", ErrRefundRejected)
+	}
+	return RefundResult{Processed: true}, nil
+}
+
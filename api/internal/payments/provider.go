@@ -0,0 +1,78 @@
+package payments
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/store"
+)
+
+var (
+	ErrNotSupported     = errors.New("not supported by this payment provider")
+	ErrNotConfigured    = errors.New("payment provider not configured")
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrRefundRejected is returned by Refund when no refund was made. Other
+	// errors leave the outcome unknown until the provider reports it.
+	ErrRefundRejected = errors.New("refund rejected by payment provider")
+)
+
+// Intent is a checked-out order waiting for its payment.
+type Intent struct {
+	OrderID   uuid.UUID
+	PaymentID uuid.UUID
+	AmountINR int
+	Currency  string
+	// ProviderOrderID is the provider's order created by an earlier attempt,
+	// to be reused.
+	ProviderOrderID string
+}
+
+// Verification is a payment confirmation returned to the storefront by the
+// provider's checkout, e.g. Razorpay Checkout's handler response.
+type Verification struct {
+	ProviderOrderID   string
+	ProviderPaymentID string
+	Signature         string
+}
+
+type RefundResult struct {
+	// ProviderRefundID is empty when the provider has no refund entity.
+	ProviderRefundID string
+	// Processed reports that the money has been returned; otherwise the
+	// outcome arrives later through a webhook.
+	Processed bool
+}
+
+// Provider is a way of paying for an order (Razorpay, cash on delivery),
+// selected per checkout by name; the name is stored in payments.provider.
+type Provider interface {
+	Name() string
+	// ConfirmsAtCheckout reports that orders are confirmed when checked out,
+	// with the money collected later (cash on delivery), rather than when the
+	// payment is captured.
+	ConfirmsAtCheckout() bool
+	// CreateIntent prepares a freshly checked-out order for payment and
+	// returns what the storefront needs to collect it, or nil.
+	CreateIntent(ctx context.Context, in Intent) (any, error)
+	// Verify applies a payment confirmation sent by the storefront.
+	Verify(ctx context.Context, v Verification) error
+	// HandleWebhook applies a verified webhook payload from the webhook inbox.
+	HandleWebhook(ctx context.Context, payload []byte) error
+	// Refund returns the money of a refund recorded with AdminCreateRefund.
+	// It fails with ErrRefundRejected when it certainly did not.
+	Refund(ctx context.Context, rf store.Refund) (RefundResult, error)
+}
+
+// Registry holds the enabled providers by name.
+type Registry map[string]Provider
+
+func NewRegistry(providers ...Provider) Registry {
+	r := Registry{}
+	for _, p := range providers {
+		r[p.Name()] = p
+	}
+	return r
+}
+
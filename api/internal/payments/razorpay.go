@@ -0,0 +1,127 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"clothes-shop/api/internal/razorpay"
+	"clothes-shop/api/internal/store"
+)
+
+// Razorpay collects payments online through Razorpay Checkout. Without API
+// credentials (dev) no Razorpay order is created and refunds are rejected.
+type Razorpay struct {
+	store     *store.Store
+	keyID     string
+	keySecret string
+	client    *razorpay.Client
+}
+
+func NewRazorpay(st *store.Store, keyID, keySecret string) *Razorpay {
+	p := &Razorpay{store: st, keyID: keyID, keySecret: keySecret}
+	if keyID != "" && keySecret != "" {
+		p.client = razorpay.NewClient(keyID, keySecret)
+	}
+	return p
+}
+
+func (p *Razorpay) Name() string { return "razorpay" }
+
+func (p *Razorpay) ConfirmsAtCheckout() bool { return false }
+
+// CheckoutData is what Razorpay Checkout needs to open the payment form.
+type CheckoutData struct {
+	KeyID     string `json:"key_id"`
+	OrderID   string `json:"order_id"`
+	AmountINR int    `json:"amount_inr"`
+	Currency  string `json:"currency"`
+}
+
+func (p *Razorpay) CreateIntent(ctx context.Context, in Intent) (any, error) {
+	if p.client == nil {
+		return nil, nil
+	}
+	rzOrderID := in.ProviderOrderID
+	if rzOrderID == "" {
+		var err error
+		rzOrderID, err = p.client.CreateOrder(ctx, in.AmountINR, in.Currency, in.OrderID.String())
+		if err != nil {
+			return nil, err
+		}
+		if err := p.store.SetPaymentRazorpayOrderID(ctx, in.PaymentID, rzOrderID); err != nil {
+			return nil, fmt.Errorf("persist razorpay order: %w", err)
+		}
+	}
+	return &CheckoutData{
+		KeyID:     p.keyID,
+		OrderID:   rzOrderID,
+		AmountINR: in.AmountINR,
+		Currency:  in.Currency,
+	}, nil
+}
+
+func (p *Razorpay) Verify(ctx context.Context, v Verification) error {
+	if p.keySecret == "" {
+		return ErrNotConfigured
+	}
+	if !razorpay.VerifyPaymentSignature(v.ProviderOrderID, v.ProviderPaymentID, v.Signature, p.keySecret) {
+		return ErrInvalidSignature
+	}
+	return p.store.MarkPaymentAuthorized(ctx, v.ProviderOrderID, v.ProviderPaymentID, v.Signature, store.Actor{Source: store.ActorSourceVerify})
+}
+
+func (p *Razorpay) HandleWebhook(ctx context.Context, payload []byte) error {
+	evt, err := razorpay.ParseWebhookEvent(payload)
+	if err != nil {
+		return err
+	}
+	actor := store.Actor{Source: store.ActorSourceWebhook}
+
+	switch evt.Event {
+	case "refund.processed", "refund.failed":
+		rf := evt.Payload.Refund.Entity
+		rr := store.ProviderRefund{ID: rf.ID, PaymentID: rf.PaymentID, Receipt: rf.Receipt, AmountINR: rf.Amount}
+		if evt.Event == "refund.processed" {
+			return p.store.MarkRefundProcessed(ctx, rr, actor)
+		}
+		return p.store.MarkRefundFailed(ctx, rr, "refund failed at razorpay")
+	}
+
+	pay := evt.Payload.Payment.Entity
+	orderID := pay.OrderID
+	paymentID := pay.ID
+	if orderID == "" || paymentID == "" {
+		return nil
+	}
+	switch evt.Event {
+	case "payment.authorized":
+		return p.store.MarkPaymentAuthorized(ctx, orderID, paymentID, "", actor)
+	case "payment.captured":
+		return p.store.MarkPaymentCaptured(ctx, orderID, paymentID, pay.Amount, pay.Currency, actor)
+	case "payment.failed":
+		return p.store.MarkPaymentFailed(ctx, orderID, paymentID, actor)
+	default:
+		// ignore
+		return nil
+	}
+}
+
+func (p *Razorpay) Refund(ctx context.Context, rf store.Refund) (RefundResult, error) {
+	if p.client == nil {
+		return RefundResult{}, fmt.Errorf("%w: %w", ErrRefundRejected, ErrNotConfigured)
+	}
+	if rf.RazorpayPaymentID == "" {
+		return RefundResult{}, fmt.Errorf("%w: payment has no razorpay payment id", ErrRefundRejected)
+	}
+	rz, err := p.client.CreateRefund(ctx, rf.RazorpayPaymentID, rf.AmountINR, rf.ID.String())
+	if err != nil {
+		var apiErr *razorpay.APIError
+		if errors.Is(err, razorpay.ErrNotFound) || (errors.As(err, &apiErr) && apiErr.Rejected()) {
+			return RefundResult{}, fmt.Errorf("%w: %w", ErrRefundRejected, err)
+		}
+		return RefundResult{}, err
+	}
+	return RefundResult{ProviderRefundID: rz.ID, Processed: rz.Status == "processed"}, nil
+}
+
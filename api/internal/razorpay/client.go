@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
+const apiBaseURL = "https://api.razorpay.com/v1"
+
 type Client struct {
 	keyID     string
 	keySecret string
@@ -38,35 +43,180 @@ type createOrderResponse struct {
 }
 
 func (c *Client) CreateOrder(ctx context.Context, amount int, currency string, receipt string) (string, error) {
-	body, _ := json.Marshal(createOrderRequest{
+	var out createOrderResponse
+	err := c.post(ctx, "/orders", createOrderRequest{
 		Amount:         amount,
 		Currency:       currency,
 		Receipt:        receipt,
 		PaymentCapture: 1,
-	})
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.razorpay.com/v1/orders", bytes.NewReader(body))
+	}, &out)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("razorpay create order failed: %w", err)
+	}
+	if out.ID == "" {
+		return "", fmt.Errorf("razorpay create order returned empty id")
+	}
+	return out.ID, nil
+}
+
+type createRefundRequest struct {
+	Amount  int    `json:"amount,omitempty"`
+	Receipt string `json:"receipt,omitempty"`
+}
+
+// Refund is a Razorpay refund entity. Status is pending, processed or failed.
+type Refund struct {
+	ID        string `json:"id"`
+	PaymentID string `json:"payment_id"`
+	Amount    int    `json:"amount"`
+	Currency  string `json:"currency"`
+	Receipt   string `json:"receipt"`
+	Status    string `json:"status"`
+}
+
+// CreateRefund refunds amount (in paise) of a captured payment; an amount of 0
+// refunds whatever is left of the payment. The receipt is echoed back in the
+// refund webhooks.
+func (c *Client) CreateRefund(ctx context.Context, paymentID string, amount int, receipt string) (Refund, error) {
+	var out Refund
+	err := c.post(ctx, "/payments/"+url.PathEscape(paymentID)+"/refund", createRefundRequest{
+		Amount:  amount,
+		Receipt: receipt,
+	}, &out)
+	if err != nil {
+		return Refund{}, fmt.Errorf("razorpay create refund failed: %w", err)
+	}
+	if out.ID == "" {
+		return Refund{}, fmt.Errorf("razorpay create refund returned empty id")
+	}
+	return out, nil
+}
+
+// FetchPaymentRefunds lists the refunds made of a payment.
+func (c *Client) FetchPaymentRefunds(ctx context.Context, paymentID string) ([]Refund, error) {
+	var out struct {
+		Items []Refund `json:"items"`
+	}
+	if err := c.get(ctx, "/payments/"+url.PathEscape(paymentID)+"/refunds", &out); err != nil {
+		return nil, fmt.Errorf("razorpay fetch payment refunds failed: %w", err)
+	}
+	return out.Items, nil
+}
+
+// Order is a Razorpay order entity. Status is created, attempted or paid.
+type Order struct {
+	ID         string `json:"id"`
+	Amount     int    `json:"amount"`
+	AmountPaid int    `json:"amount_paid"`
+	Currency   string `json:"currency"`
+	Receipt    string `json:"receipt"`
+	Status     string `json:"status"`
+}
+
+// Payment is a Razorpay payment entity. Status is created, authorized,
+// captured, refunded or failed.
+type Payment struct {
+	ID       string `json:"id"`
+	OrderID  string `json:"order_id"`
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+	Status   string `json:"status"`
+	Method   string `json:"method"`
+}
+
+// ErrNotFound is returned when Razorpay does not know the requested entity.
+var ErrNotFound = errors.New("razorpay: not found")
+
+func (c *Client) FetchOrder(ctx context.Context, orderID string) (Order, error) {
+	var out Order
+	if err := c.get(ctx, "/orders/"+url.PathEscape(orderID), &out); err != nil {
+		return Order{}, fmt.Errorf("razorpay fetch order failed: %w", err)
+	}
+	return out, nil
+}
+
+// FetchOrderPayments lists every payment attempt made against an order.
+func (c *Client) FetchOrderPayments(ctx context.Context, orderID string) ([]Payment, error) {
+	var out struct {
+		Items []Payment `json:"items"`
+	}
+	if err := c.get(ctx, "/orders/"+url.PathEscape(orderID)+"/payments", &out); err != nil {
+		return nil, fmt.Errorf("razorpay fetch order payments failed: %w", err)
+	}
+	return out.Items, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiBaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, out)
+}
+
+func (c *Client) post(ctx context.Context, path string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiBaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
 	}
-	req.SetBasicAuth(c.keyID, c.keySecret)
 	req.Header.Set("Content-Type", "application/json")
+	return c.do(req, out)
+}
 
+func (c *Client) do(req *http.Request, out any) error {
+	req.SetBasicAuth(c.keyID, c.keySecret)
 	res, err := c.http.Do(req)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
 	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		return "", fmt.Errorf("razorpay create order failed: status=%d", res.StatusCode)
+		return apiError(res)
 	}
-	var out createOrderResponse
-	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
-		return "", err
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// APIError is an error response of the Razorpay API.
+type APIError struct {
+	StatusCode  int
+	Code        string
+	Description string
+}
+
+func (e *APIError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("status=%d", e.StatusCode)
 	}
-	if out.ID == "" {
-		return "", fmt.Errorf("razorpay create order returned empty id")
+	return fmt.Sprintf("status=%d %s: %s", e.StatusCode, e.Code, e.Description)
+}
+
+// Rejected reports whether Razorpay refused the request. Otherwise (server
+// errors, rate limiting) it may or may not have been applied.
+func (e *APIError) Rejected() bool {
+	return e.StatusCode < 500 && e.StatusCode != http.StatusTooManyRequests
+}
+
+// apiError reads Razorpay's error description from a failed response.
+func apiError(res *http.Response) error {
+	var body struct {
+		Error struct {
+			Code        string `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
 	}
-	return out.ID, nil
+	raw, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	e := &APIError{StatusCode: res.StatusCode}
+	if json.Unmarshal(raw, &body) == nil {
+		e.Code, e.Description = body.Error.Code, body.Error.Description
+	}
+	return e
 }
 
@@ -0,0 +1,35 @@
+package razorpay
+
+import "encoding/json"
+
+// WebhookEvent is the part of a Razorpay webhook body the shop acts on.
+type WebhookEvent struct {
+	Event   string `json:"event"`
+	Payload struct {
+		Payment struct {
+			Entity struct {
+				ID       string `json:"id"`
+				OrderID  string `json:"order_id"`
+				Amount   int    `json:"amount"` // paise
+				Currency string `json:"currency"`
+				Status   string `json:"status"`
+			} `json:"entity"`
+		} `json:"payment"`
+		Refund struct {
+			Entity struct {
+				ID        string `json:"id"`
+				PaymentID string `json:"payment_id"`
+				Amount    int    `json:"amount"`
+				Receipt   string `json:"receipt"`
+				Status    string `json:"status"`
+			} `json:"entity"`
+		} `json:"refund"`
+	} `json:"payload"`
+}
+
+func ParseWebhookEvent(body []byte) (WebhookEvent, error) {
+	var evt WebhookEvent
+	err := json.Unmarshal(body, &evt)
+	return evt, err
+}
+
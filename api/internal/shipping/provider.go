@@ -0,0 +1,144 @@
+package shipping
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"clothes-shop/api/internal/gst"
+	"clothes-shop/api/internal/store"
+)
+
+// ErrNotFound is returned when the courier does not know the requested
+// shipment.
+var ErrNotFound = errors.New("shipping: not found")
+
+// Address is where a shipment is delivered.
+type Address struct {
+	Name    string
+	Line1   string
+	Line2   string
+	City    string
+	State   string // state or union territory name
+	Pincode string
+	Phone   string
+	Email   string
+}
+
+type Item struct {
+	SKU          string
+	Name         string
+	Quantity     int
+	UnitPriceINR int
+}
+
+// Request is a shipment to book with a courier.
+type Request struct {
+	// Reference identifies the shipment at the courier; the shop uses the
+	// shipment id, so every booking has its own.
+	Reference   string
+	OrderDate   time.Time
+	To          Address
+	Items       []Item
+	WeightGrams int
+	// CollectINR is collected from the customer on delivery; 0 when the
+	// order is prepaid.
+	CollectINR int
+	// ValueINR is the declared value of the goods.
+	ValueINR int
+}
+
+// Booking is a shipment booked with a courier.
+type Booking struct {
+	ProviderOrderID    string
+	ProviderShipmentID string
+	Carrier            string // the courier assigned to it
+	TrackingNumber     string // AWB
+}
+
+// Provider books shipments with a courier aggregator. Its name is stored in
+// shipments.provider.
+type Provider interface {
+	Name() string
+	// CreateShipment books a shipment and assigns it an AWB.
+	CreateShipment(ctx context.Context, req Request) (Booking, error)
+	// Label returns the shipping label PDF of a booking.
+	Label(ctx context.Context, b Booking) ([]byte, error)
+	// Track returns the latest tracking status of an AWB.
+	Track(ctx context.Context, trackingNumber string) (store.TrackingUpdate, error)
+	// Cancel cancels a booking that has not been delivered.
+	Cancel(ctx context.Context, b Booking) error
+}
+
+// BookingOf returns the booking a shipment was created from.
+func BookingOf(sh store.Shipment) Booking {
+	return Booking{
+		ProviderOrderID:    sh.ProviderOrderID,
+		ProviderShipmentID: sh.ProviderShipmentID,
+		Carrier:            sh.Carrier,
+		TrackingNumber:     sh.TrackingNumber,
+	}
+}
+
+// RequestFromOrder builds the booking of shipment ref for lines of order o, as
+// returned by AdminGetOrder. Cash on delivery orders collect their total, so
+// they must ship in one shipment.
+func RequestFromOrder(ref uuid.UUID, o store.OrderDetail, lines []store.ShipmentLine) (Request, error) {
+	a := o.ShippingAddr
+	req := Request{
+		Reference: ref.String(),
+		OrderDate: o.CreatedAt,
+		To: Address{
+			Name:    a.Name,
+			Line1:   a.Line1,
+			Line2:   a.Line2,
+			City:    a.City,
+			Pincode: a.Pincode,
+			Phone:   a.Phone,
+			Email:   o.CustomerEmail,
+		},
+	}
+	// Addresses of orders placed before they were typed may lack the name
+	// and phone, and give the state by name.
+	if req.To.Name == "" {
+		req.To.Name = o.CustomerName
+	}
+	if req.To.Phone == "" {
+		req.To.Phone = o.CustomerPhone
+	}
+	if st, ok := gst.LookupState(a.State); ok {
+		req.To.State = st.Name
+	}
+	if req.To.Line1 == "" || req.To.City == "" || req.To.State == "" || req.To.Pincode == "" {
+		return Request{}, errors.New("the order's shipping address is incomplete")
+	}
+
+	for _, l := range lines {
+		req.Items = append(req.Items, Item{SKU: l.SKU, Name: l.Name, Quantity: l.Quantity, UnitPriceINR: l.UnitPriceINR})
+		req.WeightGrams += l.WeightGrams * l.Quantity
+		req.ValueINR += l.UnitPriceINR * l.Quantity
+	}
+	if req.WeightGrams <= 0 {
+		return Request{}, errors.New("set weight_grams on the order's variants before booking")
+	}
+
+	if o.PaymentProvider == "cod" {
+		for _, f := range o.Fulfillment {
+			planned := 0
+			for _, l := range lines {
+				if l.VariantID == f.VariantID {
+					planned = l.Quantity
+				}
+			}
+			if f.ShippedQuantity > 0 || planned != f.Quantity {
+				return Request{}, errors.New("cash on delivery orders are booked in one shipment of every item")
+			}
+		}
+		req.CollectINR = o.TotalINR
+		req.ValueINR = o.TotalINR
+	}
+	return req, nil
+}
+
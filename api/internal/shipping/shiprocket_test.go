@@ -0,0 +1,243 @@
+package shipping
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"clothes-shop/api/internal/store"
+)
+
+const testWebhookToken = "test-webhook-token"
+
+// webhook is a tracking webhook the stub sent.
+type webhook struct {
+	APIKey string
+	Body   []byte
+}
+
+// newStubServer starts the Shiprocket stub and a receiver for its tracking
+// webhooks, and returns a Shiprocket client of the stub.
+func newStubServer(t *testing.T) (*Shiprocket, *httptest.Server, <-chan webhook) {
+	t.Helper()
+	hooks := make(chan webhook, 8)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		hooks <- webhook{APIKey: r.Header.Get("x-api-key"), Body: body}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(receiver.Close)
+	srv := httptest.NewServer(NewStub(receiver.URL, testWebhookToken).Handler())
+	t.Cleanup(srv.Close)
+	return NewShiprocket(srv.URL, "ops@example.com", "secret", "Primary"), srv, hooks
+}
+
+func testRequest(ref string) Request {
+	return Request{
+		Reference: ref,
+		OrderDate: time.Date(2026, 3, 1, 10, 30, 0, 0, time.UTC),
+		To: Address{
+			Name:    "Asha Rao",
+			Line1:   "12 MG Road",
+			City:    "Bengaluru",
+			State:   "Karnataka",
+			Pincode: "560001",
+			Phone:   "+919876543210",
+		},
+		Items:       []Item{{SKU: "TEE-M-BLK", Name: "Tee - M / Black", Quantity: 2, UnitPriceINR: 79900}},
+		WeightGrams: 400,
+		ValueINR:    159800,
+	}
+}
+
+// setStatus moves a shipment along through the stub's control endpoint.
+func setStatus(t *testing.T, srv *httptest.Server, awb, status string) {
+	t.Helper()
+	res, err := http.Post(srv.URL+"/stub/awb/"+awb+"/status", "application/json", strings.NewReader(`{"status":"`+status+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("set status %s: status %d", status, res.StatusCode)
+	}
+}
+
+func receive(t *testing.T, hooks <-chan webhook) webhook {
+	t.Helper()
+	select {
+	case h := <-hooks:
+		return h
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook received")
+		return webhook{}
+	}
+}
+
+func TestShiprocketBookLabelTrackDeliver(t *testing.T) {
+	ctx := context.Background()
+	c, srv, hooks := newStubServer(t)
+
+	b, err := c.CreateShipment(ctx, testRequest("shipment-1"))
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+	if b.ProviderOrderID == "" || b.ProviderShipmentID == "" {
+		t.Fatalf("booking has no ids: %+v", b)
+	}
+	if !strings.HasPrefix(b.TrackingNumber, "STUB") || b.Carrier != "Stub Express" {
+		t.Fatalf("booking = %+v, want a STUB AWB with Stub Express", b)
+	}
+
+	pdf, err := c.Label(ctx, b)
+	if err != nil {
+		t.Fatalf("Label: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) || !bytes.Contains(pdf, []byte(b.TrackingNumber)) {
+		t.Fatalf("label is not a PDF naming the AWB")
+	}
+
+	tr, err := c.Track(ctx, b.TrackingNumber)
+	if err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	if tr.Status != store.TrackingBooked || tr.Detail != "AWB ASSIGNED" {
+		t.Fatalf("Track = %+v, want booked (AWB ASSIGNED)", tr)
+	}
+
+	setStatus(t, srv, b.TrackingNumber, "delivered")
+	h := receive(t, hooks)
+	if h.APIKey != testWebhookToken {
+		t.Fatalf("webhook x-api-key = %q, want %q", h.APIKey, testWebhookToken)
+	}
+	awb, upd, err := ParseShiprocketWebhook(h.Body)
+	if err != nil {
+		t.Fatalf("ParseShiprocketWebhook: %v", err)
+	}
+	if awb != b.TrackingNumber || upd.Status != store.TrackingDelivered || upd.Detail != "DELIVERED" {
+		t.Fatalf("webhook = %s %+v, want %s delivered", awb, upd, b.TrackingNumber)
+	}
+	if d := time.Since(upd.At); d < -time.Second || d > time.Minute {
+		t.Fatalf("webhook time %v is not now", upd.At)
+	}
+
+	tr, err = c.Track(ctx, b.TrackingNumber)
+	if err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	if tr.Status != store.TrackingDelivered || tr.At.Sub(upd.At).Abs() > time.Second {
+		t.Fatalf("Track = %+v, want delivered at %v", tr, upd.At)
+	}
+
+	if err := c.Cancel(ctx, b); err == nil {
+		t.Fatal("Cancel of a delivered shipment succeeded")
+	}
+}
+
+func TestShiprocketCancel(t *testing.T) {
+	ctx := context.Background()
+	c, _, _ := newStubServer(t)
+
+	b, err := c.CreateShipment(ctx, testRequest("shipment-2"))
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+	if _, err := c.CreateShipment(ctx, testRequest("shipment-2")); err == nil {
+		t.Fatal("second booking of the same reference succeeded")
+	}
+	if err := c.Cancel(ctx, b); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	tr, err := c.Track(ctx, b.TrackingNumber)
+	if err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	if tr.Status != store.TrackingCancelled {
+		t.Fatalf("Track = %+v, want cancelled", tr)
+	}
+	// A cancelled booking frees its reference.
+	if _, err := c.CreateShipment(ctx, testRequest("shipment-2")); err != nil {
+		t.Fatalf("rebooking after cancel: %v", err)
+	}
+}
+
+func TestShiprocketReturnedWebhook(t *testing.T) {
+	ctx := context.Background()
+	c, srv, hooks := newStubServer(t)
+
+	b, err := c.CreateShipment(ctx, testRequest("shipment-3"))
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+	setStatus(t, srv, b.TrackingNumber, "RTO INITIATED")
+	_, upd, err := ParseShiprocketWebhook(receive(t, hooks).Body)
+	if err != nil {
+		t.Fatalf("ParseShiprocketWebhook: %v", err)
+	}
+	if upd.Status != store.TrackingReturned {
+		t.Fatalf("webhook status = %s, want returned", upd.Status)
+	}
+}
+
+func TestShiprocketLogin(t *testing.T) {
+	ctx := context.Background()
+	c, srv, _ := newStubServer(t)
+
+	// An expired token is replaced after the stub rejects it.
+	c.token, c.tokenExp = "expired", time.Now().Add(time.Hour)
+	if _, err := c.CreateShipment(ctx, testRequest("shipment-4")); err != nil {
+		t.Fatalf("CreateShipment with an expired token: %v", err)
+	}
+	if c.token != stubToken {
+		t.Fatalf("token = %q, want the stub's", c.token)
+	}
+
+	bad := NewShiprocket(srv.URL, "", "", "Primary")
+	_, err := bad.CreateShipment(ctx, testRequest("shipment-5"))
+	if err == nil || !strings.Contains(err.Error(), "login failed") {
+		t.Fatalf("CreateShipment without credentials: err = %v, want a login failure", err)
+	}
+}
+
+func TestShiprocketRejectsInvalidBooking(t *testing.T) {
+	c, _, _ := newStubServer(t)
+	req := testRequest("shipment-6")
+	req.To.Pincode = "5600"
+	_, err := c.CreateShipment(context.Background(), req)
+	if err == nil || !strings.Contains(err.Error(), "billing_pincode") {
+		t.Fatalf("CreateShipment with a bad pincode: err = %v", err)
+	}
+}
+
+func TestShiprocketTrackUnknownAWB(t *testing.T) {
+	c, _, _ := newStubServer(t)
+	if _, err := c.Track(context.Background(), "NOPE"); err == nil {
+		t.Fatal("Track of an unknown AWB succeeded")
+	}
+}
+
+func TestParseShiprocketWebhook(t *testing.T) {
+	body, _ := json.Marshal(map[string]any{
+		"awb":               "SR123",
+		"current_status":    "OUT FOR DELIVERY",
+		"current_timestamp": "01 03 2026 14:05:00",
+	})
+	awb, upd, err := ParseShiprocketWebhook(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2026, 3, 1, 14, 5, 0, 0, ist)
+	if awb != "SR123" || upd.Status != store.TrackingOutForDelivery || !upd.At.Equal(want) {
+		t.Fatalf("got %s %+v, want SR123 out_for_delivery at %v", awb, upd, want)
+	}
+	if _, _, err := ParseShiprocketWebhook([]byte(`{"awb":"SR123"}`)); err == nil {
+		t.Fatal("webhook without a status was accepted")
+	}
+}
+
@@ -0,0 +1,377 @@
+package shipping
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stub is an in-memory stand-in for the parts of the Shiprocket API the shop
+// uses, for development and local testing without a Shiprocket account. Any
+// email and password log in. Every shipment goes with "Stub Express" and
+// labels are one-page PDFs.
+//
+// Besides the API, POST /stub/awb/{awb}/status with {"status": "DELIVERED"}
+// (any Shiprocket status) moves a shipment along and sends the tracking
+// webhook to the configured URL, as Shiprocket would.
+type Stub struct {
+	webhookURL   string
+	webhookToken string
+	http         *http.Client
+
+	mu     sync.Mutex
+	nextID int
+	orders map[string]*stubOrder // by Shiprocket order id
+}
+
+type stubOrder struct {
+	OrderID     string
+	ShipmentID  string
+	Reference   string
+	AWB         string
+	Status      string
+	UpdatedAt   time.Time
+	DeliveredAt time.Time
+}
+
+const stubToken = "stub-token"
+
+// NewStub returns a stub that sends tracking webhooks to webhookURL with
+// webhookToken in the x-api-key header; an empty URL sends none.
+func NewStub(webhookURL, webhookToken string) *Stub {
+	return &Stub{
+		webhookURL:   webhookURL,
+		webhookToken: webhookToken,
+		http:         &http.Client{Timeout: 10 * time.Second},
+		nextID:       100000,
+		orders:       map[string]*stubOrder{},
+	}
+}
+
+func (s *Stub) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/external/auth/login", s.login)
+	mux.HandleFunc("POST /v1/external/orders/create/adhoc", s.authed(s.createOrder))
+	mux.HandleFunc("POST /v1/external/courier/assign/awb", s.authed(s.assignAWB))
+	mux.HandleFunc("POST /v1/external/courier/generate/label", s.authed(s.generateLabel))
+	mux.HandleFunc("GET /v1/external/courier/track/awb/{awb}", s.authed(s.track))
+	mux.HandleFunc("POST /v1/external/orders/cancel", s.authed(s.cancel))
+	mux.HandleFunc("GET /labels/{shipmentID}", s.label)
+	mux.HandleFunc("POST /stub/awb/{awb}/status", s.setStatus)
+	return mux
+}
+
+func (s *Stub) authed(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+stubToken {
+			stubJSON(w, http.StatusUnauthorized, map[string]any{"message": "Token has expired"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Stub) login(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" || req.Password == "" {
+		stubJSON(w, http.StatusBadRequest, map[string]any{"message": "email and password are required"})
+		return
+	}
+	stubJSON(w, http.StatusOK, map[string]any{"token": stubToken, "email": req.Email})
+}
+
+func (s *Stub) createOrder(w http.ResponseWriter, r *http.Request) {
+	var req shiprocketCreateOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		stubJSON(w, http.StatusBadRequest, map[string]any{"message": "invalid json"})
+		return
+	}
+	var missing []string
+	for name, v := range map[string]string{
+		"order_id": req.OrderID, "pickup_location": req.PickupLocation, "billing_customer_name": req.BillingName,
+		"billing_address": req.BillingAddress, "billing_city": req.BillingCity, "billing_state": req.BillingState,
+		"billing_phone": req.BillingPhone,
+	} {
+		if strings.TrimSpace(v) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if _, err := strconv.Atoi(req.BillingPincode); err != nil || len(req.BillingPincode) != 6 {
+		missing = append(missing, "billing_pincode")
+	}
+	if len(req.OrderItems) == 0 || req.Weight <= 0 {
+		missing = append(missing, "order_items or weight")
+	}
+	if len(missing) > 0 {
+		stubJSON(w, http.StatusUnprocessableEntity, map[string]any{"message": "invalid fields: " + strings.Join(missing, ", ")})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range s.orders {
+		if o.Reference == req.OrderID && o.Status != "CANCELED" {
+			stubJSON(w, http.StatusUnprocessableEntity, map[string]any{"message": "order id already exists"})
+			return
+		}
+	}
+	s.nextID++
+	o := &stubOrder{
+		OrderID:    strconv.Itoa(s.nextID),
+		ShipmentID: strconv.Itoa(s.nextID + 500000),
+		Reference:  req.OrderID,
+		Status:     "NEW",
+		UpdatedAt:  time.Now(),
+	}
+	s.orders[o.OrderID] = o
+	stubJSON(w, http.StatusOK, map[string]any{"order_id": s.nextID, "shipment_id": s.nextID + 500000, "status": o.Status, "status_code": 1})
+}
+
+func (s *Stub) byShipment(id string) *stubOrder {
+	for _, o := range s.orders {
+		if o.ShipmentID == id {
+			return o
+		}
+	}
+	return nil
+}
+
+func (s *Stub) byAWB(awb string) *stubOrder {
+	for _, o := range s.orders {
+		if o.AWB == awb {
+			return o
+		}
+	}
+	return nil
+}
+
+func (s *Stub) assignAWB(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ShipmentID json.Number `json:"shipment_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		stubJSON(w, http.StatusBadRequest, map[string]any{"message": "invalid json"})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.byShipment(req.ShipmentID.String())
+	if o == nil || o.Status == "CANCELED" {
+		stubJSON(w, http.StatusNotFound, map[string]any{"message": "shipment not found"})
+		return
+	}
+	if o.AWB == "" {
+		o.AWB = "STUB" + o.OrderID
+		o.Status, o.UpdatedAt = "AWB ASSIGNED", time.Now()
+	}
+	stubJSON(w, http.StatusOK, map[string]any{
+		"awb_assign_status": 1,
+		"response": map[string]any{"data": map[string]any{
+			"awb_code": o.AWB, "courier_name": "Stub Express", "shipment_id": o.ShipmentID,
+		}},
+	})
+}
+
+func (s *Stub) generateLabel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ShipmentID []json.Number `json:"shipment_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.ShipmentID) != 1 {
+		stubJSON(w, http.StatusBadRequest, map[string]any{"message": "one shipment_id is required"})
+		return
+	}
+	s.mu.Lock()
+	o := s.byShipment(req.ShipmentID[0].String())
+	s.mu.Unlock()
+	if o == nil || o.AWB == "" {
+		stubJSON(w, http.StatusOK, map[string]any{"label_created": 0, "not_created": req.ShipmentID})
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	stubJSON(w, http.StatusOK, map[string]any{
+		"label_created": 1,
+		"label_url":     scheme + "://" + r.Host + "/labels/" + o.ShipmentID,
+	})
+}
+
+func (s *Stub) label(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	o := s.byShipment(r.PathValue("shipmentID"))
+	var lines []string
+	if o != nil {
+		lines = []string{"Stub Express", "AWB " + o.AWB, "Shipment " + o.ShipmentID, "Ref " + o.Reference}
+	}
+	s.mu.Unlock()
+	if o == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	_, _ = w.Write(stubLabelPDF(lines))
+}
+
+func (s *Stub) track(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.byAWB(r.PathValue("awb"))
+	if o == nil {
+		stubJSON(w, http.StatusOK, map[string]any{"tracking_data": map[string]any{
+			"track_status": 0, "error": "Aahh! There is no activities found in our DB. Please have some patience it will be updated soon.",
+		}})
+		return
+	}
+	delivered := ""
+	if !o.DeliveredAt.IsZero() {
+		delivered = o.DeliveredAt.In(ist).Format("2006-01-02 15:04:05")
+	}
+	stubJSON(w, http.StatusOK, map[string]any{"tracking_data": map[string]any{
+		"track_status": 1,
+		"shipment_track": []map[string]any{{
+			"awb_code": o.AWB, "current_status": o.Status, "delivered_date": delivered,
+		}},
+		"shipment_track_activities": []map[string]any{{
+			"date": o.UpdatedAt.In(ist).Format("2006-01-02 15:04:05"), "status": o.Status, "sr-status-label": o.Status,
+		}},
+	}})
+}
+
+func (s *Stub) cancel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []json.Number `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		stubJSON(w, http.StatusBadRequest, map[string]any{"message": "ids are required"})
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range req.IDs {
+		o := s.orders[id.String()]
+		if o == nil {
+			stubJSON(w, http.StatusNotFound, map[string]any{"message": "order " + id.String() + " not found"})
+			return
+		}
+		if o.Status == "DELIVERED" {
+			stubJSON(w, http.StatusBadRequest, map[string]any{"message": "delivered orders cannot be cancelled"})
+			return
+		}
+	}
+	for _, id := range req.IDs {
+		o := s.orders[id.String()]
+		o.Status, o.UpdatedAt = "CANCELED", time.Now()
+	}
+	stubJSON(w, http.StatusOK, map[string]any{"status_code": 200, "message": "Order cancelled successfully."})
+}
+
+// setStatus moves a shipment to a new status and sends its tracking webhook.
+func (s *Stub) setStatus(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Status) == "" {
+		stubJSON(w, http.StatusBadRequest, map[string]any{"message": "status is required"})
+		return
+	}
+	s.mu.Lock()
+	o := s.byAWB(r.PathValue("awb"))
+	if o == nil {
+		s.mu.Unlock()
+		stubJSON(w, http.StatusNotFound, map[string]any{"message": "awb not found"})
+		return
+	}
+	o.Status, o.UpdatedAt = strings.ToUpper(strings.TrimSpace(req.Status)), time.Now()
+	if o.Status == "DELIVERED" {
+		o.DeliveredAt = o.UpdatedAt
+	}
+	payload := map[string]any{
+		"awb":               o.AWB,
+		"courier_name":      "Stub Express",
+		"current_status":    o.Status,
+		"shipment_status":   o.Status,
+		"current_timestamp": o.UpdatedAt.In(ist).Format("02 01 2006 15:04:05"),
+		"order_id":          o.Reference,
+		"sr_order_id":       o.OrderID,
+		"is_return":         0,
+	}
+	s.mu.Unlock()
+
+	if s.webhookURL == "" {
+		stubJSON(w, http.StatusOK, map[string]any{"webhook": "not configured", "payload": payload})
+		return
+	}
+	status, err := s.sendWebhook(r, payload)
+	if err != nil {
+		log.Printf("shipping stub: webhook for %s: %v", o.AWB, err)
+		stubJSON(w, http.StatusBadGateway, map[string]any{"message": err.Error()})
+		return
+	}
+	stubJSON(w, http.StatusOK, map[string]any{"webhook_status": status, "payload": payload})
+}
+
+func (s *Stub) sendWebhook(r *http.Request, payload map[string]any) (int, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, s.webhookURL, bytes.NewReader(raw))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", s.webhookToken)
+	res, err := s.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+func stubJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// stubLabelPDF returns a 4x6 inch PDF printing lines of ASCII text.
+func stubLabelPDF(lines []string) []byte {
+	var content bytes.Buffer
+	for i, l := range lines {
+		l = strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(l)
+		fmt.Fprintf(&content, "BT /F1 14 Tf 24 %d Td (%s) Tj ET\n", 380-24*i, l)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 288 432] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, o := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
@@ -0,0 +1,9 @@
+package sms
+
+import "context"
+
+// Sender delivers text messages to phone numbers.
+type Sender interface {
+	Send(ctx context.Context, phone, text string) error
+}
+
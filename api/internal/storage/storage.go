@@ -0,0 +1,17 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage stores uploaded media (product images) and returns public URLs for it.
+// Keys are slash-separated relative paths such as "products/<id>/<file>.jpg".
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (url string, err error)
+	Delete(ctx context.Context, key string) error
+}
+
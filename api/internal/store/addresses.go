@@ -0,0 +1,212 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"clothes-shop/api/internal/auth"
+	"clothes-shop/api/internal/gst"
+)
+
+var (
+	// ErrInvalidAddress is returned for addresses that fail validation; the
+	// wrapped message names the field.
+	ErrInvalidAddress  = errors.New("invalid address")
+	ErrAddressBookFull = fmt.Errorf("at most %d addresses can be saved", maxSavedAddresses)
+)
+
+const maxSavedAddresses = 20
+
+// Address is a delivery address in India. Orders keep a copy of theirs in
+// shipping_address; customers can save addresses in their address book.
+type Address struct {
+	Name    string `json:"name"`
+	Line1   string `json:"line1"`
+	Line2   string `json:"line2"`
+	City    string `json:"city"`
+	State   string `json:"state"`   // two-letter code, e.g. "KA"; input may also be a name
+	Pincode string `json:"pincode"` // 6 digits
+	Phone   string `json:"phone"`   // +91 and the 10-digit mobile number
+}
+
+// Normalize trims an address, resolves its state to its code and its phone
+// to +91 form, and checks that every field but line2 is set. Invalid
+// addresses fail with ErrInvalidAddress.
+func (a Address) Normalize() (Address, error) {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Line1 = strings.TrimSpace(a.Line1)
+	a.Line2 = strings.TrimSpace(a.Line2)
+	a.City = strings.TrimSpace(a.City)
+	a.Pincode = strings.ReplaceAll(strings.TrimSpace(a.Pincode), " ", "")
+	switch {
+	case a.Name == "":
+		return Address{}, fmt.Errorf("%w: name is required", ErrInvalidAddress)
+	case a.Line1 == "":
+		return Address{}, fmt.Errorf("%w: line1 is required", ErrInvalidAddress)
+	case a.City == "":
+		return Address{}, fmt.Errorf("%w: city is required", ErrInvalidAddress)
+	}
+	st, ok := gst.LookupState(a.State)
+	if !ok {
+		return Address{}, fmt.Errorf("%w: state must be an Indian state or union territory", ErrInvalidAddress)
+	}
+	a.State = st.Code
+	if !validPincode(a.Pincode) {
+		return Address{}, fmt.Errorf("%w: pincode must be 6 digits", ErrInvalidAddress)
+	}
+	phone, ok := auth.NormalizePhone(a.Phone)
+	if !ok {
+		return Address{}, fmt.Errorf("%w: phone must be an Indian mobile number", ErrInvalidAddress)
+	}
+	a.Phone = phone
+	return a, nil
+}
+
+// validPincode reports whether s is an Indian PIN code: six digits, the
+// first not zero.
+func validPincode(s string) bool {
+	if len(s) != 6 || s[0] == '0' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// SavedAddress is an address in a customer's address book.
+type SavedAddress struct {
+	ID    uuid.UUID `json:"id"`
+	Label string    `json:"label"` // e.g. "Home"; may be empty
+	Address
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const savedAddressColumns = `id, label, name, line1, line2, city, state, pincode, phone, created_at, updated_at`
+
+func scanSavedAddress(row pgx.Row) (SavedAddress, error) {
+	var a SavedAddress
+	err := row.Scan(&a.ID, &a.Label, &a.Name, &a.Line1, &a.Line2, &a.City, &a.State, &a.Pincode, &a.Phone, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
+}
+
+// ListCustomerAddresses returns a customer's address book, oldest first.
+func (s *Store) ListCustomerAddresses(ctx context.Context, customerID uuid.UUID) ([]SavedAddress, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT `+savedAddressColumns+`
+FROM customer_addresses
+WHERE user_id=$1
+ORDER BY created_at, id
+`, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []SavedAddress{}
+	for rows.Next() {
+		a, err := scanSavedAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// GetCustomerAddress returns an address of a customer's address book;
+// other customers' addresses are ErrNotFound.
+func (s *Store) GetCustomerAddress(ctx context.Context, customerID, addressID uuid.UUID) (SavedAddress, error) {
+	a, err := scanSavedAddress(s.db.QueryRow(ctx, `
+SELECT `+savedAddressColumns+`
+FROM customer_addresses
+WHERE id=$1 AND user_id=$2
+`, addressID, customerID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return SavedAddress{}, ErrNotFound
+	}
+	return a, err
+}
+
+// CreateCustomerAddress validates an address and saves it in a customer's
+// address book, which holds at most maxSavedAddresses (ErrAddressBookFull).
+func (s *Store) CreateCustomerAddress(ctx context.Context, customerID uuid.UUID, label string, addr Address) (SavedAddress, error) {
+	addr, err := addr.Normalize()
+	if err != nil {
+		return SavedAddress{}, err
+	}
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return SavedAddress{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the customer so concurrent saves cannot overfill the book.
+	var n int
+	err = tx.QueryRow(ctx, `
+SELECT (SELECT count(*) FROM customer_addresses WHERE user_id = u.id)
+FROM users u
+WHERE u.id=$1
+FOR UPDATE
+`, customerID).Scan(&n)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return SavedAddress{}, ErrNotFound
+		}
+		return SavedAddress{}, err
+	}
+	if n >= maxSavedAddresses {
+		return SavedAddress{}, ErrAddressBookFull
+	}
+	a, err := scanSavedAddress(tx.QueryRow(ctx, `
+INSERT INTO customer_addresses (user_id, label, name, line1, line2, city, state, pincode, phone)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING `+savedAddressColumns,
+		customerID, strings.TrimSpace(label), addr.Name, addr.Line1, addr.Line2, addr.City, addr.State, addr.Pincode, addr.Phone))
+	if err != nil {
+		return SavedAddress{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return SavedAddress{}, err
+	}
+	return a, nil
+}
+
+// UpdateCustomerAddress replaces an address of a customer's address book.
+// Orders placed with it keep their copy.
+func (s *Store) UpdateCustomerAddress(ctx context.Context, customerID, addressID uuid.UUID, label string, addr Address) (SavedAddress, error) {
+	addr, err := addr.Normalize()
+	if err != nil {
+		return SavedAddress{}, err
+	}
+	a, err := scanSavedAddress(s.db.QueryRow(ctx, `
+UPDATE customer_addresses
+SET label=$3, name=$4, line1=$5, line2=$6, city=$7, state=$8, pincode=$9, phone=$10, updated_at=now()
+WHERE id=$1 AND user_id=$2
+RETURNING `+savedAddressColumns,
+		addressID, customerID, strings.TrimSpace(label), addr.Name, addr.Line1, addr.Line2, addr.City, addr.State, addr.Pincode, addr.Phone))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return SavedAddress{}, ErrNotFound
+	}
+	return a, err
+}
+
+func (s *Store) DeleteCustomerAddress(ctx context.Context, customerID, addressID uuid.UUID) error {
+	ct, err := s.db.Exec(ctx, `DELETE FROM customer_addresses WHERE id=$1 AND user_id=$2`, addressID, customerID)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
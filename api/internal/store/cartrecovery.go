@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// CartContact is what a customer typed into the checkout form, kept on the
+// cart so an abandoned cart can be followed up.
+type CartContact struct {
+	Name  string
+	Phone string
+	Email string
+}
+
+// SetCartContact stores the checkout contact details on an open cart.
+func (s *Store) SetCartContact(ctx context.Context, cartID uuid.UUID, c CartContact) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockOpenCart(ctx, tx, cartID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+UPDATE carts
+SET contact_name=$2, contact_phone=$3, contact_email=$4, updated_at=now()
+WHERE id=$1
+`, cartID, c.Name, c.Phone, c.Email)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// AbandonIdleCarts marks up to limit open carts with contact details that have
+// not changed for idleFor as abandoned and returns how many. Carts without a
+// contact have no one to remind and stay open.
+func (s *Store) AbandonIdleCarts(ctx context.Context, idleFor time.Duration, limit int) (int, error) {
+	ct, err := s.db.Exec(ctx, `
+UPDATE carts
+SET status='abandoned', abandoned_at=now()
+WHERE id IN (
+  SELECT id FROM carts
+  WHERE status = 'open'
+    AND (contact_phone <> '' OR contact_email <> '')
+    AND updated_at < now() - make_interval(secs => $1)
+  ORDER BY updated_at ASC
+  LIMIT $2
+  FOR UPDATE SKIP LOCKED
+)
+`, idleFor.Seconds(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return int(ct.RowsAffected()), nil
+}
+
+// AbandonedCart is an abandoned cart with items and a contact to remind.
+type AbandonedCart struct {
+	ID          uuid.UUID
+	Contact     CartContact
+	ItemCount   int
+	SubtotalINR int
+	AbandonedAt time.Time
+}
+
+// ListCartsDueForRecovery returns abandoned carts that have items and contact
+// details but no recovery notification yet, oldest first.
+func (s *Store) ListCartsDueForRecovery(ctx context.Context, limit int) ([]AbandonedCart, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT c.id, c.contact_name, c.contact_phone, c.contact_email, c.abandoned_at,
+       SUM(ci.quantity), SUM(ci.quantity * v.price_inr)
+FROM carts c
+JOIN cart_items ci ON ci.cart_id = c.id
+JOIN product_variants v ON v.id = ci.variant_id
+WHERE c.status = 'abandoned'
+  AND c.recovery_sent_at IS NULL
+  AND (c.contact_phone <> '' OR c.contact_email <> '')
+GROUP BY c.id
+ORDER BY c.abandoned_at ASC
+LIMIT $1
+`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []AbandonedCart{}
+	for rows.Next() {
+		var c AbandonedCart
+		if err := rows.Scan(&c.ID, &c.Contact.Name, &c.Contact.Phone, &c.Contact.Email, &c.AbandonedAt, &c.ItemCount, &c.SubtotalINR); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) MarkCartRecoverySent(ctx context.Context, cartID uuid.UUID) error {
+	_, err := s.db.Exec(ctx, `UPDATE carts SET recovery_sent_at=now() WHERE id=$1`, cartID)
+	return err
+}
+
+// RecoverCart reopens an abandoned cart so it can be changed and checked out
+// again. Open carts are left as they are; checked-out carts fail with
+// ErrCartNotOpen.
+func (s *Store) RecoverCart(ctx context.Context, cartID uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT status FROM carts WHERE id=$1 FOR UPDATE`, cartID).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	switch status {
+	case "open":
+		return nil
+	case "abandoned":
+		// The reopened cart counts as fresh activity, so it is not abandoned
+		// again right away.
+		_, err = tx.Exec(ctx, `UPDATE carts SET status='open', abandoned_at=NULL, updated_at=now() WHERE id=$1`, cartID)
+		if err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	default:
+		return ErrCartNotOpen
+	}
+}
+
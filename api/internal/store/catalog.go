@@ -0,0 +1,315 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	CatalogSortNewest    = "newest"
+	CatalogSortPriceAsc  = "price_asc"
+	CatalogSortPriceDesc = "price_desc"
+)
+
+// CatalogQuery filters the public catalog. Variant-level filters (sizes, colors,
+// price range, in-stock) match a product when at least one of its variants
+// satisfies all of them; prices are in paise.
+type CatalogQuery struct {
+	CategorySlug string
+	Sizes        []string
+	Colors       []string
+	MinPriceINR  *int
+	MaxPriceINR  *int
+	InStockOnly  bool
+	Sort         string
+	Limit        int
+	Cursor       string
+}
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type CatalogFacets struct {
+	Sizes  []FacetValue `json:"sizes"`
+	Colors []FacetValue `json:"colors"`
+}
+
+type CatalogPage struct {
+	Products   []Product     `json:"products"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	Facets     CatalogFacets `json:"facets"`
+}
+
+// catalogCursor is the keyset position after the last product of a page.
+type catalogCursor struct {
+	CreatedAt time.Time `json:"c"`
+	Price     int       `json:"p,omitempty"`
+	ID        uuid.UUID `json:"id"`
+}
+
+func encodeCatalogCursor(c catalogCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCatalogCursor(s string) (catalogCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return catalogCursor{}, ErrInvalidCursor
+	}
+	var c catalogCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == uuid.Nil {
+		return catalogCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// sqlArgs collects positional query arguments.
+type sqlArgs []any
+
+func (a *sqlArgs) add(v any) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// catalogFilters returns the WHERE conditions over products p, variants v and
+// inventory i for q. The facet named by skip is left out so facet counts show
+// what selecting another value of that facet would yield.
+func catalogFilters(q CatalogQuery, args *sqlArgs, skip string) string {
+	conds := []string{"p.status = 'active'"}
+	if q.CategorySlug != "" {
+		conds = append(conds, `EXISTS (
+  SELECT 1 FROM product_categories pc
+  JOIN categories c ON c.id = pc.category_id
+  WHERE pc.product_id = p.id AND c.slug = `+args.add(q.CategorySlug)+`
+)`)
+	}
+	if len(q.Sizes) > 0 && skip != "size" {
+		conds = append(conds, "v.size = ANY("+args.add(q.Sizes)+")")
+	}
+	if len(q.Colors) > 0 && skip != "color" {
+		conds = append(conds, "v.color = ANY("+args.add(q.Colors)+")")
+	}
+	if q.MinPriceINR != nil {
+		conds = append(conds, "v.price_inr >= "+args.add(*q.MinPriceINR))
+	}
+	if q.MaxPriceINR != nil {
+		conds = append(conds, "v.price_inr <= "+args.add(*q.MaxPriceINR))
+	}
+	if q.InStockOnly {
+		conds = append(conds, "COALESCE(i.on_hand, 0) - COALESCE(i.reserved, 0) > 0")
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func (s *Store) ListCatalog(ctx context.Context, q CatalogQuery) (CatalogPage, error) {
+	if q.Limit <= 0 || q.Limit > 100 {
+		q.Limit = 24
+	}
+	if q.Sort == "" {
+		q.Sort = CatalogSortNewest
+	}
+
+	var args sqlArgs
+	where := catalogFilters(q, &args, "")
+
+	var orderBy, after string
+	var cur *catalogCursor
+	if q.Cursor != "" {
+		c, err := decodeCatalogCursor(q.Cursor)
+		if err != nil {
+			return CatalogPage{}, err
+		}
+		cur = &c
+	}
+	switch q.Sort {
+	case CatalogSortNewest:
+		orderBy = "created_at DESC, id DESC"
+		if cur != nil {
+			after = fmt.Sprintf("(created_at, id) < (%s, %s)", args.add(cur.CreatedAt), args.add(cur.ID))
+		}
+	case CatalogSortPriceAsc:
+		orderBy = "min_price ASC, id ASC"
+		if cur != nil {
+			after = fmt.Sprintf("(min_price, id) > (%s, %s)", args.add(cur.Price), args.add(cur.ID))
+		}
+	case CatalogSortPriceDesc:
+		orderBy = "min_price DESC, id DESC"
+		if cur != nil {
+			after = fmt.Sprintf("(min_price, id) < (%s, %s)", args.add(cur.Price), args.add(cur.ID))
+		}
+	default:
+		return CatalogPage{}, fmt.Errorf("unknown sort %q", q.Sort)
+	}
+	if after == "" {
+		after = "TRUE"
+	}
+
+	rows, err := s.db.Query(ctx, fmt.Sprintf(`
+WITH matched AS (
+  SELECT p.id, p.created_at, MIN(v.price_inr) AS min_price
+  FROM products p
+  JOIN product_variants v ON v.product_id = p.id
+  LEFT JOIN inventory i ON i.variant_id = v.id
+  WHERE %s
+  GROUP BY p.id, p.created_at
+)
+SELECT id, created_at, min_price
+FROM matched
+WHERE %s
+ORDER BY %s
+LIMIT %s
+`, where, after, orderBy, args.add(q.Limit+1)), args...)
+	if err != nil {
+		return CatalogPage{}, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0, q.Limit+1)
+	cursors := make([]catalogCursor, 0, q.Limit+1)
+	for rows.Next() {
+		var c catalogCursor
+		if err := rows.Scan(&c.ID, &c.CreatedAt, &c.Price); err != nil {
+			return CatalogPage{}, err
+		}
+		ids = append(ids, c.ID)
+		cursors = append(cursors, c)
+	}
+	if err := rows.Err(); err != nil {
+		return CatalogPage{}, err
+	}
+
+	var page CatalogPage
+	if len(ids) > q.Limit {
+		ids = ids[:q.Limit]
+		page.NextCursor = encodeCatalogCursor(cursors[q.Limit-1])
+	}
+
+	page.Products, err = s.loadProductsByIDs(ctx, ids)
+	if err != nil {
+		return CatalogPage{}, err
+	}
+	page.Facets.Sizes, err = s.catalogFacet(ctx, q, "size")
+	if err != nil {
+		return CatalogPage{}, err
+	}
+	page.Facets.Colors, err = s.catalogFacet(ctx, q, "color")
+	if err != nil {
+		return CatalogPage{}, err
+	}
+	return page, nil
+}
+
+// catalogFacet counts matching products per value of the size or color attribute.
+func (s *Store) catalogFacet(ctx context.Context, q CatalogQuery, facet string) ([]FacetValue, error) {
+	col := "v.size"
+	if facet == "color" {
+		col = "v.color"
+	}
+	var args sqlArgs
+	where := catalogFilters(q, &args, facet)
+	rows, err := s.db.Query(ctx, fmt.Sprintf(`
+SELECT %[1]s, COUNT(DISTINCT p.id)
+FROM products p
+JOIN product_variants v ON v.product_id = p.id
+LEFT JOIN inventory i ON i.variant_id = v.id
+WHERE %[2]s AND %[1]s <> ''
+GROUP BY %[1]s
+ORDER BY %[1]s ASC
+`, col, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []FacetValue{}
+	for rows.Next() {
+		var f FacetValue
+		if err := rows.Scan(&f.Value, &f.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// loadProductsByIDs loads products with all their variants, categories and
+// images, in the order of ids.
+func (s *Store) loadProductsByIDs(ctx context.Context, ids []uuid.UUID) ([]Product, error) {
+	if len(ids) == 0 {
+		return []Product{}, nil
+	}
+	rows, err := s.db.Query(ctx, `
+SELECT
+  p.id, p.slug, p.name, p.description, p.status, p.hsn_code, p.created_at, p.updated_at,
+  v.id, v.product_id, v.sku, v.title, v.size, v.color, v.price_inr, v.compare_at_price_inr, v.weight_grams,
+  COALESCE(i.on_hand, 0), COALESCE(i.reserved, 0)
+FROM products p
+JOIN product_variants v ON v.product_id = p.id
+LEFT JOIN inventory i ON i.variant_id = v.id
+WHERE p.id = ANY($1)
+ORDER BY v.created_at ASC
+`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := map[uuid.UUID]*Product{}
+	for rows.Next() {
+		var p Product
+		var v Variant
+		if err := rows.Scan(
+			&p.ID, &p.Slug, &p.Name, &p.Description, &p.Status, &p.HSNCode, &p.CreatedAt, &p.UpdatedAt,
+			&v.ID, &v.ProductID, &v.SKU, &v.Title, &v.Size, &v.Color, &v.PriceINR, &v.CompareAtPriceINR, &v.WeightGrams,
+			&v.OnHand, &v.Reserved,
+		); err != nil {
+			return nil, err
+		}
+		if existing := byID[p.ID]; existing != nil {
+			existing.Variants = append(existing.Variants, v)
+			continue
+		}
+		p.Variants = []Variant{v}
+		byID[p.ID] = &p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	cats, err := s.loadProductCategories(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	ptrs := make([]*Product, 0, len(ids))
+	for _, id := range ids {
+		p := byID[id]
+		if p == nil {
+			continue
+		}
+		p.Categories = cats[id]
+		if p.Categories == nil {
+			p.Categories = []Category{}
+		}
+		ptrs = append(ptrs, p)
+	}
+	if err := s.attachImages(ctx, ptrs); err != nil {
+		return nil, err
+	}
+	out := make([]Product, 0, len(ptrs))
+	for _, p := range ptrs {
+		out = append(out, *p)
+	}
+	return out, nil
+}
+
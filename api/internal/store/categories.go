@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type Category struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *Store) ListCategories(ctx context.Context) ([]Category, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT id, name, slug, created_at
+FROM categories
+ORDER BY name ASC
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Category{}
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.Slug, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) AdminCreateCategory(ctx context.Context, name, slug string) (Category, error) {
+	c := Category{Name: name, Slug: slug}
+	err := s.db.QueryRow(ctx, `
+INSERT INTO categories (name, slug)
+VALUES ($1, $2)
+RETURNING id, created_at
+`, name, slug).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		return Category{}, err
+	}
+	return c, nil
+}
+
+func (s *Store) AdminUpdateCategory(ctx context.Context, categoryID uuid.UUID, name, slug string) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	ct, err := tx.Exec(ctx, `
+UPDATE categories
+SET name=$2, slug=$3
+WHERE id=$1
+`, categoryID, name, slug)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	productIDs, err := categoryProductIDs(ctx, tx, categoryID)
+	if err != nil {
+		return err
+	}
+	if err := refreshProductSearch(ctx, tx, productIDs); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *Store) AdminDeleteCategory(ctx context.Context, categoryID uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	productIDs, err := categoryProductIDs(ctx, tx, categoryID)
+	if err != nil {
+		return err
+	}
+	ct, err := tx.Exec(ctx, `DELETE FROM categories WHERE id=$1`, categoryID)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	if err := refreshProductSearch(ctx, tx, productIDs); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func categoryProductIDs(ctx context.Context, tx pgx.Tx, categoryID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := tx.Query(ctx, `SELECT product_id FROM product_categories WHERE category_id=$1`, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+// setProductCategories replaces the category links of a product with categoryIDs.
+func setProductCategories(ctx context.Context, tx pgx.Tx, productID uuid.UUID, categoryIDs []uuid.UUID) error {
+	if categoryIDs == nil {
+		categoryIDs = []uuid.UUID{}
+	}
+	_, err := tx.Exec(ctx, `
+DELETE FROM product_categories
+WHERE product_id=$1 AND NOT (category_id = ANY($2))
+`, productID, categoryIDs)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+INSERT INTO product_categories (product_id, category_id)
+SELECT $1, unnest($2::uuid[])
+ON CONFLICT DO NOTHING
+`, productID, categoryIDs)
+	return err
+}
+
+// loadProductCategories returns the categories of each given product, keyed by product id.
+func (s *Store) loadProductCategories(ctx context.Context, productIDs []uuid.UUID) (map[uuid.UUID][]Category, error) {
+	out := map[uuid.UUID][]Category{}
+	if len(productIDs) == 0 {
+		return out, nil
+	}
+	rows, err := s.db.Query(ctx, `
+SELECT pc.product_id, c.id, c.name, c.slug, c.created_at
+FROM product_categories pc
+JOIN categories c ON c.id = pc.category_id
+WHERE pc.product_id = ANY($1)
+ORDER BY c.name ASC
+`, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pid uuid.UUID
+		var c Category
+		if err := rows.Scan(&pid, &c.ID, &c.Name, &c.Slug, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		out[pid] = append(out[pid], c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
@@ -0,0 +1,272 @@
+package store
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrOTPRateLimited  = errors.New("too many login codes requested; try again later")
+	ErrInvalidOTP      = errors.New("invalid or expired login code")
+	ErrAccountDisabled = errors.New("account is disabled")
+)
+
+// Limits on login codes, per phone number.
+const (
+	otpResendInterval = 30 * time.Second
+	otpMaxPerHour     = 5
+	otpMaxAttempts    = 5 // wrong guesses before a code stops working
+)
+
+// Customer is a customer account, identified by its verified phone number.
+type Customer struct {
+	ID        uuid.UUID `json:"id"`
+	Phone     string    `json:"phone"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreatePhoneOTP stores a login code for phone (as codeHash) that is valid
+// for ttl and replaces earlier ones. A phone gets a new code at most every
+// otpResendInterval and otpMaxPerHour an hour; beyond that it fails with
+// ErrOTPRateLimited.
+func (s *Store) CreatePhoneOTP(ctx context.Context, phone, codeHash string, ttl time.Duration) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize requests for the same phone, so the limits hold.
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('phone_otp:' || $1))`, phone); err != nil {
+		return err
+	}
+	var sent int
+	var last *time.Time
+	err = tx.QueryRow(ctx, `
+SELECT count(*), max(created_at)
+FROM phone_otps
+WHERE phone=$1 AND created_at > now() - interval '1 hour'
+`, phone).Scan(&sent, &last)
+	if err != nil {
+		return err
+	}
+	if sent >= otpMaxPerHour || (last != nil && time.Since(*last) < otpResendInterval) {
+		return ErrOTPRateLimited
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM phone_otps WHERE phone=$1 AND created_at < now() - interval '1 day'`, phone); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+INSERT INTO phone_otps (phone, code_hash, expires_at)
+VALUES ($1, $2, now() + make_interval(secs => $3))
+`, phone, codeHash, ttl.Seconds())
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// LoginCustomerWithOTP checks the latest login code of phone and returns the
+// phone's customer, signing them up with name on their first login. Guest
+// orders placed with the phone are linked to the customer once it is
+// verified; linked is how many were. A wrong code counts against the code,
+// which stops working after otpMaxAttempts; all failures are ErrInvalidOTP.
+func (s *Store) LoginCustomerWithOTP(ctx context.Context, phone, codeHash, name string) (c Customer, linked int64, err error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Customer{}, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var otpID uuid.UUID
+	var hash string
+	var attempts int
+	var expiresAt time.Time
+	var consumedAt *time.Time
+	err = tx.QueryRow(ctx, `
+SELECT id, code_hash, attempts, expires_at, consumed_at
+FROM phone_otps
+WHERE phone=$1
+ORDER BY created_at DESC
+LIMIT 1
+FOR UPDATE
+`, phone).Scan(&otpID, &hash, &attempts, &expiresAt, &consumedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Customer{}, 0, ErrInvalidOTP
+		}
+		return Customer{}, 0, err
+	}
+	if consumedAt != nil || !time.Now().Before(expiresAt) || attempts >= otpMaxAttempts {
+		return Customer{}, 0, ErrInvalidOTP
+	}
+	if !hmac.Equal([]byte(hash), []byte(codeHash)) {
+		if _, err := tx.Exec(ctx, `UPDATE phone_otps SET attempts = attempts + 1 WHERE id=$1`, otpID); err != nil {
+			return Customer{}, 0, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return Customer{}, 0, err
+		}
+		return Customer{}, 0, ErrInvalidOTP
+	}
+	if _, err := tx.Exec(ctx, `UPDATE phone_otps SET consumed_at = now() WHERE id=$1`, otpID); err != nil {
+		return Customer{}, 0, err
+	}
+
+	c, err = upsertCustomer(ctx, tx, phone, name)
+	if err != nil {
+		return Customer{}, 0, err
+	}
+	ct, err := tx.Exec(ctx, `
+UPDATE orders SET customer_user_id = $1, updated_at = now()
+WHERE customer_user_id IS NULL
+  AND right(regexp_replace(customer_phone, '\D', '', 'g'), 10) = right($2, 10)
+`, c.ID, phone)
+	if err != nil {
+		return Customer{}, 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Customer{}, 0, err
+	}
+	return c, ct.RowsAffected(), nil
+}
+
+// upsertCustomer returns the user with a verified phone, creating it with
+// the customer role when there is none.
+func upsertCustomer(ctx context.Context, tx pgx.Tx, phone, name string) (Customer, error) {
+	var id uuid.UUID
+	var active bool
+	err := tx.QueryRow(ctx, `SELECT id, is_active FROM users WHERE phone=$1 FOR UPDATE`, phone).Scan(&id, &active)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		err = tx.QueryRow(ctx, `
+INSERT INTO users (phone, name, phone_verified_at)
+VALUES ($1, $2, now())
+RETURNING id
+`, phone, name).Scan(&id)
+		if err != nil {
+			return Customer{}, err
+		}
+	case err != nil:
+		return Customer{}, err
+	case !active:
+		return Customer{}, ErrAccountDisabled
+	default:
+		// A name given at a later login only fills in a missing one.
+		_, err = tx.Exec(ctx, `
+UPDATE users SET phone_verified_at = now(), name = CASE WHEN name = '' THEN $2 ELSE name END
+WHERE id=$1
+`, id, name)
+		if err != nil {
+			return Customer{}, err
+		}
+	}
+	_, err = tx.Exec(ctx, `
+INSERT INTO user_roles (user_id, role_id)
+SELECT $1, id FROM roles WHERE key = 'customer'
+ON CONFLICT DO NOTHING
+`, id)
+	if err != nil {
+		return Customer{}, err
+	}
+	return getCustomer(ctx, tx, id)
+}
+
+func (s *Store) GetCustomer(ctx context.Context, id uuid.UUID) (Customer, error) {
+	return getCustomer(ctx, s.db, id)
+}
+
+func getCustomer(ctx context.Context, q rowQueryer, id uuid.UUID) (Customer, error) {
+	var c Customer
+	err := q.QueryRow(ctx, `
+SELECT id, phone, name, created_at
+FROM users
+WHERE id=$1 AND phone IS NOT NULL AND is_active
+`, id).Scan(&c.ID, &c.Phone, &c.Name, &c.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Customer{}, ErrNotFound
+		}
+		return Customer{}, err
+	}
+	return c, nil
+}
+
+// CustomerOrder is an order as its customer sees it in their account.
+type CustomerOrder struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	SubtotalINR int        `json:"subtotal_inr"`
+	DiscountINR int        `json:"discount_inr"`
+	ShippingINR int        `json:"shipping_inr"`
+	TaxINR      int        `json:"tax_inr"`
+	TotalINR    int        `json:"total_inr"`
+	Items       []CartItem `json:"items"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ListCustomerOrders returns a customer's orders, newest first.
+func (s *Store) ListCustomerOrders(ctx context.Context, customerID uuid.UUID, limit int) ([]CustomerOrder, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := s.db.Query(ctx, `
+SELECT id, status, subtotal_inr, discount_inr, shipping_inr, tax_inr, total_inr, created_at
+FROM orders
+WHERE customer_user_id=$1 AND status <> 'draft'
+ORDER BY created_at DESC
+LIMIT $2
+`, customerID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []CustomerOrder{}
+	index := map[uuid.UUID]int{}
+	var ids []uuid.UUID
+	for rows.Next() {
+		o := CustomerOrder{Items: []CartItem{}}
+		if err := rows.Scan(&o.ID, &o.Status, &o.SubtotalINR, &o.DiscountINR, &o.ShippingINR, &o.TaxINR, &o.TotalINR, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		index[o.ID] = len(out)
+		ids = append(ids, o.ID)
+		out = append(out, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	rows, err = s.db.Query(ctx, `
+SELECT order_id, variant_id, sku, product_name, variant_title, unit_price_inr, quantity
+FROM order_items
+WHERE order_id = ANY($1)
+ORDER BY sku
+`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var orderID uuid.UUID
+		var it CartItem
+		if err := rows.Scan(&orderID, &it.VariantID, &it.SKU, &it.Product, &it.Variant, &it.UnitPrice, &it.Quantity); err != nil {
+			return nil, err
+		}
+		it.LineTotal = it.UnitPrice * it.Quantity
+		o := &out[index[orderID]]
+		o.Items = append(o.Items, it)
+	}
+	return out, rows.Err()
+}
+
@@ -0,0 +1,477 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Discount kinds.
+const (
+	DiscountPercent = "percent"
+	DiscountFixed   = "fixed"
+)
+
+var (
+	ErrDiscountCodeTaken = errors.New("discount code already exists")
+	// ErrDiscountRejected is matched by every *DiscountError.
+	ErrDiscountRejected = errors.New("discount rejected")
+)
+
+// DiscountError explains why a discount code cannot be used on a checkout.
+// It matches ErrDiscountRejected with errors.Is.
+type DiscountError struct {
+	Code   string
+	Reason string
+}
+
+func (e *DiscountError) Error() string {
+	return fmt.Sprintf("discount code %s %s", e.Code, e.Reason)
+}
+
+func (e *DiscountError) Is(target error) bool {
+	return target == ErrDiscountRejected
+}
+
+// Discount is a coupon code, or an automatic promotion when Code is nil.
+// Value is a percentage for percent discounts and paise for fixed ones. A
+// discount limited to products or categories only reduces those lines.
+type Discount struct {
+	ID             uuid.UUID   `json:"id"`
+	Code           *string     `json:"code"`
+	Name           string      `json:"name"`
+	Kind           string      `json:"kind"`
+	Value          int         `json:"value"`
+	MaxDiscountINR *int        `json:"max_discount_inr"`
+	MinOrderINR    int         `json:"min_order_inr"`
+	UsageLimit     *int        `json:"usage_limit"`
+	PerPhoneLimit  *int        `json:"per_phone_limit"`
+	StartsAt       *time.Time  `json:"starts_at"`
+	EndsAt         *time.Time  `json:"ends_at"`
+	Active         bool        `json:"active"`
+	ProductIDs     []uuid.UUID `json:"product_ids"`
+	CategoryIDs    []uuid.UUID `json:"category_ids"`
+	// UsedCount counts orders using the discount that did not fail or get
+	// cancelled.
+	UsedCount int       `json:"used_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type DiscountInput struct {
+	Code           string // empty for an automatic promotion
+	Name           string
+	Kind           string
+	Value          int
+	MaxDiscountINR *int
+	MinOrderINR    int
+	UsageLimit     *int
+	PerPhoneLimit  *int
+	StartsAt       *time.Time
+	EndsAt         *time.Time
+	Active         bool
+	ProductIDs     []uuid.UUID
+	CategoryIDs    []uuid.UUID
+}
+
+// discountUsedSQL counts the orders using the discount whose id is the SQL
+// expression discountID, ignoring orders that never completed so their
+// redemption is given back. The admin list and the checkout limits share it
+// so they agree on how often a discount was used.
+func discountUsedSQL(discountID string) string {
+	return `
+SELECT COUNT(*)
+FROM order_discounts od
+JOIN orders o ON o.id = od.order_id
+WHERE od.discount_id = ` + discountID + ` AND o.status NOT IN ('failed','cancelled')`
+}
+
+func (s *Store) AdminListDiscounts(ctx context.Context) ([]Discount, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT d.id, d.code, d.name, d.kind, d.value, d.max_discount_inr, d.min_order_inr, d.usage_limit, d.per_phone_limit,
+       d.starts_at, d.ends_at, d.active, d.created_at, d.updated_at,
+       COALESCE(ARRAY(SELECT product_id FROM discount_products WHERE discount_id = d.id), '{}'),
+       COALESCE(ARRAY(SELECT category_id FROM discount_categories WHERE discount_id = d.id), '{}'),
+       (`+discountUsedSQL("d.id")+`)
+FROM discounts d
+ORDER BY d.created_at DESC
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Discount{}
+	for rows.Next() {
+		var d Discount
+		if err := rows.Scan(&d.ID, &d.Code, &d.Name, &d.Kind, &d.Value, &d.MaxDiscountINR, &d.MinOrderINR, &d.UsageLimit, &d.PerPhoneLimit,
+			&d.StartsAt, &d.EndsAt, &d.Active, &d.CreatedAt, &d.UpdatedAt, &d.ProductIDs, &d.CategoryIDs, &d.UsedCount); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) AdminCreateDiscount(ctx context.Context, in DiscountInput) (uuid.UUID, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id uuid.UUID
+	err = tx.QueryRow(ctx, `
+INSERT INTO discounts (code, name, kind, value, max_discount_inr, min_order_inr, usage_limit, per_phone_limit, starts_at, ends_at, active)
+VALUES (NULLIF($1, ''),$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+RETURNING id
+`, in.Code, in.Name, in.Kind, in.Value, in.MaxDiscountINR, in.MinOrderINR, in.UsageLimit, in.PerPhoneLimit,
+		in.StartsAt, in.EndsAt, in.Active).Scan(&id)
+	if err != nil {
+		return uuid.Nil, discountWriteError(err)
+	}
+	if err := setDiscountScope(ctx, tx, id, in); err != nil {
+		return uuid.Nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, err
+	}
+	return id, nil
+}
+
+// AdminUpdateDiscount replaces a discount's settings and scope. Orders that
+// already used it keep the amount they got.
+func (s *Store) AdminUpdateDiscount(ctx context.Context, discountID uuid.UUID, in DiscountInput) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	ct, err := tx.Exec(ctx, `
+UPDATE discounts
+SET code=NULLIF($2, ''), name=$3, kind=$4, value=$5, max_discount_inr=$6, min_order_inr=$7, usage_limit=$8,
+    per_phone_limit=$9, starts_at=$10, ends_at=$11, active=$12, updated_at=now()
+WHERE id=$1
+`, discountID, in.Code, in.Name, in.Kind, in.Value, in.MaxDiscountINR, in.MinOrderINR, in.UsageLimit,
+		in.PerPhoneLimit, in.StartsAt, in.EndsAt, in.Active)
+	if err != nil {
+		return discountWriteError(err)
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	if err := setDiscountScope(ctx, tx, discountID, in); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func setDiscountScope(ctx context.Context, tx pgx.Tx, discountID uuid.UUID, in DiscountInput) error {
+	productIDs, categoryIDs := in.ProductIDs, in.CategoryIDs
+	if productIDs == nil {
+		productIDs = []uuid.UUID{}
+	}
+	if categoryIDs == nil {
+		categoryIDs = []uuid.UUID{}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM discount_products WHERE discount_id=$1`, discountID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM discount_categories WHERE discount_id=$1`, discountID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+INSERT INTO discount_products (discount_id, product_id)
+SELECT $1, unnest($2::uuid[])
+ON CONFLICT DO NOTHING
+`, discountID, productIDs); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+INSERT INTO discount_categories (discount_id, category_id)
+SELECT $1, unnest($2::uuid[])
+ON CONFLICT DO NOTHING
+`, discountID, categoryIDs)
+	return err
+}
+
+func discountWriteError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrDiscountCodeTaken
+	}
+	return err
+}
+
+// AppliedDiscount is a discount taken off an order.
+type AppliedDiscount struct {
+	DiscountID uuid.UUID `json:"discount_id"`
+	Code       *string   `json:"code"`
+	Name       string    `json:"name"`
+	AmountINR  int       `json:"amount_inr"`
+}
+
+// discountLine is an order line as the discount engine sees it. Discount
+// collects the share of every applied discount on the line.
+type discountLine struct {
+	productID uuid.UUID
+	total     int
+	discount  int
+}
+
+// applyDiscounts works out the discounts for a checkout: the given code (if
+// any) and the best automatic promotion the order qualifies for. Each amount
+// is spread over the lines it applies to, in proportion to their totals, and
+// added to lines[i].discount; a line is never discounted below zero. An
+// unusable code fails with a *DiscountError, while automatic promotions that
+// do not apply are skipped. Discounts with usage limits are locked until the
+// checkout commits.
+func applyDiscounts(ctx context.Context, tx pgx.Tx, code, phone string, lines []discountLine) ([]AppliedDiscount, error) {
+	code = strings.TrimSpace(code)
+	now := time.Now()
+
+	var candidates []Discount
+	rows, err := tx.Query(ctx, `
+SELECT id, code, name, kind, value, max_discount_inr, min_order_inr, usage_limit, per_phone_limit, starts_at, ends_at, active
+FROM discounts
+WHERE (code IS NULL AND active) OR ($1 <> '' AND upper(code) = upper($1))
+ORDER BY code NULLS LAST, created_at ASC
+`, code)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var d Discount
+		if err := rows.Scan(&d.ID, &d.Code, &d.Name, &d.Kind, &d.Value, &d.MaxDiscountINR, &d.MinOrderINR, &d.UsageLimit, &d.PerPhoneLimit,
+			&d.StartsAt, &d.EndsAt, &d.Active); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if code != "" && (len(candidates) == 0 || candidates[0].Code == nil) {
+		return nil, &DiscountError{Code: code, Reason: "does not exist"}
+	}
+
+	productIDs := make([]uuid.UUID, 0, len(lines))
+	subtotal := 0
+	for _, l := range lines {
+		productIDs = append(productIDs, l.productID)
+		subtotal += l.total
+	}
+
+	var applied []AppliedDiscount
+	var best *AppliedDiscount
+	var bestEligible []int
+	for _, d := range candidates {
+		reason, err := discountRejection(ctx, tx, d, phone, subtotal, now)
+		if err != nil {
+			return nil, err
+		}
+		var eligible []int
+		if reason == "" {
+			eligible, err = discountEligibleLines(ctx, tx, d.ID, productIDs)
+			if err != nil {
+				return nil, err
+			}
+			if len(eligible) == 0 {
+				reason = "does not apply to any item in the cart"
+			}
+		}
+		if reason != "" {
+			if d.Code != nil {
+				return nil, &DiscountError{Code: *d.Code, Reason: reason}
+			}
+			continue
+		}
+
+		base := 0
+		for _, i := range eligible {
+			base += lines[i].total - lines[i].discount
+		}
+		amount := d.Value
+		if d.Kind == DiscountPercent {
+			amount = (base*d.Value + 50) / 100
+		}
+		if d.MaxDiscountINR != nil {
+			amount = min(amount, *d.MaxDiscountINR)
+		}
+		amount = min(amount, base)
+		if amount <= 0 {
+			if d.Code != nil {
+				return nil, &DiscountError{Code: *d.Code, Reason: "does not apply to any item in the cart"}
+			}
+			continue
+		}
+
+		ad := AppliedDiscount{DiscountID: d.ID, Code: d.Code, Name: d.Name, AmountINR: amount}
+		if d.Code != nil {
+			// The code comes first, so it is always spread over the full lines.
+			spreadDiscount(lines, eligible, amount)
+			applied = append(applied, ad)
+			continue
+		}
+		if best == nil || amount > best.AmountINR {
+			best, bestEligible = &ad, eligible
+		}
+	}
+	if best != nil {
+		// Recompute against what the code left over.
+		base := 0
+		for _, i := range bestEligible {
+			base += lines[i].total - lines[i].discount
+		}
+		if best.AmountINR = min(best.AmountINR, base); best.AmountINR > 0 {
+			spreadDiscount(lines, bestEligible, best.AmountINR)
+			applied = append(applied, *best)
+		}
+	}
+	return applied, nil
+}
+
+// discountRejection returns why d cannot be used now on an order of subtotal
+// for phone, or "" when it can. Discounts with usage limits are locked first.
+func discountRejection(ctx context.Context, tx pgx.Tx, d Discount, phone string, subtotal int, now time.Time) (string, error) {
+	switch {
+	case !d.Active:
+		return "is not active", nil
+	case d.StartsAt != nil && now.Before(*d.StartsAt):
+		return "is not valid yet", nil
+	case d.EndsAt != nil && !now.Before(*d.EndsAt):
+		return "has expired", nil
+	case subtotal < d.MinOrderINR:
+		return fmt.Sprintf("requires a minimum order of %s", formatINR(d.MinOrderINR)), nil
+	}
+	if d.UsageLimit == nil && d.PerPhoneLimit == nil {
+		return "", nil
+	}
+
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM discounts WHERE id=$1 FOR UPDATE`, d.ID); err != nil {
+		return "", err
+	}
+	if d.UsageLimit != nil {
+		var used int
+		if err := tx.QueryRow(ctx, discountUsedSQL("$1"), d.ID).Scan(&used); err != nil {
+			return "", err
+		}
+		if used >= *d.UsageLimit {
+			return "has reached its usage limit", nil
+		}
+	}
+	if d.PerPhoneLimit != nil {
+		var used int
+		// Phones are compared by their last 10 digits, so "+91 98765 43210"
+		// and "9876543210" count as the same number.
+		if err := tx.QueryRow(ctx, discountUsedSQL("$1")+`
+  AND right(regexp_replace(o.customer_phone, '\D', '', 'g'), 10) = right(regexp_replace($2, '\D', '', 'g'), 10)`,
+			d.ID, phone).Scan(&used); err != nil {
+			return "", err
+		}
+		if used >= *d.PerPhoneLimit {
+			return "has already been used with this phone number", nil
+		}
+	}
+	return "", nil
+}
+
+// discountEligibleLines returns the indexes of the lines (by product) a
+// discount applies to: every line unless it is limited to products or
+// categories.
+func discountEligibleLines(ctx context.Context, tx pgx.Tx, discountID uuid.UUID, productIDs []uuid.UUID) ([]int, error) {
+	rows, err := tx.Query(ctx, `
+SELECT p.id,
+       NOT EXISTS (SELECT 1 FROM discount_products WHERE discount_id = $1)
+         AND NOT EXISTS (SELECT 1 FROM discount_categories WHERE discount_id = $1)
+       OR EXISTS (SELECT 1 FROM discount_products dp WHERE dp.discount_id = $1 AND dp.product_id = p.id)
+       OR EXISTS (SELECT 1 FROM discount_categories dc
+                  JOIN product_categories pc ON pc.category_id = dc.category_id
+                  WHERE dc.discount_id = $1 AND pc.product_id = p.id)
+FROM unnest($2::uuid[]) AS p(id)
+`, discountID, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applies := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var pid uuid.UUID
+		var ok bool
+		if err := rows.Scan(&pid, &ok); err != nil {
+			return nil, err
+		}
+		applies[pid] = ok
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var out []int
+	for i, pid := range productIDs {
+		if applies[pid] {
+			out = append(out, i)
+		}
+	}
+	return out, nil
+}
+
+// spreadDiscount adds amount to the discount of the eligible lines in
+// proportion to what is left of each, giving rounding leftovers to the first
+// lines with room. The caller ensures amount fits.
+func spreadDiscount(lines []discountLine, eligible []int, amount int) {
+	base := 0
+	for _, i := range eligible {
+		base += lines[i].total - lines[i].discount
+	}
+	if base <= 0 {
+		return
+	}
+	left := amount
+	for _, i := range eligible {
+		share := amount * (lines[i].total - lines[i].discount) / base
+		lines[i].discount += share
+		left -= share
+	}
+	for _, i := range eligible {
+		if left == 0 {
+			break
+		}
+		if room := lines[i].total - lines[i].discount; room > 0 {
+			n := min(room, left)
+			lines[i].discount += n
+			left -= n
+		}
+	}
+}
+
+// loadOrderDiscounts returns the discounts applied to an order.
+func (s *Store) loadOrderDiscounts(ctx context.Context, orderID uuid.UUID) ([]AppliedDiscount, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT discount_id, code, name, amount_inr
+FROM order_discounts
+WHERE order_id=$1
+ORDER BY created_at ASC, name ASC
+`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []AppliedDiscount{}
+	for rows.Next() {
+		var d AppliedDiscount
+		if err := rows.Scan(&d.DiscountID, &d.Code, &d.Name, &d.AmountINR); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// expiringPayment matches the payments of pending_payment orders that waited
+// too long: created ones $1 seconds after checkout, authorized ones (which may
+// still be captured) only after the longer $2.
+const expiringPayment = `o.status = 'pending_payment'
+  AND ((p.status = 'created' AND o.created_at < now() - make_interval(secs => $1))
+    OR (p.status = 'authorized' AND o.created_at < now() - make_interval(secs => $2)))`
+
+// ListExpiringPayments returns up to limit payments whose pending_payment
+// order is due to expire, oldest order first: payments still created ttl
+// after checkout and payments still authorized authorizedTTL after it. The
+// caller should check each with the provider before expiring it with
+// ExpirePendingOrder.
+func (s *Store) ListExpiringPayments(ctx context.Context, ttl, authorizedTTL time.Duration, limit int) ([]UnsettledPayment, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT p.id, p.order_id, p.status, p.razorpay_order_id, p.razorpay_payment_id, p.amount_inr, o.currency
+FROM orders o
+JOIN payments p ON p.order_id = o.id
+WHERE `+expiringPayment+`
+ORDER BY o.created_at ASC
+LIMIT $3
+`, ttl.Seconds(), authorizedTTL.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []UnsettledPayment{}
+	for rows.Next() {
+		var p UnsettledPayment
+		if err := rows.Scan(&p.ID, &p.OrderID, &p.Status, &p.RazorpayOrderID, &p.RazorpayPaymentID, &p.AmountINR, &p.Currency); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// ExpirePendingOrder cancels the order of a payment returned by
+// ListExpiringPayments, marks the payment failed and releases the order's
+// inventory reservation. It reports false without changes when the payment
+// settled in the meantime or is locked by another instance, so several API
+// instances can sweep concurrently.
+func (s *Store) ExpirePendingOrder(ctx context.Context, paymentID uuid.UUID, ttl, authorizedTTL time.Duration) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var orderID uuid.UUID
+	err = tx.QueryRow(ctx, `
+SELECT o.id
+FROM orders o
+JOIN payments p ON p.order_id = o.id
+WHERE p.id = $3
+  AND `+expiringPayment+`
+FOR UPDATE OF o, p SKIP LOCKED
+`, ttl.Seconds(), authorizedTTL.Seconds(), paymentID).Scan(&orderID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	actor := Actor{Source: ActorSourceExpiry}
+	if _, err := transitionPayment(ctx, tx, paymentID, PaymentFailed, actor, "reservation expired"); err != nil {
+		return false, err
+	}
+	// Releases the reserved stock.
+	if _, err := transitionOrder(ctx, tx, orderID, OrderCancelled, actor, "reservation expired"); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
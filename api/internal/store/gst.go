@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"clothes-shop/api/internal/gst"
+)
+
+// GSTSettings configures the GST charged at checkout.
+type GSTSettings struct {
+	// SellerState is the code of the state the seller is registered in.
+	SellerState string
+	// FallbackRateBps applies to products without an HSN code, or whose code
+	// has no gst_rates entry.
+	FallbackRateBps int
+}
+
+// TaxLine is the GST on one order line, or on shipping.
+type TaxLine struct {
+	SKU         string `json:"sku,omitempty"`
+	Description string `json:"description"`
+	HSNCode     string `json:"hsn_code"`
+	Quantity    int    `json:"quantity"`
+	TaxableINR  int    `json:"taxable_inr"`
+	RateBps     int    `json:"rate_bps"`
+	CGSTINR     int    `json:"cgst_inr"`
+	SGSTINR     int    `json:"sgst_inr"`
+	IGSTINR     int    `json:"igst_inr"`
+}
+
+// OrderTax is the GST breakdown of an order. The CGST, SGST and IGST totals
+// include the tax on shipping.
+type OrderTax struct {
+	SellerState   string    `json:"seller_state"`
+	PlaceOfSupply string    `json:"place_of_supply"`
+	CGSTINR       int       `json:"cgst_inr"`
+	SGSTINR       int       `json:"sgst_inr"`
+	IGSTINR       int       `json:"igst_inr"`
+	Lines         []TaxLine `json:"lines"`
+	Shipping      TaxLine   `json:"shipping"`
+}
+
+func loadGSTRates(ctx context.Context, tx pgx.Tx) (gst.Rates, error) {
+	rows, err := tx.Query(ctx, `
+SELECT hsn_prefix, threshold_inr, rate_bps, above_rate_bps
+FROM gst_rates
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out gst.Rates
+	for rows.Next() {
+		var r gst.Rate
+		if err := rows.Scan(&r.HSNPrefix, &r.ThresholdINR, &r.RateBps, &r.AboveRateBps); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// lineGSTRate returns the rate for qty units of a product with the given HSN
+// code worth taxableINR in total; slabs go by the value per unit after
+// discounts.
+func lineGSTRate(rates gst.Rates, fallbackBps int, hsn string, taxableINR, qty int) int {
+	r, ok := rates.Lookup(hsn)
+	if hsn == "" || !ok {
+		return fallbackBps
+	}
+	return r.RateFor((taxableINR + qty/2) / qty)
+}
+
+func (s *Store) loadOrderTax(ctx context.Context, orderID uuid.UUID) (OrderTax, error) {
+	var t OrderTax
+	var shipping int
+	err := s.db.QueryRow(ctx, `
+SELECT seller_state, place_of_supply, cgst_inr, sgst_inr, igst_inr, shipping_inr,
+       shipping_gst_rate_bps, shipping_cgst_inr, shipping_sgst_inr, shipping_igst_inr
+FROM orders
+WHERE id=$1
+`, orderID).Scan(
+		&t.SellerState, &t.PlaceOfSupply, &t.CGSTINR, &t.SGSTINR, &t.IGSTINR, &shipping,
+		&t.Shipping.RateBps, &t.Shipping.CGSTINR, &t.Shipping.SGSTINR, &t.Shipping.IGSTINR,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return OrderTax{}, ErrNotFound
+		}
+		return OrderTax{}, err
+	}
+	t.Shipping.Description = "Shipping"
+	t.Shipping.Quantity = 1
+	t.Shipping.TaxableINR = shipping
+
+	rows, err := s.db.Query(ctx, `
+SELECT sku, product_name, variant_title, hsn_code, quantity, taxable_value_inr, gst_rate_bps, cgst_inr, sgst_inr, igst_inr
+FROM order_items
+WHERE order_id=$1
+ORDER BY product_name ASC, sku ASC
+`, orderID)
+	if err != nil {
+		return OrderTax{}, err
+	}
+	defer rows.Close()
+	t.Lines = []TaxLine{}
+	for rows.Next() {
+		var l TaxLine
+		var product, variant string
+		if err := rows.Scan(&l.SKU, &product, &variant, &l.HSNCode, &l.Quantity, &l.TaxableINR, &l.RateBps, &l.CGSTINR, &l.SGSTINR, &l.IGSTINR); err != nil {
+			return OrderTax{}, err
+		}
+		l.Description = product
+		if variant != "" {
+			l.Description = fmt.Sprintf("%s (%s)", product, variant)
+		}
+		t.Lines = append(t.Lines, l)
+	}
+	return t, rows.Err()
+}
+
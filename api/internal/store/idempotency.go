@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IdempotentResponse is a stored response, or a claim on a key whose request
+// is still running (Status == 0).
+type IdempotentResponse struct {
+	RequestHash string
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// idempotencyLease is how long a claim on a key lasts before a retry of the
+// same request may take it over, e.g. after the instance handling it died. It
+// is well above the server's write timeout, so live requests keep their claim.
+const idempotencyLease = 5 * time.Minute
+
+// ClaimIdempotencyKey reserves key within scope for a request with the given
+// fingerprint. It returns claimed=true when the caller should handle the
+// request; otherwise existing holds what was stored for the key. Keys older
+// than ttl are treated as unused, and a claim whose lease lapsed without a
+// response is handed to a retry with the same fingerprint.
+func (s *Store) ClaimIdempotencyKey(ctx context.Context, scope, key, requestHash string, ttl time.Duration) (existing IdempotentResponse, claimed bool, err error) {
+	ct, err := s.db.Exec(ctx, `
+INSERT INTO idempotency_keys (scope, key, request_hash, locked_until)
+VALUES ($1, $2, $3, now() + make_interval(secs => $5))
+ON CONFLICT (scope, key) DO UPDATE SET
+  request_hash = EXCLUDED.request_hash,
+  response_status = NULL,
+  response_content_type = '',
+  response_body = NULL,
+  created_at = now(),
+  completed_at = NULL,
+  locked_until = EXCLUDED.locked_until
+WHERE idempotency_keys.created_at < now() - make_interval(secs => $4)
+   OR (idempotency_keys.completed_at IS NULL
+       AND idempotency_keys.request_hash = EXCLUDED.request_hash
+       AND idempotency_keys.locked_until < now())
+`, scope, key, requestHash, ttl.Seconds(), idempotencyLease.Seconds())
+	if err != nil {
+		return IdempotentResponse{}, false, err
+	}
+	if ct.RowsAffected() == 1 {
+		return IdempotentResponse{}, true, nil
+	}
+
+	var status *int
+	err = s.db.QueryRow(ctx, `
+SELECT request_hash, response_status, response_content_type, COALESCE(response_body, ''::bytea)
+FROM idempotency_keys
+WHERE scope=$1 AND key=$2
+`, scope, key).Scan(&existing.RequestHash, &status, &existing.ContentType, &existing.Body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Released between the insert and the read; let the caller retry.
+		return IdempotentResponse{}, false, ErrNotFound
+	}
+	if err != nil {
+		return IdempotentResponse{}, false, err
+	}
+	if status != nil {
+		existing.Status = *status
+	}
+	return existing, false, nil
+}
+
+// CompleteIdempotencyKey stores the response of a claimed request.
+func (s *Store) CompleteIdempotencyKey(ctx context.Context, scope, key string, resp IdempotentResponse) error {
+	_, err := s.db.Exec(ctx, `
+UPDATE idempotency_keys
+SET response_status=$3, response_content_type=$4, response_body=$5, completed_at=now()
+WHERE scope=$1 AND key=$2
+`, scope, key, resp.Status, resp.ContentType, resp.Body)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a claimed key, e.g. after a server error, so
+// the request can be retried with it.
+func (s *Store) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE scope=$1 AND key=$2`, scope, key)
+	return err
+}
+
+// PurgeIdempotencyKeys deletes keys older than ttl and returns how many.
+func (s *Store) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration) (int64, error) {
+	ct, err := s.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE created_at < now() - make_interval(secs => $1)`, ttl.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return ct.RowsAffected(), nil
+}
+
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrImageOrderMismatch = errors.New("image_ids must list every image of the owner exactly once")
+
+type Image struct {
+	ID        uuid.UUID `json:"id"`
+	URL       string    `json:"url"`
+	SortOrder int       `json:"sort_order"`
+}
+
+// ImageOwner identifies what an image is attached to: exactly one of
+// ProductID or VariantID is set, mirroring the product_images CHECK.
+type ImageOwner struct {
+	ProductID *uuid.UUID
+	VariantID *uuid.UUID
+}
+
+func (o ImageOwner) where() (string, uuid.UUID) {
+	if o.VariantID != nil {
+		return "variant_id", *o.VariantID
+	}
+	return "product_id", *o.ProductID
+}
+
+// AdminAddImage attaches an already stored image to a product or variant, after
+// the owner's existing images.
+func (s *Store) AdminAddImage(ctx context.Context, owner ImageOwner, url, storageKey string) (Image, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Image{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	col, ownerID := owner.where()
+	table := "products"
+	if col == "variant_id" {
+		table = "product_variants"
+	}
+	// Lock the owner so concurrent uploads get distinct sort orders.
+	var locked uuid.UUID
+	if err := tx.QueryRow(ctx, `SELECT id FROM `+table+` WHERE id=$1 FOR UPDATE`, ownerID).Scan(&locked); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Image{}, ErrNotFound
+		}
+		return Image{}, err
+	}
+
+	img := Image{URL: url}
+	err = tx.QueryRow(ctx, `
+INSERT INTO product_images (product_id, variant_id, url, storage_key, sort_order)
+VALUES ($1, $2, $3, $4, (SELECT COALESCE(MAX(sort_order) + 1, 0) FROM product_images WHERE `+col+` = $5))
+RETURNING id, sort_order
+`, owner.ProductID, owner.VariantID, url, storageKey, ownerID).Scan(&img.ID, &img.SortOrder)
+	if err != nil {
+		return Image{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Image{}, err
+	}
+	return img, nil
+}
+
+// AdminReorderImages sets the sort order of an owner's images to the order of imageIDs.
+func (s *Store) AdminReorderImages(ctx context.Context, owner ImageOwner, imageIDs []uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	col, ownerID := owner.where()
+	rows, err := tx.Query(ctx, `SELECT id FROM product_images WHERE `+col+` = $1 FOR UPDATE`, ownerID)
+	if err != nil {
+		return err
+	}
+	existing := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(existing) != len(imageIDs) {
+		return ErrImageOrderMismatch
+	}
+	for _, id := range imageIDs {
+		if !existing[id] {
+			return ErrImageOrderMismatch
+		}
+		delete(existing, id)
+	}
+
+	for i, id := range imageIDs {
+		if _, err := tx.Exec(ctx, `UPDATE product_images SET sort_order=$2 WHERE id=$1`, id, i); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// AdminDeleteImage removes an image row and returns its storage key so the
+// caller can delete the stored file.
+func (s *Store) AdminDeleteImage(ctx context.Context, imageID uuid.UUID) (storageKey string, err error) {
+	err = s.db.QueryRow(ctx, `
+DELETE FROM product_images
+WHERE id=$1
+RETURNING storage_key
+`, imageID).Scan(&storageKey)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return storageKey, nil
+}
+
+// loadImages returns the ordered images of the given products and of their
+// variants, keyed by product id and variant id respectively.
+func (s *Store) loadImages(ctx context.Context, productIDs []uuid.UUID) (byProduct, byVariant map[uuid.UUID][]Image, err error) {
+	byProduct = map[uuid.UUID][]Image{}
+	byVariant = map[uuid.UUID][]Image{}
+	if len(productIDs) == 0 {
+		return byProduct, byVariant, nil
+	}
+	rows, err := s.db.Query(ctx, `
+SELECT pi.id, pi.product_id, pi.variant_id, pi.url, pi.sort_order
+FROM product_images pi
+LEFT JOIN product_variants v ON v.id = pi.variant_id
+WHERE pi.product_id = ANY($1) OR v.product_id = ANY($1)
+ORDER BY pi.sort_order ASC, pi.created_at ASC
+`, productIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var img Image
+		var productID, variantID *uuid.UUID
+		if err := rows.Scan(&img.ID, &productID, &variantID, &img.URL, &img.SortOrder); err != nil {
+			return nil, nil, err
+		}
+		if variantID != nil {
+			byVariant[*variantID] = append(byVariant[*variantID], img)
+		} else if productID != nil {
+			byProduct[*productID] = append(byProduct[*productID], img)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return byProduct, byVariant, nil
+}
+
+// attachImages fills the Images fields of products and their variants.
+func (s *Store) attachImages(ctx context.Context, products []*Product) error {
+	ids := make([]uuid.UUID, 0, len(products))
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+	byProduct, byVariant, err := s.loadImages(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, p := range products {
+		p.Images = byProduct[p.ID]
+		if p.Images == nil {
+			p.Images = []Image{}
+		}
+		for i := range p.Variants {
+			v := &p.Variants[i]
+			v.Images = byVariant[v.ID]
+			if v.Images == nil {
+				v.Images = []Image{}
+			}
+		}
+	}
+	return nil
+}
+
@@ -0,0 +1,320 @@
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Inventory movement reasons, as stored in inventory_movements.reason.
+const (
+	MovementOpeningBalance = "opening_balance"
+	MovementInitialStock   = "initial_stock"
+	MovementAdjustment     = "adjustment"
+	MovementReserve        = "reserve"
+	MovementRelease        = "release"
+	MovementSale           = "sale"
+	MovementRestock        = "restock"
+)
+
+var ErrNegativeOnHand = errors.New("on_hand would go negative")
+
+type InventoryMovement struct {
+	ID            uuid.UUID  `json:"id"`
+	VariantID     uuid.UUID  `json:"variant_id"`
+	Reason        string     `json:"reason"`
+	DeltaOnHand   int        `json:"delta_on_hand"`
+	DeltaReserved int        `json:"delta_reserved"`
+	OrderID       *uuid.UUID `json:"order_id,omitempty"`
+	ActorUserID   *uuid.UUID `json:"actor_user_id,omitempty"`
+	Note          string     `json:"note"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// inventoryMove is a requested change to one variant's stock. A negative
+// DeltaReserved never takes reserved below zero; the ledger records the change
+// actually applied.
+type inventoryMove struct {
+	VariantID     uuid.UUID
+	Reason        string
+	DeltaOnHand   int
+	DeltaReserved int
+	OrderID       *uuid.UUID
+	ActorUserID   *uuid.UUID
+	Note          string
+}
+
+// moveInventory applies m to the variant's inventory row and appends it to the
+// ledger, returning the new on_hand and reserved.
+func moveInventory(ctx context.Context, tx pgx.Tx, m inventoryMove) (onHand, reserved int, err error) {
+	var curOnHand, curReserved int
+	if err := tx.QueryRow(ctx, `
+SELECT on_hand, reserved FROM inventory WHERE variant_id=$1 FOR UPDATE
+`, m.VariantID).Scan(&curOnHand, &curReserved); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, 0, ErrNotFound
+		}
+		return 0, 0, err
+	}
+	onHand = curOnHand + m.DeltaOnHand
+	if onHand < 0 {
+		return 0, 0, ErrNegativeOnHand
+	}
+	reserved = max(0, curReserved+m.DeltaReserved)
+	if onHand == curOnHand && reserved == curReserved {
+		return onHand, reserved, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+UPDATE inventory SET on_hand=$2, reserved=$3, updated_at=now() WHERE variant_id=$1
+`, m.VariantID, onHand, reserved)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, err = tx.Exec(ctx, `
+INSERT INTO inventory_movements (variant_id, reason, delta_on_hand, delta_reserved, order_id, actor_user_id, note)
+VALUES ($1,$2,$3,$4,$5,$6,$7)
+`, m.VariantID, m.Reason, onHand-curOnHand, reserved-curReserved, m.OrderID, m.ActorUserID, m.Note)
+	if err != nil {
+		return 0, 0, err
+	}
+	return onHand, reserved, nil
+}
+
+type orderLine struct {
+	VariantID uuid.UUID
+	Quantity  int
+}
+
+// loadOrderLines returns the variant quantities of an order. The rows are fully
+// read before returning so the caller can issue further statements on tx.
+func loadOrderLines(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) ([]orderLine, error) {
+	rows, err := tx.Query(ctx, `SELECT variant_id, quantity FROM order_items WHERE order_id=$1 ORDER BY variant_id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	lines := []orderLine{}
+	for rows.Next() {
+		var l orderLine
+		if err := rows.Scan(&l.VariantID, &l.Quantity); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, rows.Err()
+}
+
+// releaseOrderReservations releases the stock reserved for every line of an order.
+func releaseOrderReservations(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, actor *uuid.UUID, note string) error {
+	lines, err := loadOrderLines(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if _, _, err := moveInventory(ctx, tx, inventoryMove{
+			VariantID:     l.VariantID,
+			Reason:        MovementRelease,
+			DeltaReserved: -l.Quantity,
+			OrderID:       &orderID,
+			ActorUserID:   actor,
+			Note:          note,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitOrderStock turns an order's reservations into sales: on_hand and
+// reserved both drop by each line's quantity.
+func commitOrderStock(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, actor *uuid.UUID, note string) error {
+	lines, err := loadOrderLines(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if _, _, err := moveInventory(ctx, tx, inventoryMove{
+			VariantID:     l.VariantID,
+			Reason:        MovementSale,
+			DeltaOnHand:   -l.Quantity,
+			DeltaReserved: -l.Quantity,
+			OrderID:       &orderID,
+			ActorUserID:   actor,
+			Note:          note,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restockOrder puts every line of an order back into on_hand, less what
+// its returns already restocked.
+func restockOrder(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, actor *uuid.UUID, note string) error {
+	lines, err := loadOrderLines(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(ctx, `
+SELECT variant_id, sum(restocked_quantity)
+FROM return_items
+WHERE order_id=$1
+GROUP BY variant_id
+`, orderID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	restocked := map[uuid.UUID]int{}
+	for rows.Next() {
+		var variantID uuid.UUID
+		var n int
+		if err := rows.Scan(&variantID, &n); err != nil {
+			return err
+		}
+		restocked[variantID] = n
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, l := range lines {
+		qty := l.Quantity - restocked[l.VariantID]
+		if qty <= 0 {
+			continue
+		}
+		if _, _, err := moveInventory(ctx, tx, inventoryMove{
+			VariantID:   l.VariantID,
+			Reason:      MovementRestock,
+			DeltaOnHand: qty,
+			OrderID:     &orderID,
+			ActorUserID: actor,
+			Note:        note,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type MovementPage struct {
+	Movements  []InventoryMovement `json:"movements"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// AdminListInventoryMovements pages through a variant's ledger, newest first.
+func (s *Store) AdminListInventoryMovements(ctx context.Context, variantID uuid.UUID, limit int, cursor string) (MovementPage, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	after := "TRUE"
+	args := sqlArgs{variantID}
+	if cursor != "" {
+		t, id, err := decodeTimeCursor(cursor)
+		if err != nil {
+			return MovementPage{}, err
+		}
+		after = "(created_at, id) < (" + args.add(t) + ", " + args.add(id) + ")"
+	}
+	rows, err := s.db.Query(ctx, `
+SELECT id, variant_id, reason, delta_on_hand, delta_reserved, order_id, actor_user_id, note, created_at
+FROM inventory_movements
+WHERE variant_id=$1 AND `+after+`
+ORDER BY created_at DESC, id DESC
+LIMIT `+args.add(limit+1), args...)
+	if err != nil {
+		return MovementPage{}, err
+	}
+	defer rows.Close()
+
+	page := MovementPage{Movements: []InventoryMovement{}}
+	for rows.Next() {
+		var m InventoryMovement
+		if err := rows.Scan(&m.ID, &m.VariantID, &m.Reason, &m.DeltaOnHand, &m.DeltaReserved, &m.OrderID, &m.ActorUserID, &m.Note, &m.CreatedAt); err != nil {
+			return MovementPage{}, err
+		}
+		page.Movements = append(page.Movements, m)
+	}
+	if err := rows.Err(); err != nil {
+		return MovementPage{}, err
+	}
+	if len(page.Movements) > limit {
+		page.Movements = page.Movements[:limit]
+		last := page.Movements[limit-1]
+		page.NextCursor = encodeTimeCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+type InventoryDiscrepancy struct {
+	VariantID      uuid.UUID `json:"variant_id"`
+	SKU            string    `json:"sku"`
+	OnHand         int       `json:"on_hand"`
+	Reserved       int       `json:"reserved"`
+	LedgerOnHand   int       `json:"ledger_on_hand"`
+	LedgerReserved int       `json:"ledger_reserved"`
+}
+
+// ReconcileInventory recomputes stock from the movement ledger and returns the
+// variants whose inventory row disagrees with it.
+func (s *Store) ReconcileInventory(ctx context.Context) ([]InventoryDiscrepancy, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT v.id, v.sku,
+       COALESCE(i.on_hand, 0), COALESCE(i.reserved, 0),
+       COALESCE(m.on_hand, 0), COALESCE(m.reserved, 0)
+FROM product_variants v
+LEFT JOIN inventory i ON i.variant_id = v.id
+LEFT JOIN (
+  SELECT variant_id, SUM(delta_on_hand) AS on_hand, SUM(delta_reserved) AS reserved
+  FROM inventory_movements
+  GROUP BY variant_id
+) m ON m.variant_id = v.id
+WHERE COALESCE(i.on_hand, 0) <> COALESCE(m.on_hand, 0)
+   OR COALESCE(i.reserved, 0) <> COALESCE(m.reserved, 0)
+ORDER BY v.sku ASC
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []InventoryDiscrepancy{}
+	for rows.Next() {
+		var d InventoryDiscrepancy
+		if err := rows.Scan(&d.VariantID, &d.SKU, &d.OnHand, &d.Reserved, &d.LedgerOnHand, &d.LedgerReserved); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// encodeTimeCursor encodes a (created_at, id) keyset position.
+func encodeTimeCursor(t time.Time, id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(t.UTC().Format(time.RFC3339Nano) + "|" + id.String()))
+}
+
+func decodeTimeCursor(s string) (time.Time, uuid.UUID, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	ts, rawID, ok := strings.Cut(string(b), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	return t, id, nil
+}
+
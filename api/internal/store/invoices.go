@@ -0,0 +1,241 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrOrderNotInvoiceable = errors.New("order cannot be invoiced")
+
+// ist is Indian Standard Time, which GST financial years and invoice dates
+// follow.
+var ist = time.FixedZone("IST", 5*3600+1800)
+
+type Invoice struct {
+	ID            uuid.UUID `json:"id"`
+	OrderID       uuid.UUID `json:"order_id"`
+	Number        string    `json:"number"`
+	FinancialYear string    `json:"financial_year"`
+	SellerGSTIN   string    `json:"seller_gstin"`
+	IssuedAt      time.Time `json:"issued_at"`
+}
+
+// InvoiceFinancialYear returns the Indian financial year (April to March)
+// containing t, e.g. "2026-27".
+func InvoiceFinancialYear(t time.Time) string {
+	t = t.In(ist)
+	start := t.Year()
+	if t.Month() < time.April {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// invoiceNumber formats the seq'th invoice of a financial year, e.g.
+// "INV/26-27/000042"; GST allows at most 16 characters.
+func invoiceNumber(financialYear string, seq int) string {
+	return fmt.Sprintf("INV/%s/%06d", financialYear[2:], seq)
+}
+
+// invoiceableStatuses are the order statuses for which money may have been
+// received; the order's payment must also be captured, which a
+// cash-on-delivery order's is once delivered.
+var invoiceableStatuses = []string{OrderPaid, OrderPartiallyShipped, OrderShipped, OrderFulfilled}
+
+// IssueInvoice issues the GST invoice for a paid order: it takes the next
+// number of the current financial year and stores the document render
+// produces. The invoice row and its number are only kept if render succeeds,
+// so numbers have no gaps. An order that already has an invoice gets it back
+// unchanged; one that has not been paid, or was placed before GST was
+// recorded per order, fails with ErrOrderNotInvoiceable.
+func (s *Store) IssueInvoice(ctx context.Context, orderID uuid.UUID, sellerGSTIN string, render func(Invoice, OrderDetail) ([]byte, error)) (Invoice, error) {
+	// Order contents do not change once paid, so the detail can be read
+	// before locking.
+	detail, err := s.AdminGetOrder(ctx, orderID)
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Invoice{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var status, placeOfSupply string
+	var captured bool
+	if err := tx.QueryRow(ctx, `
+SELECT o.status, o.place_of_supply,
+       EXISTS (SELECT 1 FROM payments p WHERE p.order_id = o.id AND p.status = 'captured')
+FROM orders o
+WHERE o.id=$1
+FOR UPDATE OF o
+`, orderID).Scan(&status, &placeOfSupply, &captured); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Invoice{}, ErrNotFound
+		}
+		return Invoice{}, err
+	}
+	inv, err := getInvoice(ctx, tx, orderID)
+	if err == nil {
+		return inv, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return Invoice{}, err
+	}
+	if !slices.Contains(invoiceableStatuses, status) || !captured {
+		return Invoice{}, fmt.Errorf("%w: it has not been paid", ErrOrderNotInvoiceable)
+	}
+	if placeOfSupply == "" {
+		return Invoice{}, fmt.Errorf("%w: it was placed before GST was recorded", ErrOrderNotInvoiceable)
+	}
+
+	issuedAt := time.Now().UTC().Truncate(time.Microsecond)
+	inv = Invoice{
+		ID:            uuid.New(),
+		OrderID:       orderID,
+		FinancialYear: InvoiceFinancialYear(issuedAt),
+		SellerGSTIN:   sellerGSTIN,
+		IssuedAt:      issuedAt,
+	}
+	// The upsert locks the year's counter row until commit, so concurrent
+	// invoices are numbered one after another.
+	var seq int
+	err = tx.QueryRow(ctx, `
+INSERT INTO invoice_sequences (financial_year, last_number)
+VALUES ($1, 1)
+ON CONFLICT (financial_year) DO UPDATE SET last_number = invoice_sequences.last_number + 1
+RETURNING last_number
+`, inv.FinancialYear).Scan(&seq)
+	if err != nil {
+		return Invoice{}, err
+	}
+	inv.Number = invoiceNumber(inv.FinancialYear, seq)
+
+	doc, err := render(inv, detail)
+	if err != nil {
+		return Invoice{}, err
+	}
+	_, err = tx.Exec(ctx, `
+INSERT INTO invoices (id, order_id, number, financial_year, sequence, seller_gstin, pdf, issued_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+`, inv.ID, orderID, inv.Number, inv.FinancialYear, seq, sellerGSTIN, doc, inv.IssuedAt)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Invoice{}, err
+	}
+	return inv, nil
+}
+
+// GetInvoicePDF returns an order's invoice and its PDF.
+func (s *Store) GetInvoicePDF(ctx context.Context, orderID uuid.UUID) (Invoice, []byte, error) {
+	var inv Invoice
+	var doc []byte
+	err := s.db.QueryRow(ctx, `
+SELECT id, order_id, number, financial_year, seller_gstin, issued_at, pdf
+FROM invoices
+WHERE order_id=$1
+`, orderID).Scan(&inv.ID, &inv.OrderID, &inv.Number, &inv.FinancialYear, &inv.SellerGSTIN, &inv.IssuedAt, &doc)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Invoice{}, nil, ErrNotFound
+		}
+		return Invoice{}, nil, err
+	}
+	return inv, doc, nil
+}
+
+func getInvoice(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) (Invoice, error) {
+	var inv Invoice
+	err := tx.QueryRow(ctx, `
+SELECT id, order_id, number, financial_year, seller_gstin, issued_at
+FROM invoices
+WHERE order_id=$1
+`, orderID).Scan(&inv.ID, &inv.OrderID, &inv.Number, &inv.FinancialYear, &inv.SellerGSTIN, &inv.IssuedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Invoice{}, ErrNotFound
+		}
+		return Invoice{}, err
+	}
+	return inv, nil
+}
+
+// ListOrdersDueForInvoice returns paid orders without an invoice, oldest
+// first. Orders placed before GST was recorded are skipped.
+func (s *Store) ListOrdersDueForInvoice(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT o.id
+FROM orders o
+WHERE o.status = ANY($1)
+  AND o.place_of_supply <> ''
+  AND EXISTS (SELECT 1 FROM payments p WHERE p.order_id = o.id AND p.status = 'captured')
+  AND NOT EXISTS (SELECT 1 FROM invoices i WHERE i.order_id = o.id)
+ORDER BY o.created_at ASC
+LIMIT $2
+`, invoiceableStatuses, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+// InvoiceNotice is an issued invoice whose customer has not been sent it yet.
+type InvoiceNotice struct {
+	Invoice
+	CustomerName  string
+	CustomerPhone string
+	CustomerEmail string
+	TotalINR      int
+}
+
+// ListInvoicesDueForNotice returns issued invoices the customer has not been
+// told about, oldest first.
+func (s *Store) ListInvoicesDueForNotice(ctx context.Context, limit int) ([]InvoiceNotice, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT i.id, i.order_id, i.number, i.financial_year, i.seller_gstin, i.issued_at,
+       o.customer_name, o.customer_phone, o.customer_email, o.total_inr
+FROM invoices i
+JOIN orders o ON o.id = i.order_id
+WHERE i.notified_at IS NULL
+ORDER BY i.issued_at ASC
+LIMIT $1
+`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []InvoiceNotice{}
+	for rows.Next() {
+		var n InvoiceNotice
+		if err := rows.Scan(&n.ID, &n.OrderID, &n.Number, &n.FinancialYear, &n.SellerGSTIN, &n.IssuedAt,
+			&n.CustomerName, &n.CustomerPhone, &n.CustomerEmail, &n.TotalINR); err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) MarkInvoiceNotified(ctx context.Context, invoiceID uuid.UUID) error {
+	_, err := s.db.Exec(ctx, `UPDATE invoices SET notified_at=now() WHERE id=$1`, invoiceID)
+	return err
+}
+
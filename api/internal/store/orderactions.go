@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrPaymentAuthorized is returned when cancelling an order whose payment is
+// authorized. Razorpay cannot void an authorization, so the order is held
+// until the payment is captured (and can be refunded) or the authorization
+// lapses and reservation expiry cancels the order.
+var ErrPaymentAuthorized = errors.New("payment is authorized and may still be captured; refund it once captured or wait for it to expire")
+
+// AdminCancelOrder cancels an order that has not been paid. A pending or
+// confirmed order's reservation is released and its payment, if nothing was
+// paid yet, is marked failed; a capture arriving after all is held in
+// payment_mismatch. Orders with an authorized payment fail with
+// ErrPaymentAuthorized.
+func (s *Store) AdminCancelOrder(ctx context.Context, orderID uuid.UUID, actor Actor, reason string) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	paymentID, payStatus, err := lockOrderPayment(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	if payStatus == PaymentAuthorized {
+		return ErrPaymentAuthorized
+	}
+	// Releases the reserved stock when the order is still pending.
+	if _, err := transitionOrder(ctx, tx, orderID, OrderCancelled, actor, reason); err != nil {
+		return err
+	}
+	if paymentID != uuid.Nil && payStatus == PaymentCreated {
+		if _, err := transitionPayment(ctx, tx, paymentID, PaymentFailed, actor, reason); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// AdminFulfillOrder marks a paid order as fulfilled without recording
+// shipments, e.g. for an order handed over in person.
+func (s *Store) AdminFulfillOrder(ctx context.Context, orderID uuid.UUID, actor Actor, note string) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	paymentID, payStatus, err := lockOrderPayment(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	if err := fulfillOrder(ctx, tx, orderID, paymentID, payStatus, actor, note); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// fulfillOrder moves an order to fulfilled. For a cash-on-delivery order this
+// is the delivery confirmation: its stock is committed and the payment
+// collected on delivery is recorded as captured. The caller must have locked
+// the payment with lockOrderPayment.
+func fulfillOrder(ctx context.Context, tx pgx.Tx, orderID, paymentID uuid.UUID, payStatus string, actor Actor, note string) error {
+	if _, err := transitionOrder(ctx, tx, orderID, OrderFulfilled, actor, note); err != nil {
+		return err
+	}
+	if paymentID != uuid.Nil && payStatus == PaymentCreated {
+		if _, err := transitionPayment(ctx, tx, paymentID, PaymentCaptured, actor, "collected on delivery"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AdminAcceptPayment accepts a capture that did not match its order, moving the
+// order from payment_mismatch to paid and committing its stock.
+func (s *Store) AdminAcceptPayment(ctx context.Context, orderID uuid.UUID, actor Actor, reason string) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT status FROM orders WHERE id=$1 FOR UPDATE`, orderID).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if status != OrderPaymentMismatch {
+		return &TransitionError{Subject: "order", From: status, To: OrderPaid}
+	}
+	if _, err := transitionOrder(ctx, tx, orderID, OrderPaid, actor, reason); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// lockOrderPayment locks the order's payment, if it has one, before the order
+// itself, matching the lock order of the payment callbacks. It returns
+// ErrNotFound for an unknown order and uuid.Nil for an order without payment.
+func lockOrderPayment(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) (uuid.UUID, string, error) {
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE id=$1)`, orderID).Scan(&exists); err != nil {
+		return uuid.Nil, "", err
+	}
+	if !exists {
+		return uuid.Nil, "", ErrNotFound
+	}
+	var paymentID uuid.UUID
+	var status string
+	err := tx.QueryRow(ctx, `
+SELECT id, status
+FROM payments
+WHERE order_id=$1
+ORDER BY created_at DESC
+LIMIT 1
+FOR UPDATE
+`, orderID).Scan(&paymentID, &status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, "", nil
+		}
+		return uuid.Nil, "", err
+	}
+	return paymentID, status, nil
+}
+
@@ -0,0 +1,305 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Order statuses (orders.status).
+const (
+	OrderDraft            = "draft"
+	OrderPendingPayment   = "pending_payment"
+	OrderConfirmed        = "confirmed"        // pay on delivery; stock stays reserved
+	OrderPaymentMismatch  = "payment_mismatch" // captured amount differs or arrived late; awaiting review
+	OrderPaid             = "paid"
+	OrderPartiallyShipped = "partially_shipped" // some items shipped
+	OrderShipped          = "shipped"           // every item shipped, not all delivered
+	OrderFailed           = "failed"
+	OrderCancelled        = "cancelled"
+	OrderFulfilled        = "fulfilled"
+	OrderRefunded         = "refunded"
+)
+
+// Payment statuses (payments.status).
+const (
+	PaymentCreated    = "created"
+	PaymentAuthorized = "authorized"
+	PaymentCaptured   = "captured"
+	PaymentFailed     = "failed"
+	PaymentRefunded   = "refunded"
+)
+
+// Allowed transitions, from docs/requirements.md.
+var (
+	orderTransitions = map[string][]string{
+		OrderDraft:            {OrderPendingPayment},
+		OrderPendingPayment:   {OrderConfirmed, OrderPaymentMismatch, OrderPaid, OrderFailed, OrderCancelled},
+		OrderPaymentMismatch:  {OrderPaid, OrderRefunded},
+		OrderConfirmed:        {OrderPartiallyShipped, OrderShipped, OrderFulfilled, OrderCancelled},
+		OrderPaid:             {OrderPartiallyShipped, OrderShipped, OrderFulfilled, OrderRefunded},
+		OrderPartiallyShipped: {OrderShipped, OrderFulfilled, OrderRefunded, OrderPaid, OrderConfirmed},
+		OrderShipped:          {OrderFulfilled, OrderRefunded, OrderPartiallyShipped, OrderPaid, OrderConfirmed},
+		OrderFulfilled:        {OrderRefunded},
+		OrderFailed:           {OrderCancelled, OrderPaymentMismatch},
+		OrderCancelled:        {OrderPaymentMismatch},
+	}
+	paymentTransitions = map[string][]string{
+		PaymentCreated:    {PaymentAuthorized, PaymentCaptured, PaymentFailed},
+		PaymentAuthorized: {PaymentCaptured, PaymentFailed},
+		PaymentCaptured:   {PaymentRefunded},
+		PaymentFailed:     {PaymentCaptured}, // captured after we gave up on it
+	}
+)
+
+// Sources of status changes, recorded in order_status_history.actor_source.
+const (
+	ActorSourceAdmin          = "admin"
+	ActorSourceCheckout       = "checkout"
+	ActorSourceVerify         = "razorpay_verify"
+	ActorSourceWebhook        = "razorpay_webhook"
+	ActorSourceExpiry         = "reservation_expiry"
+	ActorSourceReconciliation = "razorpay_reconciliation"
+	ActorSourceCourier        = "courier_tracking"
+	ActorSourceCustomer       = "customer"
+)
+
+// Actor identifies who caused a change: an admin user, or a system source such
+// as a webhook or background job.
+type Actor struct {
+	UserID *uuid.UUID
+	Source string
+}
+
+func AdminActor(userID uuid.UUID) Actor {
+	return Actor{UserID: &userID, Source: ActorSourceAdmin}
+}
+
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// TransitionError reports a status change the state machine does not allow.
+// It matches ErrInvalidTransition with errors.Is.
+type TransitionError struct {
+	Subject string // "order", "payment" or "return"
+	From    string
+	To      string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%s cannot move from %s to %s", e.Subject, e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+func allowed(transitions map[string][]string, from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+type StatusChange struct {
+	Subject     string     `json:"subject"`
+	FromStatus  *string    `json:"from_status"`
+	ToStatus    string     `json:"to_status"`
+	ActorUserID *uuid.UUID `json:"actor_user_id,omitempty"`
+	ActorSource string     `json:"actor_source"`
+	Note        string     `json:"note"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func recordStatusChange(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, subject, from, to string, actor Actor, note string) error {
+	_, err := tx.Exec(ctx, `
+INSERT INTO order_status_history (order_id, subject, from_status, to_status, actor_user_id, actor_source, note, created_at)
+VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, clock_timestamp())
+`, orderID, subject, from, to, actor.UserID, actor.Source, note)
+	return err
+}
+
+// transitionOrder moves an order to status to, applying the inventory effects
+// of the transition and recording it in the history:
+//
+//   - draft -> pending_payment reserves stock (ErrInsufficientStock if short)
+//   - pending_payment -> paid commits the reservation
+//   - pending_payment -> failed | cancelled releases the reservation
+//   - confirmed -> fulfilled commits the reservation (delivery of a COD order),
+//     as does partially_shipped | shipped -> fulfilled for a COD order
+//   - confirmed -> cancelled releases the reservation
+//   - payment_mismatch -> paid commits the reservation (admin accepted); an
+//     order held there after it failed or was cancelled has none, so its
+//     stock is reserved again first (ErrInsufficientStock if short)
+//   - payment_mismatch -> refunded releases the reservation, if any
+//
+// Moving an order to the status it already has is a no-op; any other move not
+// in the spec returns a *TransitionError. It returns the previous status.
+func transitionOrder(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, to string, actor Actor, note string) (string, error) {
+	var from string
+	if err := tx.QueryRow(ctx, `SELECT status FROM orders WHERE id=$1 FOR UPDATE`, orderID).Scan(&from); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	if from == to {
+		return from, nil
+	}
+	if !allowed(orderTransitions, from, to) {
+		return from, &TransitionError{Subject: "order", From: from, To: to}
+	}
+
+	var err error
+	switch {
+	case to == OrderPendingPayment:
+		err = reserveOrderStock(ctx, tx, orderID, actor.UserID, note)
+	case from == OrderPendingPayment && to == OrderPaid,
+		from == OrderConfirmed && to == OrderFulfilled:
+		err = commitOrderStock(ctx, tx, orderID, actor.UserID, note)
+	case from == OrderPaymentMismatch && to == OrderPaid:
+		var held bool
+		if held, err = holdsReservation(ctx, tx, orderID); err == nil && !held {
+			err = reserveOrderStock(ctx, tx, orderID, actor.UserID, note)
+		}
+		if err == nil {
+			err = commitOrderStock(ctx, tx, orderID, actor.UserID, note)
+		}
+	case (from == OrderPartiallyShipped || from == OrderShipped) && to == OrderFulfilled:
+		var cod bool
+		if cod, err = isCashOnDelivery(ctx, tx, orderID); err == nil && cod {
+			err = commitOrderStock(ctx, tx, orderID, actor.UserID, note)
+		}
+	case from == OrderPendingPayment && (to == OrderFailed || to == OrderCancelled),
+		from == OrderConfirmed && to == OrderCancelled:
+		err = releaseOrderReservations(ctx, tx, orderID, actor.UserID, note)
+	case from == OrderPaymentMismatch && to == OrderRefunded:
+		var held bool
+		if held, err = holdsReservation(ctx, tx, orderID); err == nil && held {
+			err = releaseOrderReservations(ctx, tx, orderID, actor.UserID, note)
+		}
+	}
+	if err != nil {
+		return from, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE orders SET status=$2, updated_at=now() WHERE id=$1`, orderID, to); err != nil {
+		return from, err
+	}
+	return from, recordStatusChange(ctx, tx, orderID, "order", from, to, actor, note)
+}
+
+// isCashOnDelivery reports whether an order is paid on delivery, in which case
+// its stock stays reserved until then.
+func isCashOnDelivery(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) (bool, error) {
+	var cod bool
+	err := tx.QueryRow(ctx, `
+SELECT EXISTS (SELECT 1 FROM payments WHERE order_id=$1 AND provider='cod')
+`, orderID).Scan(&cod)
+	return cod, err
+}
+
+// holdsReservation reports whether a payment_mismatch order's stock is still
+// reserved, going by the status it was held from: a pending_payment order kept
+// its reservation, a failed or cancelled one had it released. The ledger can't
+// tell, since reservations made before it existed carry no order.
+func holdsReservation(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) (bool, error) {
+	var from string
+	err := tx.QueryRow(ctx, `
+SELECT COALESCE(from_status, '')
+FROM order_status_history
+WHERE order_id=$1 AND subject='order' AND to_status=$2
+ORDER BY created_at DESC
+LIMIT 1
+`, orderID, OrderPaymentMismatch).Scan(&from)
+	if err != nil {
+		return false, err
+	}
+	return from == OrderPendingPayment, nil
+}
+
+// transitionPayment moves a payment to status to and records it in the order's
+// history. Same-status moves are no-ops; moves not in the spec return a
+// *TransitionError. It returns the previous status.
+func transitionPayment(ctx context.Context, tx pgx.Tx, paymentID uuid.UUID, to string, actor Actor, note string) (string, error) {
+	var from string
+	var orderID uuid.UUID
+	if err := tx.QueryRow(ctx, `SELECT status, order_id FROM payments WHERE id=$1 FOR UPDATE`, paymentID).Scan(&from, &orderID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	if from == to {
+		return from, nil
+	}
+	if !allowed(paymentTransitions, from, to) {
+		return from, &TransitionError{Subject: "payment", From: from, To: to}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE payments SET status=$2, updated_at=now() WHERE id=$1`, paymentID, to); err != nil {
+		return from, err
+	}
+	return from, recordStatusChange(ctx, tx, orderID, "payment", from, to, actor, note)
+}
+
+// reserveOrderStock reserves every line of an order, failing with
+// ErrInsufficientStock when a variant has too little available stock.
+func reserveOrderStock(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, actor *uuid.UUID, note string) error {
+	lines, err := loadOrderLines(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		var onHand, reserved int
+		if err := tx.QueryRow(ctx, `
+SELECT on_hand, reserved FROM inventory WHERE variant_id=$1 FOR UPDATE
+`, l.VariantID).Scan(&onHand, &reserved); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrInsufficientStock
+			}
+			return err
+		}
+		if onHand-reserved < l.Quantity {
+			return ErrInsufficientStock
+		}
+		if _, _, err := moveInventory(ctx, tx, inventoryMove{
+			VariantID:     l.VariantID,
+			Reason:        MovementReserve,
+			DeltaReserved: l.Quantity,
+			OrderID:       &orderID,
+			ActorUserID:   actor,
+			Note:          note,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) loadStatusHistory(ctx context.Context, orderID uuid.UUID) ([]StatusChange, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT subject, from_status, to_status, actor_user_id, actor_source, note, created_at
+FROM order_status_history
+WHERE order_id=$1
+ORDER BY created_at ASC, id ASC
+`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []StatusChange{}
+	for rows.Next() {
+		var c StatusChange
+		if err := rows.Scan(&c.Subject, &c.FromStatus, &c.ToStatus, &c.ActorUserID, &c.ActorSource, &c.Note, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
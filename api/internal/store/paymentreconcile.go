@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of payment reconciliation issues.
+const (
+	IssueAmountMismatch     = "amount_mismatch"
+	IssueUnknownPayment     = "unknown_payment"
+	IssueOrderNotFound      = "order_not_found"
+	IssueTransitionRejected = "transition_rejected"
+)
+
+// UnsettledPayment is a payment still waiting for its final status.
+type UnsettledPayment struct {
+	ID                uuid.UUID
+	OrderID           uuid.UUID
+	Status            string
+	RazorpayOrderID   string
+	RazorpayPaymentID string
+	AmountINR         int
+	// Currency is the order's currency, which the capture has to match.
+	Currency string
+}
+
+// failedPaymentWindow is how long a failed payment is still looked up at
+// Razorpay, which may capture it after we gave up on it.
+const failedPaymentWindow = 5 * 24 * time.Hour
+
+// ListUnsettledPayments returns created or authorized Razorpay payments, and
+// those that failed within failedPaymentWindow, that have not changed for
+// staleAfter and were not reconciled within it either, least recently
+// reconciled first.
+func (s *Store) ListUnsettledPayments(ctx context.Context, staleAfter time.Duration, limit int) ([]UnsettledPayment, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT p.id, p.order_id, p.status, p.razorpay_order_id, p.razorpay_payment_id, p.amount_inr, o.currency
+FROM payments p
+JOIN orders o ON o.id = p.order_id
+WHERE p.provider = 'razorpay'
+  AND p.status IN ('created','authorized','failed')
+  AND (p.status <> 'failed' OR p.updated_at > now() - make_interval(secs => $3))
+  AND p.razorpay_order_id <> ''
+  AND p.updated_at < now() - make_interval(secs => $1)
+  AND (p.reconciled_at IS NULL OR p.reconciled_at < now() - make_interval(secs => $1))
+ORDER BY p.reconciled_at ASC NULLS FIRST, p.updated_at ASC
+LIMIT $2
+`, staleAfter.Seconds(), limit, failedPaymentWindow.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []UnsettledPayment{}
+	for rows.Next() {
+		var p UnsettledPayment
+		if err := rows.Scan(&p.ID, &p.OrderID, &p.Status, &p.RazorpayOrderID, &p.RazorpayPaymentID, &p.AmountINR, &p.Currency); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// ListPendingRefunds returns refunds of Razorpay payments that have been
+// pending for staleAfter and were not reconciled within it either, least
+// recently reconciled first, so refunds Razorpay keeps pending for days do
+// not crowd out newer ones.
+func (s *Store) ListPendingRefunds(ctx context.Context, staleAfter time.Duration, limit int) ([]Refund, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT r.id, r.payment_id, r.status, r.amount_inr, p.provider, r.razorpay_refund_id, p.razorpay_payment_id,
+       r.restock, r.reason, r.failure_reason, r.created_at
+FROM refunds r
+JOIN payments p ON p.id = r.payment_id
+WHERE r.status = 'pending'
+  AND p.provider = 'razorpay'
+  AND p.razorpay_payment_id <> ''
+  AND r.updated_at < now() - make_interval(secs => $1)
+  AND (r.reconciled_at IS NULL OR r.reconciled_at < now() - make_interval(secs => $1))
+ORDER BY r.reconciled_at ASC NULLS FIRST, r.updated_at ASC
+LIMIT $2
+`, staleAfter.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Refund{}
+	for rows.Next() {
+		var rf Refund
+		if err := rows.Scan(&rf.ID, &rf.PaymentID, &rf.Status, &rf.AmountINR, &rf.Provider, &rf.RazorpayRefundID, &rf.RazorpayPaymentID,
+			&rf.Restock, &rf.Reason, &rf.FailureReason, &rf.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rf)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) MarkPaymentReconciled(ctx context.Context, paymentID uuid.UUID) error {
+	_, err := s.db.Exec(ctx, `UPDATE payments SET reconciled_at=now() WHERE id=$1`, paymentID)
+	return err
+}
+
+func (s *Store) MarkRefundReconciled(ctx context.Context, refundID uuid.UUID) error {
+	_, err := s.db.Exec(ctx, `UPDATE refunds SET reconciled_at=now() WHERE id=$1`, refundID)
+	return err
+}
+
+type ReconciliationIssue struct {
+	ID                uuid.UUID  `json:"id"`
+	PaymentID         uuid.UUID  `json:"payment_id"`
+	OrderID           uuid.UUID  `json:"order_id"`
+	Kind              string     `json:"kind"`
+	RazorpayPaymentID string     `json:"razorpay_payment_id"`
+	ExpectedAmountINR int        `json:"expected_amount_inr"`
+	ActualAmountINR   int        `json:"actual_amount_inr"`
+	Currency          string     `json:"currency"`
+	Detail            string     `json:"detail"`
+	FirstSeenAt       time.Time  `json:"first_seen_at"`
+	LastSeenAt        time.Time  `json:"last_seen_at"`
+	ResolvedAt        *time.Time `json:"resolved_at,omitempty"`
+}
+
+// RecordReconciliationIssue adds an issue to the report, or refreshes it when
+// the same issue was reported before.
+func (s *Store) RecordReconciliationIssue(ctx context.Context, is ReconciliationIssue) error {
+	_, err := s.db.Exec(ctx, `
+INSERT INTO payment_reconciliation_issues (payment_id, kind, razorpay_payment_id, expected_amount_inr, actual_amount_inr, currency, detail)
+VALUES ($1,$2,$3,$4,$5,$6,$7)
+ON CONFLICT (payment_id, kind, razorpay_payment_id) DO UPDATE SET
+  expected_amount_inr = EXCLUDED.expected_amount_inr,
+  actual_amount_inr = EXCLUDED.actual_amount_inr,
+  currency = EXCLUDED.currency,
+  detail = EXCLUDED.detail,
+  last_seen_at = now()
+`, is.PaymentID, is.Kind, is.RazorpayPaymentID, is.ExpectedAmountINR, is.ActualAmountINR, is.Currency, is.Detail)
+	return err
+}
+
+// AdminListReconciliationIssues returns the mismatch report, most recently
+// seen first. Resolved issues are only included on request.
+func (s *Store) AdminListReconciliationIssues(ctx context.Context, includeResolved bool, limit int) ([]ReconciliationIssue, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := s.db.Query(ctx, `
+SELECT i.id, i.payment_id, p.order_id, i.kind, i.razorpay_payment_id, i.expected_amount_inr, i.actual_amount_inr,
+       i.currency, i.detail, i.first_seen_at, i.last_seen_at, i.resolved_at
+FROM payment_reconciliation_issues i
+JOIN payments p ON p.id = i.payment_id
+WHERE $1 OR i.resolved_at IS NULL
+ORDER BY i.last_seen_at DESC
+LIMIT $2
+`, includeResolved, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ReconciliationIssue{}
+	for rows.Next() {
+		var is ReconciliationIssue
+		if err := rows.Scan(&is.ID, &is.PaymentID, &is.OrderID, &is.Kind, &is.RazorpayPaymentID, &is.ExpectedAmountINR, &is.ActualAmountINR,
+			&is.Currency, &is.Detail, &is.FirstSeenAt, &is.LastSeenAt, &is.ResolvedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, is)
+	}
+	return out, rows.Err()
+}
+
+// AdminResolveReconciliationIssue marks an issue as handled. It stays resolved
+// even if a later run sees it again.
+func (s *Store) AdminResolveReconciliationIssue(ctx context.Context, issueID, actorUserID uuid.UUID) error {
+	ct, err := s.db.Exec(ctx, `
+UPDATE payment_reconciliation_issues
+SET resolved_at=COALESCE(resolved_at, now()), resolved_by=COALESCE(resolved_by, $2)
+WHERE id=$1
+`, issueID, actorUserID)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
@@ -0,0 +1,347 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Refund statuses (refunds.status), mirroring Razorpay's.
+const (
+	RefundPending   = "pending"
+	RefundProcessed = "processed"
+	RefundFailed    = "failed"
+)
+
+var (
+	ErrNotRefundable    = errors.New("order has no captured payment to refund")
+	ErrRefundAmount     = errors.New("refund amount exceeds the refundable balance")
+	ErrRestockNeedsFull = errors.New("restock requires refunding the full remaining amount")
+)
+
+type Refund struct {
+	ID                uuid.UUID `json:"id"`
+	PaymentID         uuid.UUID `json:"payment_id"`
+	Status            string    `json:"status"`
+	AmountINR         int       `json:"amount_inr"`
+	Provider          string    `json:"provider"`
+	RazorpayRefundID  *string   `json:"razorpay_refund_id"`
+	RazorpayPaymentID string    `json:"razorpay_payment_id"`
+	Restock           bool      `json:"restock"`
+	Reason            string    `json:"reason"`
+	FailureReason     string    `json:"failure_reason,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// refundableStatuses are the order statuses whose captured payment can be
+// refunded.
+var refundableStatuses = []string{OrderPaymentMismatch, OrderPaid, OrderPartiallyShipped, OrderShipped, OrderFulfilled}
+
+// AdminCreateRefund records a pending refund of amountINR (0 for everything not
+// yet refunded) against the order's captured payment. The caller submits it to
+// the payment provider and then reports the outcome with SetRefundSubmitted,
+// MarkRefundProcessed or MarkRefundFailed. Restock puts the order's lines back
+// into stock once the payment is fully refunded, so it is only accepted for a
+// refund of the whole remaining amount.
+func (s *Store) AdminCreateRefund(ctx context.Context, orderID uuid.UUID, amountINR int, restock bool, actor Actor, reason string) (Refund, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Refund{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	rf, err := createRefund(ctx, tx, orderID, amountINR, restock, actor, reason)
+	if err != nil {
+		return Refund{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Refund{}, err
+	}
+	return rf, nil
+}
+
+// createRefund records a pending refund for AdminCreateRefund within tx.
+func createRefund(ctx context.Context, tx pgx.Tx, orderID uuid.UUID, amountINR int, restock bool, actor Actor, reason string) (Refund, error) {
+	paymentID, payStatus, err := lockOrderPayment(ctx, tx, orderID)
+	if err != nil {
+		return Refund{}, err
+	}
+	if paymentID == uuid.Nil || payStatus != PaymentCaptured {
+		return Refund{}, ErrNotRefundable
+	}
+	var orderStatus, provider, razorpayPaymentID string
+	var paid, refunded int
+	err = tx.QueryRow(ctx, `
+SELECT o.status, p.provider, p.razorpay_payment_id, COALESCE(p.captured_amount_inr, p.amount_inr),
+       COALESCE((SELECT SUM(r.amount_inr) FROM refunds r WHERE r.payment_id = p.id AND r.status <> 'failed'), 0)
+FROM payments p
+JOIN orders o ON o.id = p.order_id
+WHERE p.id=$1
+`, paymentID).Scan(&orderStatus, &provider, &razorpayPaymentID, &paid, &refunded)
+	if err != nil {
+		return Refund{}, err
+	}
+	if !slices.Contains(refundableStatuses, orderStatus) {
+		return Refund{}, ErrNotRefundable
+	}
+	remaining := paid - refunded
+	if amountINR == 0 {
+		amountINR = remaining
+	}
+	if amountINR <= 0 || amountINR > remaining {
+		return Refund{}, ErrRefundAmount
+	}
+	if restock && amountINR != remaining {
+		return Refund{}, ErrRestockNeedsFull
+	}
+
+	rf := Refund{
+		PaymentID:         paymentID,
+		Status:            RefundPending,
+		AmountINR:         amountINR,
+		Provider:          provider,
+		RazorpayPaymentID: razorpayPaymentID,
+		Restock:           restock,
+		Reason:            reason,
+	}
+	err = tx.QueryRow(ctx, `
+INSERT INTO refunds (payment_id, status, amount_inr, restock, reason, actor_user_id)
+VALUES ($1, 'pending', $2, $3, $4, $5)
+RETURNING id, created_at
+`, paymentID, amountINR, restock, reason, actor.UserID).Scan(&rf.ID, &rf.CreatedAt)
+	if err != nil {
+		return Refund{}, err
+	}
+	return rf, nil
+}
+
+// SetRefundSubmitted stores the gateway's id for a refund we created.
+func (s *Store) SetRefundSubmitted(ctx context.Context, refundID uuid.UUID, razorpayRefundID string) error {
+	ct, err := s.db.Exec(ctx, `
+UPDATE refunds
+SET razorpay_refund_id=$2, updated_at=now()
+WHERE id=$1
+`, refundID, razorpayRefundID)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ProviderRefund identifies a refund reported by a payment provider: its refund
+// and payment ids (stored in the razorpay_* columns), and the receipt carrying
+// our refund id when the refund was issued through AdminCreateRefund. Refunds
+// made from the Razorpay dashboard are matched by payment instead.
+type ProviderRefund struct {
+	ID        string
+	PaymentID string
+	Receipt   string
+	AmountINR int
+}
+
+// MarkRefundProcessed settles a refund. Once the processed refunds cover the
+// whole payment, the payment and its order move to refunded and, if the final
+// refund asked for it, the order's lines are restocked. Unknown refunds of a
+// known payment are recorded as they arrive.
+func (s *Store) MarkRefundProcessed(ctx context.Context, rr ProviderRefund, actor Actor) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rf, err := lockRefund(ctx, tx, rr)
+	if errors.Is(err, ErrNotFound) && rr.ID != "" && rr.PaymentID != "" && rr.AmountINR > 0 {
+		rf, err = insertExternalRefund(ctx, tx, rr)
+	}
+	if err != nil {
+		return err
+	}
+	if rf.Status == RefundProcessed {
+		return tx.Commit(ctx)
+	}
+	_, err = tx.Exec(ctx, `
+UPDATE refunds
+SET status='processed', razorpay_refund_id=COALESCE(NULLIF($2, ''), razorpay_refund_id), failure_reason='', updated_at=now()
+WHERE id=$1
+`, rf.ID, rr.ID)
+	if err != nil {
+		return err
+	}
+
+	var orderID uuid.UUID
+	var paid, refunded int
+	err = tx.QueryRow(ctx, `
+SELECT p.order_id, COALESCE(p.captured_amount_inr, p.amount_inr),
+       COALESCE((SELECT SUM(r.amount_inr) FROM refunds r WHERE r.payment_id = p.id AND r.status = 'processed'), 0)
+FROM payments p
+WHERE p.id=$1
+`, rf.PaymentID).Scan(&orderID, &paid, &refunded)
+	if err != nil {
+		return err
+	}
+	if refunded < paid {
+		return tx.Commit(ctx)
+	}
+
+	note := rf.Reason
+	if note == "" {
+		note = "refund processed"
+	}
+	if _, err := transitionPayment(ctx, tx, rf.PaymentID, PaymentRefunded, actor, note); err != nil {
+		return err
+	}
+	from, err := transitionOrder(ctx, tx, orderID, OrderRefunded, actor, note)
+	if err != nil {
+		return err
+	}
+	// A payment_mismatch order never committed its stock; refunding it
+	// released the reservation instead.
+	if rf.Restock && from != OrderRefunded && from != OrderPaymentMismatch {
+		if err := restockOrder(ctx, tx, orderID, rf.ActorUserID, note); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// MarkRefundFailed records that the gateway could not complete a refund, which
+// frees its amount to be refunded again.
+func (s *Store) MarkRefundFailed(ctx context.Context, rr ProviderRefund, failureReason string) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rf, err := lockRefund(ctx, tx, rr)
+	if err != nil {
+		return err
+	}
+	if rf.Status != RefundPending {
+		return tx.Commit(ctx)
+	}
+	_, err = tx.Exec(ctx, `
+UPDATE refunds
+SET status='failed', razorpay_refund_id=COALESCE(NULLIF($2, ''), razorpay_refund_id), failure_reason=$3, updated_at=now()
+WHERE id=$1
+`, rf.ID, rr.ID, failureReason)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+type lockedRefund struct {
+	ID          uuid.UUID
+	PaymentID   uuid.UUID
+	Status      string
+	Restock     bool
+	Reason      string
+	ActorUserID *uuid.UUID
+}
+
+// lockRefund finds a refund by our id (the receipt) or by Razorpay's id and
+// locks its payment, then the refund itself.
+func lockRefund(ctx context.Context, tx pgx.Tx, rr ProviderRefund) (lockedRefund, error) {
+	var rf lockedRefund
+	receipt, _ := uuid.Parse(rr.Receipt)
+	err := tx.QueryRow(ctx, `
+SELECT id, payment_id
+FROM refunds
+WHERE id=$1 OR (razorpay_refund_id IS NOT NULL AND razorpay_refund_id=$2)
+LIMIT 1
+`, receipt, rr.ID).Scan(&rf.ID, &rf.PaymentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return lockedRefund{}, ErrNotFound
+		}
+		return lockedRefund{}, err
+	}
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM payments WHERE id=$1 FOR UPDATE`, rf.PaymentID); err != nil {
+		return lockedRefund{}, err
+	}
+	err = tx.QueryRow(ctx, `
+SELECT status, restock, reason, actor_user_id
+FROM refunds
+WHERE id=$1
+FOR UPDATE
+`, rf.ID).Scan(&rf.Status, &rf.Restock, &rf.Reason, &rf.ActorUserID)
+	if err != nil {
+		return lockedRefund{}, err
+	}
+	return rf, nil
+}
+
+// insertExternalRefund records a refund that was issued outside this API, e.g.
+// from the Razorpay dashboard.
+func insertExternalRefund(ctx context.Context, tx pgx.Tx, rr ProviderRefund) (lockedRefund, error) {
+	rf := lockedRefund{Status: RefundPending, Reason: "refunded in Razorpay"}
+	err := tx.QueryRow(ctx, `
+SELECT id
+FROM payments
+WHERE razorpay_payment_id=$1
+FOR UPDATE
+`, rr.PaymentID).Scan(&rf.PaymentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return lockedRefund{}, ErrNotFound
+		}
+		return lockedRefund{}, err
+	}
+	err = tx.QueryRow(ctx, `
+INSERT INTO refunds (payment_id, status, amount_inr, razorpay_refund_id, reason)
+VALUES ($1, 'pending', $2, $3, $4)
+RETURNING id
+`, rf.PaymentID, rr.AmountINR, rr.ID, rf.Reason).Scan(&rf.ID)
+	if err != nil {
+		return lockedRefund{}, err
+	}
+	return rf, nil
+}
+
+func (s *Store) loadOrderRefunds(ctx context.Context, orderID uuid.UUID) ([]Refund, error) {
+	rows, err := s.db.Query(ctx, `
+SELECT r.id, r.payment_id, r.status, r.amount_inr, p.provider, r.razorpay_refund_id, p.razorpay_payment_id,
+       r.restock, r.reason, r.failure_reason, r.created_at
+FROM refunds r
+JOIN payments p ON p.id = r.payment_id
+WHERE p.order_id=$1
+ORDER BY r.created_at ASC
+`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Refund{}
+	for rows.Next() {
+		var rf Refund
+		if err := rows.Scan(&rf.ID, &rf.PaymentID, &rf.Status, &rf.AmountINR, &rf.Provider, &rf.RazorpayRefundID, &rf.RazorpayPaymentID,
+			&rf.Restock, &rf.Reason, &rf.FailureReason, &rf.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, rf)
+	}
+	return out, rows.Err()
+}
+
+// refundableINR returns what is left to refund of a payment: the captured
+// amount less the refunds that have not failed.
+func refundableINR(ctx context.Context, tx pgx.Tx, paymentID uuid.UUID) (int, error) {
+	var remaining int
+	err := tx.QueryRow(ctx, `
+SELECT COALESCE(p.captured_amount_inr, p.amount_inr)
+       - COALESCE((SELECT SUM(r.amount_inr) FROM refunds r WHERE r.payment_id = p.id AND r.status <> 'failed'), 0)
+FROM payments p
+WHERE p.id=$1
+`, paymentID).Scan(&remaining)
+	return remaining, err
+}
+
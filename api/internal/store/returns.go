@@ -0,0 +1,848 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Return statuses (returns.status).
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+	ReturnRejected  = "rejected"
+	ReturnReceived  = "received"
+	ReturnCompleted = "completed"
+	ReturnCancelled = "cancelled"
+)
+
+// Return resolutions (returns.resolution).
+const (
+	ResolutionRefund      = "refund"
+	ResolutionStoreCredit = "store_credit"
+	ResolutionExchange    = "exchange"
+)
+
+// Who opened a return (returns.opened_by).
+const (
+	OpenedByCustomer = "customer"
+	OpenedByAdmin    = "admin"
+)
+
+var (
+	// ErrNotReturnable is returned for returns of orders or items that have
+	// not been delivered, or whose return window has closed.
+	ErrNotReturnable = errors.New("items cannot be returned")
+	// ErrInvalidReturn is wrapped with the reason a return was rejected.
+	ErrInvalidReturn = errors.New("invalid return")
+)
+
+// returnableStatuses are the order statuses whose delivered items can be
+// returned.
+var returnableStatuses = []string{OrderPartiallyShipped, OrderShipped, OrderFulfilled}
+
+// returnTransitions are the status changes admins make on a return;
+// inspection moves a received return to completed (or rejected when nothing
+// is accepted).
+var returnTransitions = map[string][]string{
+	ReturnRequested: {ReturnApproved, ReturnRejected, ReturnCancelled},
+	ReturnApproved:  {ReturnReceived, ReturnRejected, ReturnCancelled},
+	ReturnReceived:  {ReturnRejected},
+}
+
+type Return struct {
+	ID         uuid.UUID    `json:"id"`
+	OrderID    uuid.UUID    `json:"order_id"`
+	Status     string       `json:"status"`
+	Resolution string       `json:"resolution"`
+	Reason     string       `json:"reason"`
+	OpenedBy   string       `json:"opened_by"`
+	Note       string       `json:"note"`
+	Items      []ReturnItem `json:"items"`
+	// AmountINR is the value of the accepted items, refunded or credited.
+	AmountINR       int        `json:"amount_inr"`
+	RefundID        *uuid.UUID `json:"refund_id,omitempty"`
+	CreditCode      *string    `json:"credit_code,omitempty"`
+	ExchangeOrderID *uuid.UUID `json:"exchange_order_id,omitempty"`
+	ApprovedAt      *time.Time `json:"approved_at"`
+	ReceivedAt      *time.Time `json:"received_at"`
+	ClosedAt        *time.Time `json:"closed_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type ReturnItem struct {
+	VariantID         uuid.UUID  `json:"variant_id"`
+	SKU               string     `json:"sku"`
+	Name              string     `json:"name"`
+	Quantity          int        `json:"quantity"`
+	ExchangeVariantID *uuid.UUID `json:"exchange_variant_id,omitempty"`
+	ExchangeSKU       *string    `json:"exchange_sku,omitempty"`
+	AcceptedQuantity  *int       `json:"accepted_quantity"`
+	RestockedQuantity int        `json:"restocked_quantity"`
+}
+
+type ReturnInput struct {
+	Reason     string
+	Resolution string
+	Items      []ReturnItemInput
+}
+
+type ReturnItemInput struct {
+	VariantID uuid.UUID
+	Quantity  int
+	// ExchangeVariantID is the variant wanted instead; required for
+	// exchanges, and it must be another variant of the same product.
+	ExchangeVariantID *uuid.UUID
+}
+
+// OpenCustomerReturn opens a return for the customer who placed the order,
+// identified by the phone number given at checkout. Items must have been
+// delivered within window (0 for no limit); a wrong phone number is reported
+// as ErrNotFound.
+func (s *Store) OpenCustomerReturn(ctx context.Context, orderID uuid.UUID, phone string, in ReturnInput, window time.Duration) (Return, error) {
+	var orderPhone string
+	err := s.db.QueryRow(ctx, `SELECT customer_phone FROM orders WHERE id=$1`, orderID).Scan(&orderPhone)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Return{}, ErrNotFound
+		}
+		return Return{}, err
+	}
+	if !samePhone(phone, orderPhone) {
+		return Return{}, ErrNotFound
+	}
+	return s.openReturn(ctx, orderID, in, OpenedByCustomer, Actor{Source: ActorSourceCustomer}, window)
+}
+
+// AdminOpenReturn opens a return on a customer's behalf; the return window
+// does not apply.
+func (s *Store) AdminOpenReturn(ctx context.Context, orderID uuid.UUID, in ReturnInput, actor Actor) (Return, error) {
+	return s.openReturn(ctx, orderID, in, OpenedByAdmin, actor, 0)
+}
+
+func (s *Store) openReturn(ctx context.Context, orderID uuid.UUID, in ReturnInput, openedBy string, actor Actor, window time.Duration) (Return, error) {
+	in.Reason = strings.TrimSpace(in.Reason)
+	if in.Reason == "" {
+		return Return{}, fmt.Errorf("%w: a reason is required", ErrInvalidReturn)
+	}
+	switch in.Resolution {
+	case ResolutionRefund, ResolutionStoreCredit, ResolutionExchange:
+	default:
+		return Return{}, fmt.Errorf("%w: resolution must be refund, store_credit or exchange", ErrInvalidReturn)
+	}
+	if len(in.Items) == 0 {
+		return Return{}, fmt.Errorf("%w: no items to return", ErrInvalidReturn)
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Return{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the order serialises returns of its lines.
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT status FROM orders WHERE id=$1 FOR UPDATE`, orderID).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Return{}, ErrNotFound
+		}
+		return Return{}, err
+	}
+	if !slices.Contains(returnableStatuses, status) {
+		return Return{}, fmt.Errorf("%w: the order is %s", ErrNotReturnable, status)
+	}
+	if in.Resolution == ResolutionRefund {
+		var captured bool
+		err := tx.QueryRow(ctx, `
+SELECT EXISTS (SELECT 1 FROM payments WHERE order_id=$1 AND status='captured')
+`, orderID).Scan(&captured)
+		if err != nil {
+			return Return{}, err
+		}
+		if !captured {
+			return Return{}, fmt.Errorf("%w: the order has no captured payment to refund", ErrInvalidReturn)
+		}
+	}
+
+	returnable, err := returnableQuantities(ctx, tx, orderID)
+	if err != nil {
+		return Return{}, err
+	}
+	seen := map[uuid.UUID]bool{}
+	wanted := map[uuid.UUID]bool{}
+	variantIDs := make([]uuid.UUID, 0, len(in.Items))
+	for _, it := range in.Items {
+		left, ok := returnable[it.VariantID]
+		switch {
+		case !ok:
+			return Return{}, fmt.Errorf("%w: variant %s is not in the order", ErrInvalidReturn, it.VariantID)
+		case seen[it.VariantID]:
+			return Return{}, fmt.Errorf("%w: variant %s is listed twice", ErrInvalidReturn, it.VariantID)
+		case it.Quantity <= 0:
+			return Return{}, fmt.Errorf("%w: quantity must be positive", ErrInvalidReturn)
+		case it.Quantity > left:
+			return Return{}, fmt.Errorf("%w: only %d of variant %s can be returned", ErrNotReturnable, left, it.VariantID)
+		}
+		seen[it.VariantID] = true
+		variantIDs = append(variantIDs, it.VariantID)
+
+		if in.Resolution != ResolutionExchange {
+			if it.ExchangeVariantID != nil {
+				return Return{}, fmt.Errorf("%w: exchange_variant_id is only for exchanges", ErrInvalidReturn)
+			}
+			continue
+		}
+		if it.ExchangeVariantID == nil {
+			return Return{}, fmt.Errorf("%w: exchanges need an exchange_variant_id for every item", ErrInvalidReturn)
+		}
+		if wanted[*it.ExchangeVariantID] {
+			return Return{}, fmt.Errorf("%w: variant %s is wanted twice", ErrInvalidReturn, *it.ExchangeVariantID)
+		}
+		wanted[*it.ExchangeVariantID] = true
+		if err := checkExchangeVariant(ctx, tx, it.VariantID, *it.ExchangeVariantID); err != nil {
+			return Return{}, err
+		}
+	}
+
+	if window > 0 {
+		// Each item's window runs from the latest delivery of its variant,
+		// so a later shipment does not reopen the window of earlier ones.
+		rows, err := tx.Query(ctx, `
+SELECT si.variant_id, max(sh.delivered_at)
+FROM shipments sh
+JOIN shipment_items si ON si.shipment_id = sh.id
+WHERE sh.order_id=$1 AND sh.status='delivered' AND si.variant_id = ANY($2)
+GROUP BY si.variant_id
+`, orderID, variantIDs)
+		if err != nil {
+			return Return{}, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var variantID uuid.UUID
+			var deliveredAt *time.Time
+			if err := rows.Scan(&variantID, &deliveredAt); err != nil {
+				return Return{}, err
+			}
+			if deliveredAt != nil && time.Now().After(deliveredAt.Add(window)) {
+				return Return{}, fmt.Errorf("%w: the return window of variant %s closed on %s", ErrNotReturnable, variantID, deliveredAt.Add(window).Format("2 Jan 2006"))
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return Return{}, err
+		}
+	}
+
+	var returnID uuid.UUID
+	err = tx.QueryRow(ctx, `
+INSERT INTO returns (order_id, resolution, reason, opened_by, actor_user_id)
+VALUES ($1,$2,$3,$4,$5)
+RETURNING id
+`, orderID, in.Resolution, in.Reason, openedBy, actor.UserID).Scan(&returnID)
+	if err != nil {
+		return Return{}, err
+	}
+	for _, it := range in.Items {
+		_, err := tx.Exec(ctx, `
+INSERT INTO return_items (return_id, order_id, variant_id, quantity, exchange_variant_id)
+VALUES ($1,$2,$3,$4,$5)
+`, returnID, orderID, it.VariantID, it.Quantity, it.ExchangeVariantID)
+		if err != nil {
+			return Return{}, err
+		}
+	}
+	return commitReturn(ctx, tx, returnID)
+}
+
+// returnableQuantities returns, per order line, how many delivered items are
+// not part of another return. Rejected and cancelled returns free their
+// items; completed ones keep what was accepted.
+func returnableQuantities(ctx context.Context, tx pgx.Tx, orderID uuid.UUID) (map[uuid.UUID]int, error) {
+	lines, err := loadLineFulfillment(ctx, tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uuid.UUID]int, len(lines))
+	for _, l := range lines {
+		out[l.VariantID] = l.DeliveredQuantity
+	}
+	rows, err := tx.Query(ctx, `
+SELECT ri.variant_id, SUM(CASE WHEN r.status = 'completed' THEN COALESCE(ri.accepted_quantity, 0) ELSE ri.quantity END)
+FROM return_items ri
+JOIN returns r ON r.id = ri.return_id
+WHERE ri.order_id=$1 AND r.status NOT IN ('rejected','cancelled')
+GROUP BY ri.variant_id
+`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var variantID uuid.UUID
+		var returned int
+		if err := rows.Scan(&variantID, &returned); err != nil {
+			return nil, err
+		}
+		out[variantID] -= returned
+	}
+	return out, rows.Err()
+}
+
+// checkExchangeVariant checks that want is another, active variant of the
+// product of variant have.
+func checkExchangeVariant(ctx context.Context, tx pgx.Tx, have, want uuid.UUID) error {
+	if have == want {
+		return fmt.Errorf("%w: an exchange must be for a different variant", ErrInvalidReturn)
+	}
+	var sameProduct bool
+	var productStatus string
+	err := tx.QueryRow(ctx, `
+SELECT w.product_id = h.product_id, p.status
+FROM product_variants w
+JOIN products p ON p.id = w.product_id
+JOIN product_variants h ON h.id = $1
+WHERE w.id=$2
+`, have, want).Scan(&sameProduct, &productStatus)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: variant %s does not exist", ErrInvalidReturn, want)
+		}
+		return err
+	}
+	if !sameProduct {
+		return fmt.Errorf("%w: variant %s is not of the same product", ErrInvalidReturn, want)
+	}
+	if productStatus != "active" {
+		return fmt.Errorf("%w: variant %s is not available", ErrInvalidReturn, want)
+	}
+	return nil
+}
+
+// AdminApproveReturn approves a requested return; the customer can send the
+// items back.
+func (s *Store) AdminApproveReturn(ctx context.Context, returnID uuid.UUID, note string) (Return, error) {
+	return s.moveReturn(ctx, returnID, ReturnApproved, note)
+}
+
+// AdminReceiveReturn records that a return's items have arrived, ready for
+// inspection.
+func (s *Store) AdminReceiveReturn(ctx context.Context, returnID uuid.UUID, note string) (Return, error) {
+	return s.moveReturn(ctx, returnID, ReturnReceived, note)
+}
+
+// AdminRejectReturn rejects a return that has not been inspected; its items
+// can be returned again.
+func (s *Store) AdminRejectReturn(ctx context.Context, returnID uuid.UUID, note string) (Return, error) {
+	return s.moveReturn(ctx, returnID, ReturnRejected, note)
+}
+
+// AdminCancelReturn cancels a return whose items have not been received.
+func (s *Store) AdminCancelReturn(ctx context.Context, returnID uuid.UUID, note string) (Return, error) {
+	return s.moveReturn(ctx, returnID, ReturnCancelled, note)
+}
+
+func (s *Store) moveReturn(ctx context.Context, returnID uuid.UUID, to, note string) (Return, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Return{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var from string
+	if err := tx.QueryRow(ctx, `SELECT status FROM returns WHERE id=$1 FOR UPDATE`, returnID).Scan(&from); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Return{}, ErrNotFound
+		}
+		return Return{}, err
+	}
+	if from == to {
+		return commitReturn(ctx, tx, returnID)
+	}
+	if !allowed(returnTransitions, from, to) {
+		return Return{}, &TransitionError{Subject: "return", From: from, To: to}
+	}
+	_, err = tx.Exec(ctx, `
+UPDATE returns
+SET status=$2,
+    note=CASE WHEN $3 = '' THEN note ELSE $3 END,
+    approved_at=CASE WHEN $2 = 'approved' THEN now() ELSE approved_at END,
+    received_at=CASE WHEN $2 = 'received' THEN now() ELSE received_at END,
+    closed_at=CASE WHEN $2 IN ('rejected','cancelled') THEN now() ELSE closed_at END,
+    updated_at=now()
+WHERE id=$1
+`, returnID, to, strings.TrimSpace(note))
+	if err != nil {
+		return Return{}, err
+	}
+	return commitReturn(ctx, tx, returnID)
+}
+
+// InspectionItem is the outcome of inspecting a returned line.
+type InspectionItem struct {
+	VariantID        uuid.UUID
+	AcceptedQuantity int
+	RestockQuantity  int // of the accepted items, put back into stock
+}
+
+type InspectionInput struct {
+	// Resolution overrides the one asked for; empty keeps it.
+	Resolution string
+	Note       string
+	// Lines not listed are accepted in full and not restocked.
+	Items []InspectionItem
+}
+
+// AdminInspectReturn settles a received return. Accepted items that are fit
+// for sale are restocked, and the value paid for the accepted items is
+// refunded, credited as a single-use discount code, or replaced by an
+// exchange order of the wanted variants that is paid and ready to ship. A
+// refund is returned pending; the caller submits it to the payment provider
+// as for AdminCreateRefund. Returns with nothing accepted are rejected.
+func (s *Store) AdminInspectReturn(ctx context.Context, returnID uuid.UUID, in InspectionInput, actor Actor) (Return, *Refund, error) {
+	var orderID uuid.UUID
+	if err := s.db.QueryRow(ctx, `SELECT order_id FROM returns WHERE id=$1`, returnID).Scan(&orderID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Return{}, nil, ErrNotFound
+		}
+		return Return{}, nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Return{}, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Payment, then order, then the return, as for refunds.
+	paymentID, payStatus, err := lockOrderPayment(ctx, tx, orderID)
+	if err != nil {
+		return Return{}, nil, err
+	}
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM orders WHERE id=$1 FOR UPDATE`, orderID); err != nil {
+		return Return{}, nil, err
+	}
+	var status, resolution string
+	err = tx.QueryRow(ctx, `SELECT status, resolution FROM returns WHERE id=$1 FOR UPDATE`, returnID).Scan(&status, &resolution)
+	if err != nil {
+		return Return{}, nil, err
+	}
+	if status != ReturnReceived {
+		return Return{}, nil, &TransitionError{Subject: "return", From: status, To: ReturnCompleted}
+	}
+	switch in.Resolution {
+	case "":
+	case ResolutionRefund, ResolutionStoreCredit:
+		resolution = in.Resolution
+	default:
+		// Exchanges need the wanted variants, which are chosen when the
+		// return is opened.
+		return Return{}, nil, fmt.Errorf("%w: resolution can only be changed to refund or store_credit", ErrInvalidReturn)
+	}
+
+	lines, err := loadReturnLines(ctx, tx, returnID)
+	if err != nil {
+		return Return{}, nil, err
+	}
+	for _, it := range in.Items {
+		i := slices.IndexFunc(lines, func(l returnLine) bool { return l.VariantID == it.VariantID })
+		switch {
+		case i < 0:
+			return Return{}, nil, fmt.Errorf("%w: variant %s is not in the return", ErrInvalidReturn, it.VariantID)
+		case it.AcceptedQuantity < 0 || it.AcceptedQuantity > lines[i].Quantity:
+			return Return{}, nil, fmt.Errorf("%w: accepted_quantity of variant %s must be between 0 and %d", ErrInvalidReturn, it.VariantID, lines[i].Quantity)
+		case it.RestockQuantity < 0 || it.RestockQuantity > it.AcceptedQuantity:
+			return Return{}, nil, fmt.Errorf("%w: restock_quantity of variant %s must be between 0 and accepted_quantity", ErrInvalidReturn, it.VariantID)
+		}
+		lines[i].Accepted, lines[i].Restocked = it.AcceptedQuantity, it.RestockQuantity
+		lines[i].inspected = true
+	}
+
+	note := strings.TrimSpace(in.Note)
+	movementNote := "return " + returnID.String()
+	amount, accepted := 0, 0
+	for i := range lines {
+		l := &lines[i]
+		if !l.inspected {
+			l.Accepted = l.Quantity
+		}
+		_, err := tx.Exec(ctx, `
+UPDATE return_items SET accepted_quantity=$3, restocked_quantity=$4 WHERE return_id=$1 AND variant_id=$2
+`, returnID, l.VariantID, l.Accepted, l.Restocked)
+		if err != nil {
+			return Return{}, nil, err
+		}
+		if l.Restocked > 0 {
+			if _, _, err := moveInventory(ctx, tx, inventoryMove{
+				VariantID:   l.VariantID,
+				Reason:      MovementRestock,
+				DeltaOnHand: l.Restocked,
+				OrderID:     &orderID,
+				ActorUserID: actor.UserID,
+				Note:        movementNote,
+			}); err != nil {
+				return Return{}, nil, err
+			}
+		}
+		// What the customer paid per item, after discounts and with tax;
+		// shipping is not refunded.
+		amount += l.PaidINR * l.Accepted / l.OrderedQuantity
+		accepted += l.Accepted
+	}
+
+	if accepted == 0 {
+		_, err = tx.Exec(ctx, `
+UPDATE returns
+SET status='rejected', note=CASE WHEN $2 = '' THEN 'no items accepted' ELSE $2 END, closed_at=now(), updated_at=now()
+WHERE id=$1
+`, returnID, note)
+		if err != nil {
+			return Return{}, nil, err
+		}
+		rt, err := commitReturn(ctx, tx, returnID)
+		return rt, nil, err
+	}
+
+	var refund *Refund
+	var creditID, exchangeOrderID *uuid.UUID
+	switch resolution {
+	case ResolutionRefund:
+		if paymentID == uuid.Nil || payStatus != PaymentCaptured {
+			return Return{}, nil, ErrNotRefundable
+		}
+		remaining, err := refundableINR(ctx, tx, paymentID)
+		if err != nil {
+			return Return{}, nil, err
+		}
+		// Earlier refunds of the order may have covered some of it.
+		amount = min(amount, remaining)
+		if amount <= 0 {
+			return Return{}, nil, fmt.Errorf("%w: the order has nothing left to refund", ErrInvalidReturn)
+		}
+		rf, err := createRefund(ctx, tx, orderID, amount, false, actor, movementNote)
+		if err != nil {
+			return Return{}, nil, err
+		}
+		refund = &rf
+	case ResolutionStoreCredit:
+		if amount <= 0 {
+			return Return{}, nil, fmt.Errorf("%w: the accepted items have no value to credit", ErrInvalidReturn)
+		}
+		id, err := createStoreCredit(ctx, tx, returnID, amount)
+		if err != nil {
+			return Return{}, nil, err
+		}
+		creditID = &id
+	case ResolutionExchange:
+		id, err := createExchangeOrder(ctx, tx, orderID, returnID, lines, actor)
+		if err != nil {
+			return Return{}, nil, err
+		}
+		exchangeOrderID = &id
+	}
+
+	var refundID *uuid.UUID
+	if refund != nil {
+		refundID = &refund.ID
+	}
+	_, err = tx.Exec(ctx, `
+UPDATE returns
+SET status='completed', resolution=$2, note=CASE WHEN $3 = '' THEN note ELSE $3 END, amount_inr=$4,
+    refund_id=$5, credit_discount_id=$6, exchange_order_id=$7, closed_at=now(), updated_at=now()
+WHERE id=$1
+`, returnID, resolution, note, amount, refundID, creditID, exchangeOrderID)
+	if err != nil {
+		return Return{}, nil, err
+	}
+	rt, err := commitReturn(ctx, tx, returnID)
+	if err != nil {
+		return Return{}, nil, err
+	}
+	return rt, refund, nil
+}
+
+type returnLine struct {
+	VariantID         uuid.UUID
+	Quantity          int
+	ExchangeVariantID *uuid.UUID
+	OrderedQuantity   int
+	UnitPriceINR      int
+	PaidINR           int // for the whole order line
+	Accepted          int
+	Restocked         int
+	inspected         bool
+}
+
+func loadReturnLines(ctx context.Context, tx pgx.Tx, returnID uuid.UUID) ([]returnLine, error) {
+	rows, err := tx.Query(ctx, `
+SELECT ri.variant_id, ri.quantity, ri.exchange_variant_id, oi.quantity, oi.unit_price_inr,
+       oi.taxable_value_inr + oi.cgst_inr + oi.sgst_inr + oi.igst_inr
+FROM return_items ri
+JOIN order_items oi ON oi.order_id = ri.order_id AND oi.variant_id = ri.variant_id
+WHERE ri.return_id=$1
+ORDER BY oi.sku
+`, returnID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []returnLine
+	for rows.Next() {
+		var l returnLine
+		if err := rows.Scan(&l.VariantID, &l.Quantity, &l.ExchangeVariantID, &l.OrderedQuantity, &l.UnitPriceINR, &l.PaidINR); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// creditCodeAlphabet leaves out characters that are easily confused.
+const creditCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// createStoreCredit issues store credit worth amountINR as a fixed discount
+// code that can be used once, on any order.
+func createStoreCredit(ctx context.Context, tx pgx.Tx, returnID uuid.UUID, amountINR int) (uuid.UUID, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return uuid.Nil, err
+	}
+	for i := range b {
+		b[i] = creditCodeAlphabet[int(b[i])%len(creditCodeAlphabet)]
+	}
+	var id uuid.UUID
+	err := tx.QueryRow(ctx, `
+INSERT INTO discounts (code, name, kind, value, usage_limit, active)
+VALUES ($1, $2, 'fixed', $3, 1, true)
+RETURNING id
+`, "CREDIT-"+string(b), "Store credit for return "+returnID.String()[:8], amountINR).Scan(&id)
+	return id, err
+}
+
+// createExchangeOrder creates the order shipping the wanted variants of a
+// return's accepted items to the original address. Its lines keep the prices
+// of the returned ones but are discounted in full, so it costs nothing, is
+// not invoiced and has no payment; it goes straight to paid, committing its
+// stock (ErrInsufficientStock if short).
+func createExchangeOrder(ctx context.Context, tx pgx.Tx, orderID, returnID uuid.UUID, lines []returnLine, actor Actor) (uuid.UUID, error) {
+	subtotal := 0
+	for _, l := range lines {
+		subtotal += l.UnitPriceINR * l.Accepted
+	}
+	var exchangeID uuid.UUID
+	err := tx.QueryRow(ctx, `
+INSERT INTO orders (
+  status, currency, subtotal_inr, discount_inr, shipping_inr, tax_inr, total_inr,
+  customer_name, customer_phone, customer_email, shipping_address, seller_state, place_of_supply,
+  customer_user_id, exchange_for_return_id
+)
+SELECT 'draft', currency, $2::int, $2::int, 0, 0, 0,
+       customer_name, customer_phone, customer_email, shipping_address, seller_state, place_of_supply,
+       customer_user_id, $3::uuid
+FROM orders
+WHERE id=$1
+RETURNING id
+`, orderID, subtotal, returnID).Scan(&exchangeID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	note := "exchange for return " + returnID.String()
+	if err := recordStatusChange(ctx, tx, exchangeID, "order", "", OrderDraft, actor, note); err != nil {
+		return uuid.Nil, err
+	}
+	for _, l := range lines {
+		if l.Accepted == 0 {
+			continue
+		}
+		lineTotal := l.UnitPriceINR * l.Accepted
+		_, err := tx.Exec(ctx, `
+INSERT INTO order_items (
+  order_id, variant_id, sku, product_name, variant_title, unit_price_inr, quantity, line_total_inr, discount_inr, hsn_code
+)
+SELECT $1::uuid, v.id, v.sku, p.name, v.title, $3::int, $4::int, $5::int, $5::int, p.hsn_code
+FROM product_variants v
+JOIN products p ON p.id = v.product_id
+WHERE v.id=$2
+`, exchangeID, *l.ExchangeVariantID, l.UnitPriceINR, l.Accepted, lineTotal)
+		if err != nil {
+			return uuid.Nil, err
+		}
+	}
+	if _, err := transitionOrder(ctx, tx, exchangeID, OrderPendingPayment, actor, note); err != nil {
+		return uuid.Nil, err
+	}
+	if _, err := transitionOrder(ctx, tx, exchangeID, OrderPaid, actor, note); err != nil {
+		return uuid.Nil, err
+	}
+	return exchangeID, nil
+}
+
+// samePhone compares phone numbers by their last ten digits, so "+91 98765
+// 43210" matches "9876543210".
+func samePhone(a, b string) bool {
+	digits := func(s string) string {
+		var d []byte
+		for i := 0; i < len(s); i++ {
+			if s[i] >= '0' && s[i] <= '9' {
+				d = append(d, s[i])
+			}
+		}
+		if len(d) > 10 {
+			d = d[len(d)-10:]
+		}
+		return string(d)
+	}
+	da := digits(a)
+	return len(da) >= 10 && da == digits(b)
+}
+
+// commitReturn commits tx and returns the return as committed.
+func commitReturn(ctx context.Context, tx pgx.Tx, returnID uuid.UUID) (Return, error) {
+	rt, err := getReturn(ctx, tx, returnID)
+	if err != nil {
+		return Return{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Return{}, err
+	}
+	return rt, nil
+}
+
+func (s *Store) GetReturn(ctx context.Context, returnID uuid.UUID) (Return, error) {
+	return getReturn(ctx, s.db, returnID)
+}
+
+// AdminListReturns lists returns, newest first, optionally only those with
+// status.
+func (s *Store) AdminListReturns(ctx context.Context, status string, limit int) ([]Return, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	return listReturns(ctx, s.db, `
+WHERE ($1 = '' OR r.status = $1)
+ORDER BY r.created_at DESC
+LIMIT $2
+`, status, limit)
+}
+
+// ListCustomerReturns lists an order's returns for the customer who placed
+// it; a wrong phone number is reported as ErrNotFound.
+func (s *Store) ListCustomerReturns(ctx context.Context, orderID uuid.UUID, phone string) ([]Return, error) {
+	var orderPhone string
+	err := s.db.QueryRow(ctx, `SELECT customer_phone FROM orders WHERE id=$1`, orderID).Scan(&orderPhone)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if !samePhone(phone, orderPhone) {
+		return nil, ErrNotFound
+	}
+	return s.loadOrderReturns(ctx, orderID)
+}
+
+func (s *Store) loadOrderReturns(ctx context.Context, orderID uuid.UUID) ([]Return, error) {
+	return listReturns(ctx, s.db, `
+WHERE r.order_id = $1
+ORDER BY r.created_at ASC
+`, orderID)
+}
+
+const returnColumns = `
+SELECT r.id, r.order_id, r.status, r.resolution, r.reason, r.opened_by, r.note, r.amount_inr,
+       r.refund_id, d.code, r.exchange_order_id, r.approved_at, r.received_at, r.closed_at, r.created_at, r.updated_at
+FROM returns r
+LEFT JOIN discounts d ON d.id = r.credit_discount_id
+`
+
+func scanReturn(row pgx.Row) (Return, error) {
+	var rt Return
+	err := row.Scan(&rt.ID, &rt.OrderID, &rt.Status, &rt.Resolution, &rt.Reason, &rt.OpenedBy, &rt.Note, &rt.AmountINR,
+		&rt.RefundID, &rt.CreditCode, &rt.ExchangeOrderID, &rt.ApprovedAt, &rt.ReceivedAt, &rt.ClosedAt, &rt.CreatedAt, &rt.UpdatedAt)
+	return rt, err
+}
+
+func getReturn(ctx context.Context, q rowQueryer, returnID uuid.UUID) (Return, error) {
+	rt, err := scanReturn(q.QueryRow(ctx, returnColumns+`
+WHERE r.id=$1
+`, returnID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Return{}, ErrNotFound
+		}
+		return Return{}, err
+	}
+	items, err := loadReturnItems(ctx, q, []uuid.UUID{rt.ID})
+	if err != nil {
+		return Return{}, err
+	}
+	rt.Items = items[rt.ID]
+	return rt, nil
+}
+
+func listReturns(ctx context.Context, q queryer, where string, args ...any) ([]Return, error) {
+	rows, err := q.Query(ctx, returnColumns+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Return{}
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		rt, err := scanReturn(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rt)
+		ids = append(ids, rt.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	items, err := loadReturnItems(ctx, q, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].Items = items[out[i].ID]
+	}
+	return out, nil
+}
+
+// loadReturnItems returns the items of the given returns, by return.
+func loadReturnItems(ctx context.Context, q queryer, returnIDs []uuid.UUID) (map[uuid.UUID][]ReturnItem, error) {
+	rows, err := q.Query(ctx, `
+SELECT ri.return_id, ri.variant_id, oi.sku, oi.product_name || CASE WHEN oi.variant_title = '' THEN '' ELSE ' - ' || oi.variant_title END,
+       ri.quantity, ri.exchange_variant_id, ev.sku, ri.accepted_quantity, ri.restocked_quantity
+FROM return_items ri
+JOIN order_items oi ON oi.order_id = ri.order_id AND oi.variant_id = ri.variant_id
+LEFT JOIN product_variants ev ON ev.id = ri.exchange_variant_id
+WHERE ri.return_id = ANY($1)
+ORDER BY oi.sku
+`, returnIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[uuid.UUID][]ReturnItem{}
+	for rows.Next() {
+		var returnID uuid.UUID
+		var it ReturnItem
+		if err := rows.Scan(&returnID, &it.VariantID, &it.SKU, &it.Name, &it.Quantity, &it.ExchangeVariantID, &it.ExchangeSKU,
+			&it.AcceptedQuantity, &it.RestockedQuantity); err != nil {
+			return nil, err
+		}
+		out[returnID] = append(out[returnID], it)
+	}
+	return out, rows.Err()
+}
+
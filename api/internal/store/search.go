@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// fuzzySearchThreshold is the pg_trgm word similarity a product needs to be
+// returned by the typo-tolerant fallback.
+const fuzzySearchThreshold = "0.3"
+
+type SearchResults struct {
+	Products []Product `json:"products"`
+	// Fuzzy is set when no product matched the full-text query and the
+	// results come from trigram similarity instead.
+	Fuzzy bool `json:"fuzzy"`
+}
+
+// SearchProducts searches active products by name, description, SKU, color and
+// category names. Every query word is matched as a prefix so partial input
+// works for type-ahead; when nothing matches, it falls back to trigram
+// similarity to tolerate typos.
+func (s *Store) SearchProducts(ctx context.Context, query string, limit int) (SearchResults, error) {
+	if limit <= 0 || limit > 50 {
+		limit = 20
+	}
+	words := searchWords(query)
+	if len(words) == 0 {
+		return SearchResults{Products: []Product{}}, nil
+	}
+
+	tsquery := make([]string, 0, len(words))
+	for _, w := range words {
+		tsquery = append(tsquery, w+":*")
+	}
+	rows, err := s.db.Query(ctx, `
+SELECT p.id
+FROM products p, to_tsquery('simple', $1) q
+WHERE p.status = 'active' AND p.search_document @@ q
+ORDER BY ts_rank(p.search_document, q) DESC, p.created_at DESC
+LIMIT $2
+`, strings.Join(tsquery, " & "), limit)
+	if err != nil {
+		return SearchResults{}, err
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return SearchResults{}, err
+	}
+	fuzzy := false
+	if len(ids) == 0 {
+		ids, err = s.fuzzySearchIDs(ctx, strings.Join(words, " "), limit)
+		if err != nil {
+			return SearchResults{}, err
+		}
+		fuzzy = len(ids) > 0
+	}
+
+	products, err := s.loadProductsByIDs(ctx, ids)
+	if err != nil {
+		return SearchResults{}, err
+	}
+	return SearchResults{Products: products, Fuzzy: fuzzy}, nil
+}
+
+func (s *Store) fuzzySearchIDs(ctx context.Context, text string, limit int) ([]uuid.UUID, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The <% operator uses the threshold setting, which keeps the trigram index usable.
+	if _, err := tx.Exec(ctx, `SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)`, fuzzySearchThreshold); err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, `
+SELECT p.id
+FROM products p
+WHERE p.status = 'active' AND $1 <% p.search_text
+ORDER BY word_similarity($1, p.search_text) DESC, p.created_at DESC
+LIMIT $2
+`, text, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+// scanIDs reads a single uuid column from every row and closes rows.
+func scanIDs(rows pgx.Rows) ([]uuid.UUID, error) {
+	defer rows.Close()
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// searchWords splits free-text input into lower-cased letter/digit runs, which
+// are safe to embed in a tsquery.
+func searchWords(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// refreshProductSearch rebuilds the search columns of the given products from
+// their current name, description, variants and categories.
+func refreshProductSearch(ctx context.Context, tx pgx.Tx, productIDs []uuid.UUID) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `
+UPDATE products p SET
+  search_document =
+    setweight(to_tsvector('simple', p.name), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(d.skus, '')), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(d.colors, '') || ' ' || COALESCE(d.categories, '')), 'B') ||
+    setweight(to_tsvector('simple', p.description), 'C'),
+  search_text = lower(concat_ws(' ', p.name, d.skus, d.colors, d.categories))
+FROM (
+  SELECT p2.id,
+    (SELECT string_agg(v.sku, ' ') FROM product_variants v WHERE v.product_id = p2.id) AS skus,
+    (SELECT string_agg(DISTINCT v.color, ' ') FROM product_variants v WHERE v.product_id = p2.id) AS colors,
+    (SELECT string_agg(c.name, ' ') FROM product_categories pc JOIN categories c ON c.id = pc.category_id WHERE pc.product_id = p2.id) AS categories
+  FROM products p2
+  WHERE p2.id = ANY($1)
+) d
+WHERE p.id = d.id
+`, productIDs)
+	return err
+}
+
@@ -0,0 +1,666 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Shipment statuses (shipments.status).
+const (
+	ShipmentShipped   = "shipped"
+	ShipmentDelivered = "delivered"
+	ShipmentCancelled = "cancelled"
+)
+
+// Courier tracking statuses (shipments.tracking_status), normalised from the
+// courier aggregator's own statuses.
+const (
+	TrackingBooked         = "booked"
+	TrackingInTransit      = "in_transit"
+	TrackingOutForDelivery = "out_for_delivery"
+	TrackingDelivered      = "delivered"
+	TrackingException      = "exception" // delivery attempt failed, lost or damaged
+	TrackingReturned       = "returned"  // returned to origin
+	TrackingCancelled      = "cancelled"
+)
+
+var (
+	// ErrNotShippable is returned for shipments of orders that are not paid
+	// or confirmed for cash on delivery.
+	ErrNotShippable = errors.New("order cannot be shipped")
+	// ErrInvalidShipment is wrapped with the reason a shipment was rejected.
+	ErrInvalidShipment     = errors.New("invalid shipment")
+	ErrTrackingNumberTaken = errors.New("tracking number already used by another shipment")
+)
+
+// shippableStatuses are the order statuses that accept new shipments.
+var shippableStatuses = []string{OrderConfirmed, OrderPaid, OrderPartiallyShipped, OrderShipped}
+
+// Shipment is a consignment of some or all of an order's items. Shipments
+// booked through a courier aggregator name it in Provider; others were booked
+// outside the shop.
+type Shipment struct {
+	ID                 uuid.UUID      `json:"id"`
+	OrderID            uuid.UUID      `json:"order_id"`
+	Status             string         `json:"status"`
+	Carrier            string         `json:"carrier"`
+	TrackingNumber     string         `json:"tracking_number"`
+	Note               string         `json:"note"`
+	Items              []ShipmentItem `json:"items"`
+	Provider           string         `json:"provider"`
+	ProviderOrderID    string         `json:"provider_order_id"`
+	ProviderShipmentID string         `json:"provider_shipment_id"`
+	HasLabel           bool           `json:"has_label"`
+	TrackingStatus     string         `json:"tracking_status"`
+	TrackingDetail     string         `json:"tracking_detail"`
+	TrackingUpdatedAt  *time.Time     `json:"tracking_updated_at"`
+	ShippedAt          time.Time      `json:"shipped_at"`
+	DeliveredAt        *time.Time     `json:"delivered_at"`
+	CancelledAt        *time.Time     `json:"cancelled_at"`
+	ActorUserID        *uuid.UUID     `json:"actor_user_id,omitempty"`
+	CreatedAt          time.Time      `json:"created_at"`
+}
+
+// ShipmentItem is a quantity of one order line; order lines are identified by
+// their variant.
+type ShipmentItem struct {
+	VariantID uuid.UUID `json:"variant_id"`
+	SKU       string    `json:"sku"`
+	Quantity  int       `json:"quantity"`
+}
+
+type ShipmentInput struct {
+	ID             uuid.UUID // optional; set when a courier booking refers to it
+	Carrier        string
+	TrackingNumber string
+	Note           string
+	ShippedAt      time.Time
+	// Items to ship; empty ships everything not shipped yet.
+	Items []ShipmentItem
+
+	// Courier aggregator booking, if any.
+	Provider           string
+	ProviderOrderID    string
+	ProviderShipmentID string
+	LabelPDF           []byte
+	TrackingStatus     string
+}
+
+// ShipmentLine is an item of a planned shipment with what a courier needs to
+// know about it.
+type ShipmentLine struct {
+	VariantID    uuid.UUID
+	SKU          string
+	Name         string
+	Quantity     int
+	UnitPriceINR int
+	WeightGrams  int // per unit
+}
+
+// LineFulfillment is how much of an order line has been shipped and delivered.
+type LineFulfillment struct {
+	VariantID         uuid.UUID `json:"variant_id"`
+	SKU               string    `json:"sku"`
+	Quantity          int       `json:"quantity"`
+	ShippedQuantity   int       `json:"shipped_quantity"`
+	DeliveredQuantity int       `json:"delivered_quantity"`
+}
+
+// AdminCreateShipment records a shipment of an order's items and moves the
+// order to partially_shipped or shipped. Each item may ship at most the
+// quantity of its line not yet shipped.
+func (s *Store) AdminCreateShipment(ctx context.Context, orderID uuid.UUID, in ShipmentInput, actor Actor) (Shipment, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Shipment{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	paymentID, payStatus, err := lockOrderPayment(ctx, tx, orderID)
+	if err != nil {
+		return Shipment{}, err
+	}
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT status FROM orders WHERE id=$1 FOR UPDATE`, orderID).Scan(&status); err != nil {
+		return Shipment{}, err
+	}
+	if !slices.Contains(shippableStatuses, status) {
+		return Shipment{}, fmt.Errorf("%w: it is %s", ErrNotShippable, status)
+	}
+
+	lines, err := loadLineFulfillment(ctx, tx, orderID)
+	if err != nil {
+		return Shipment{}, err
+	}
+	items, err := shipmentItems(lines, in.Items)
+	if err != nil {
+		return Shipment{}, err
+	}
+
+	id := in.ID
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+	var trackingUpdatedAt *time.Time
+	if in.TrackingStatus != "" {
+		trackingUpdatedAt = &in.ShippedAt
+	}
+	_, err = tx.Exec(ctx, `
+INSERT INTO shipments (id, order_id, status, carrier, tracking_number, note, shipped_at, actor_user_id,
+                       provider, provider_order_id, provider_shipment_id, label_pdf, tracking_status, tracking_updated_at)
+VALUES ($1, $2, 'shipped', $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+`, id, orderID, in.Carrier, in.TrackingNumber, in.Note, in.ShippedAt, actor.UserID,
+		in.Provider, in.ProviderOrderID, in.ProviderShipmentID, in.LabelPDF, in.TrackingStatus, trackingUpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return Shipment{}, ErrTrackingNumberTaken
+		}
+		return Shipment{}, err
+	}
+	for _, it := range items {
+		if _, err := tx.Exec(ctx, `
+INSERT INTO shipment_items (shipment_id, order_id, variant_id, quantity)
+VALUES ($1, $2, $3, $4)
+`, id, orderID, it.VariantID, it.Quantity); err != nil {
+			return Shipment{}, err
+		}
+	}
+
+	note := "shipped via " + in.Carrier
+	if in.TrackingNumber != "" {
+		note += " (" + in.TrackingNumber + ")"
+	}
+	if err := syncShippingStatus(ctx, tx, orderID, paymentID, payStatus, actor, note); err != nil {
+		return Shipment{}, err
+	}
+	return commitShipment(ctx, tx, id)
+}
+
+// shipmentItems checks the requested items against the order's lines. With
+// no items requested, everything not shipped yet is shipped.
+func shipmentItems(lines []LineFulfillment, requested []ShipmentItem) ([]ShipmentItem, error) {
+	remaining := map[uuid.UUID]LineFulfillment{}
+	for _, l := range lines {
+		remaining[l.VariantID] = l
+	}
+	if len(requested) == 0 {
+		for _, l := range lines {
+			if left := l.Quantity - l.ShippedQuantity; left > 0 {
+				requested = append(requested, ShipmentItem{VariantID: l.VariantID, Quantity: left})
+			}
+		}
+		if len(requested) == 0 {
+			return nil, fmt.Errorf("%w: every item has been shipped", ErrInvalidShipment)
+		}
+	}
+	out := make([]ShipmentItem, 0, len(requested))
+	for _, it := range requested {
+		l, ok := remaining[it.VariantID]
+		if !ok {
+			return nil, fmt.Errorf("%w: variant %s is not in the order or is listed twice", ErrInvalidShipment, it.VariantID)
+		}
+		delete(remaining, it.VariantID)
+		if it.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity of %s must be positive", ErrInvalidShipment, l.SKU)
+		}
+		if left := l.Quantity - l.ShippedQuantity; it.Quantity > left {
+			return nil, fmt.Errorf("%w: only %d of %s left to ship", ErrInvalidShipment, left, l.SKU)
+		}
+		out = append(out, ShipmentItem{VariantID: it.VariantID, SKU: l.SKU, Quantity: it.Quantity})
+	}
+	return out, nil
+}
+
+// PlanShipment checks a shipment of an order's items without recording it
+// and returns what a courier booking needs. With no items, everything not
+// shipped yet is planned. AdminCreateShipment checks the items again.
+func (s *Store) PlanShipment(ctx context.Context, orderID uuid.UUID, items []ShipmentItem) ([]ShipmentLine, error) {
+	var status string
+	if err := s.db.QueryRow(ctx, `SELECT status FROM orders WHERE id=$1`, orderID).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if !slices.Contains(shippableStatuses, status) {
+		return nil, fmt.Errorf("%w: it is %s", ErrNotShippable, status)
+	}
+	lines, err := loadLineFulfillment(ctx, s.db, orderID)
+	if err != nil {
+		return nil, err
+	}
+	items, err = shipmentItems(lines, items)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, `
+SELECT oi.variant_id, oi.product_name, oi.variant_title, oi.unit_price_inr, v.weight_grams
+FROM order_items oi
+JOIN product_variants v ON v.id = oi.variant_id
+WHERE oi.order_id=$1
+`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byVariant := map[uuid.UUID]ShipmentLine{}
+	for rows.Next() {
+		var l ShipmentLine
+		var product, variant string
+		if err := rows.Scan(&l.VariantID, &product, &variant, &l.UnitPriceINR, &l.WeightGrams); err != nil {
+			return nil, err
+		}
+		l.Name = product
+		if variant != "" {
+			l.Name += " - " + variant
+		}
+		byVariant[l.VariantID] = l
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]ShipmentLine, 0, len(items))
+	for _, it := range items {
+		l := byVariant[it.VariantID]
+		l.SKU = it.SKU
+		l.Quantity = it.Quantity
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+// shipmentLock is a shipment locked for an update, with its order's payment.
+type shipmentLock struct {
+	ID        uuid.UUID
+	OrderID   uuid.UUID
+	PaymentID uuid.UUID
+	PayStatus string
+	Status    string
+	ShippedAt time.Time
+}
+
+// lockShipment locks a shipment after its order's payment, matching the lock
+// order of the other order changes.
+func lockShipment(ctx context.Context, tx pgx.Tx, shipmentID uuid.UUID) (shipmentLock, error) {
+	l := shipmentLock{ID: shipmentID}
+	if err := tx.QueryRow(ctx, `SELECT order_id FROM shipments WHERE id=$1`, shipmentID).Scan(&l.OrderID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return l, ErrNotFound
+		}
+		return l, err
+	}
+	var err error
+	l.PaymentID, l.PayStatus, err = lockOrderPayment(ctx, tx, l.OrderID)
+	if err != nil {
+		return l, err
+	}
+	err = tx.QueryRow(ctx, `
+SELECT status, shipped_at FROM shipments WHERE id=$1 FOR UPDATE
+`, shipmentID).Scan(&l.Status, &l.ShippedAt)
+	return l, err
+}
+
+// AdminMarkShipmentDelivered records the delivery of a shipment. Once every
+// item of the order has been delivered the order is fulfilled, which collects
+// the payment of a cash-on-delivery order. Marking a delivered shipment again
+// changes nothing.
+func (s *Store) AdminMarkShipmentDelivered(ctx context.Context, shipmentID uuid.UUID, deliveredAt time.Time, actor Actor) (Shipment, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Shipment{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	l, err := lockShipment(ctx, tx, shipmentID)
+	if err != nil {
+		return Shipment{}, err
+	}
+	switch l.Status {
+	case ShipmentCancelled:
+		return Shipment{}, fmt.Errorf("%w: it was cancelled", ErrInvalidShipment)
+	case ShipmentShipped:
+		if deliveredAt.Before(l.ShippedAt) {
+			return Shipment{}, fmt.Errorf("%w: delivered_at is before shipped_at", ErrInvalidShipment)
+		}
+		if err := markShipmentDelivered(ctx, tx, l, deliveredAt, actor); err != nil {
+			return Shipment{}, err
+		}
+	}
+	return commitShipment(ctx, tx, shipmentID)
+}
+
+// AdminCancelShipment cancels a shipment that has not been delivered; its
+// items count as not shipped again and the order status follows. Cancelling
+// a courier booking with the courier is up to the caller.
+func (s *Store) AdminCancelShipment(ctx context.Context, shipmentID uuid.UUID, actor Actor, reason string) (Shipment, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Shipment{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	l, err := lockShipment(ctx, tx, shipmentID)
+	if err != nil {
+		return Shipment{}, err
+	}
+	switch l.Status {
+	case ShipmentDelivered:
+		return Shipment{}, fmt.Errorf("%w: it has been delivered", ErrInvalidShipment)
+	case ShipmentShipped:
+		if err := cancelShipment(ctx, tx, l, actor, reason); err != nil {
+			return Shipment{}, err
+		}
+	}
+	return commitShipment(ctx, tx, shipmentID)
+}
+
+// TrackingUpdate is a courier's status of a shipment.
+type TrackingUpdate struct {
+	Status string // one of the Tracking statuses
+	Detail string // the courier's own status
+	At     time.Time
+}
+
+// UpdateShipmentTracking records the latest tracking status of the shipment
+// booked with provider under trackingNumber. Updates older than the one
+// recorded are ignored. A delivered status delivers the shipment; a cancelled
+// one cancels it, as does a returned one, since the shipment goes back to the
+// seller. Either way the order moves along. Unknown shipments return
+// ErrNotFound.
+func (s *Store) UpdateShipmentTracking(ctx context.Context, provider, trackingNumber string, t TrackingUpdate, actor Actor) (Shipment, error) {
+	var shipmentID uuid.UUID
+	err := s.db.QueryRow(ctx, `
+SELECT id
+FROM shipments
+WHERE provider=$1 AND tracking_number=$2 AND tracking_number <> ''
+ORDER BY created_at DESC
+LIMIT 1
+`, provider, trackingNumber).Scan(&shipmentID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Shipment{}, ErrNotFound
+		}
+		return Shipment{}, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Shipment{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	l, err := lockShipment(ctx, tx, shipmentID)
+	if err != nil {
+		return Shipment{}, err
+	}
+	ct, err := tx.Exec(ctx, `
+UPDATE shipments
+SET tracking_status=$2, tracking_detail=$3, tracking_updated_at=$4, updated_at=now()
+WHERE id=$1 AND (tracking_updated_at IS NULL OR tracking_updated_at <= $4)
+`, shipmentID, t.Status, t.Detail, t.At)
+	if err != nil {
+		return Shipment{}, err
+	}
+	if ct.RowsAffected() > 0 && l.Status == ShipmentShipped {
+		switch t.Status {
+		case TrackingDelivered:
+			// Courier clocks may disagree with ours.
+			err = markShipmentDelivered(ctx, tx, l, maxTime(t.At, l.ShippedAt), actor)
+		case TrackingCancelled:
+			err = cancelShipment(ctx, tx, l, actor, "cancelled by the courier")
+		case TrackingReturned:
+			err = cancelShipment(ctx, tx, l, actor, "returned to origin ("+t.Detail+")")
+		}
+		if err != nil {
+			return Shipment{}, err
+		}
+	}
+	return commitShipment(ctx, tx, shipmentID)
+}
+
+func markShipmentDelivered(ctx context.Context, tx pgx.Tx, l shipmentLock, deliveredAt time.Time, actor Actor) error {
+	if _, err := tx.Exec(ctx, `
+UPDATE shipments SET status='delivered', delivered_at=$2, updated_at=now() WHERE id=$1
+`, l.ID, deliveredAt); err != nil {
+		return err
+	}
+	return syncShippingStatus(ctx, tx, l.OrderID, l.PaymentID, l.PayStatus, actor, "delivered")
+}
+
+func cancelShipment(ctx context.Context, tx pgx.Tx, l shipmentLock, actor Actor, reason string) error {
+	if _, err := tx.Exec(ctx, `
+UPDATE shipments SET status='cancelled', cancelled_at=now(), updated_at=now() WHERE id=$1
+`, l.ID); err != nil {
+		return err
+	}
+	note := "shipment cancelled"
+	if reason != "" {
+		note += ": " + reason
+	}
+	return syncShippingStatus(ctx, tx, l.OrderID, l.PaymentID, l.PayStatus, actor, note)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// commitShipment commits tx and returns the shipment as committed.
+func commitShipment(ctx context.Context, tx pgx.Tx, shipmentID uuid.UUID) (Shipment, error) {
+	sh, err := getShipment(ctx, tx, shipmentID)
+	if err != nil {
+		return Shipment{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Shipment{}, err
+	}
+	return sh, nil
+}
+
+func (s *Store) GetShipment(ctx context.Context, shipmentID uuid.UUID) (Shipment, error) {
+	return getShipment(ctx, s.db, shipmentID)
+}
+
+// ShipmentLabel returns a shipment's courier label PDF, or ErrNotFound when
+// it has none stored.
+func (s *Store) ShipmentLabel(ctx context.Context, shipmentID uuid.UUID) ([]byte, error) {
+	var pdf []byte
+	err := s.db.QueryRow(ctx, `SELECT label_pdf FROM shipments WHERE id=$1`, shipmentID).Scan(&pdf)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && pdf == nil) {
+		return nil, ErrNotFound
+	}
+	return pdf, err
+}
+
+func (s *Store) SetShipmentLabel(ctx context.Context, shipmentID uuid.UUID, pdf []byte) error {
+	ct, err := s.db.Exec(ctx, `
+UPDATE shipments SET label_pdf=$2, updated_at=now() WHERE id=$1
+`, shipmentID, pdf)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// syncShippingStatus derives the order status from its shipments: shipped
+// once every item has shipped, partially_shipped while only some have, and
+// fulfilled once every item has been delivered. Once cancelled shipments
+// leave nothing shipped, the order is paid (or confirmed for cash on
+// delivery) again. Orders that have left the shipping flow (e.g. refunded)
+// keep their status.
+func syncShippingStatus(ctx context.Context, tx pgx.Tx, orderID, paymentID uuid.UUID, payStatus string, actor Actor, note string) error {
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT status FROM orders WHERE id=$1 FOR UPDATE`, orderID).Scan(&status); err != nil {
+		return err
+	}
+	if !slices.Contains(shippableStatuses, status) {
+		return nil
+	}
+	lines, err := loadLineFulfillment(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	allShipped, allDelivered, anyShipped := len(lines) > 0, len(lines) > 0, false
+	for _, l := range lines {
+		allShipped = allShipped && l.ShippedQuantity >= l.Quantity
+		allDelivered = allDelivered && l.DeliveredQuantity >= l.Quantity
+		anyShipped = anyShipped || l.ShippedQuantity > 0
+	}
+	switch {
+	case allDelivered:
+		return fulfillOrder(ctx, tx, orderID, paymentID, payStatus, actor, note)
+	case allShipped:
+		_, err = transitionOrder(ctx, tx, orderID, OrderShipped, actor, note)
+	case anyShipped:
+		_, err = transitionOrder(ctx, tx, orderID, OrderPartiallyShipped, actor, note)
+	case status == OrderPartiallyShipped || status == OrderShipped:
+		var cod bool
+		if cod, err = isCashOnDelivery(ctx, tx, orderID); err != nil {
+			return err
+		}
+		to := OrderPaid
+		if cod {
+			to = OrderConfirmed
+		}
+		_, err = transitionOrder(ctx, tx, orderID, to, actor, note)
+	}
+	return err
+}
+
+func loadLineFulfillment(ctx context.Context, q queryer, orderID uuid.UUID) ([]LineFulfillment, error) {
+	rows, err := q.Query(ctx, `
+SELECT oi.variant_id, oi.sku, oi.quantity,
+       COALESCE(SUM(si.quantity) FILTER (WHERE sh.status <> 'cancelled'), 0),
+       COALESCE(SUM(si.quantity) FILTER (WHERE sh.status = 'delivered'), 0)
+FROM order_items oi
+LEFT JOIN shipment_items si ON si.order_id = oi.order_id AND si.variant_id = oi.variant_id
+LEFT JOIN shipments sh ON sh.id = si.shipment_id
+WHERE oi.order_id=$1
+GROUP BY oi.variant_id, oi.sku, oi.quantity
+ORDER BY oi.sku
+`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []LineFulfillment{}
+	for rows.Next() {
+		var l LineFulfillment
+		if err := rows.Scan(&l.VariantID, &l.SKU, &l.Quantity, &l.ShippedQuantity, &l.DeliveredQuantity); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+const shipmentColumns = `
+SELECT id, order_id, status, carrier, tracking_number, note,
+       provider, provider_order_id, provider_shipment_id, label_pdf IS NOT NULL,
+       tracking_status, tracking_detail, tracking_updated_at,
+       shipped_at, delivered_at, cancelled_at, actor_user_id, created_at
+FROM shipments`
+
+func scanShipment(row pgx.Row) (Shipment, error) {
+	var sh Shipment
+	err := row.Scan(&sh.ID, &sh.OrderID, &sh.Status, &sh.Carrier, &sh.TrackingNumber, &sh.Note,
+		&sh.Provider, &sh.ProviderOrderID, &sh.ProviderShipmentID, &sh.HasLabel,
+		&sh.TrackingStatus, &sh.TrackingDetail, &sh.TrackingUpdatedAt,
+		&sh.ShippedAt, &sh.DeliveredAt, &sh.CancelledAt, &sh.ActorUserID, &sh.CreatedAt)
+	return sh, err
+}
+
+// rowQueryer is a queryer that can also read a single row.
+type rowQueryer interface {
+	queryer
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func getShipment(ctx context.Context, q rowQueryer, shipmentID uuid.UUID) (Shipment, error) {
+	sh, err := scanShipment(q.QueryRow(ctx, shipmentColumns+`
+WHERE id=$1
+`, shipmentID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Shipment{}, ErrNotFound
+		}
+		return Shipment{}, err
+	}
+	items, err := loadShipmentItems(ctx, q, sh.OrderID)
+	if err != nil {
+		return Shipment{}, err
+	}
+	sh.Items = items[sh.ID]
+	return sh, nil
+}
+
+// loadShipmentItems returns the items of every shipment of an order, by
+// shipment.
+func loadShipmentItems(ctx context.Context, q queryer, orderID uuid.UUID) (map[uuid.UUID][]ShipmentItem, error) {
+	rows, err := q.Query(ctx, `
+SELECT si.shipment_id, si.variant_id, oi.sku, si.quantity
+FROM shipment_items si
+JOIN order_items oi ON oi.order_id = si.order_id AND oi.variant_id = si.variant_id
+WHERE si.order_id=$1
+ORDER BY oi.sku
+`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[uuid.UUID][]ShipmentItem{}
+	for rows.Next() {
+		var shipmentID uuid.UUID
+		var it ShipmentItem
+		if err := rows.Scan(&shipmentID, &it.VariantID, &it.SKU, &it.Quantity); err != nil {
+			return nil, err
+		}
+		out[shipmentID] = append(out[shipmentID], it)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) loadOrderShipments(ctx context.Context, orderID uuid.UUID) ([]Shipment, error) {
+	rows, err := s.db.Query(ctx, shipmentColumns+`
+WHERE order_id=$1
+ORDER BY shipped_at ASC, created_at ASC
+`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Shipment{}
+	for rows.Next() {
+		sh, err := scanShipment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sh)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	items, err := loadShipmentItems(ctx, s.db, orderID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range out {
+		out[i].Items = items[out[i].ID]
+	}
+	return out, nil
+}
+
@@ -0,0 +1,264 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNotServiceable is returned by checkout for addresses that cannot be
+// shipped to; the wrapping error names the reason.
+var ErrNotServiceable = errors.New("shipping address is not serviceable")
+
+// ShippingZone groups delivery addresses by pincode prefix or state. An
+// address belongs to the active zone with the longest pincode prefix matching
+// its pincode, or else to the oldest active zone listing its state. Shipping
+// is charged by total weight from Rates, unless the order (after discounts)
+// reaches FreeAboveINR; cash on delivery adds CODSurchargeINR. Addresses in a
+// zone that is not serviceable cannot check out.
+type ShippingZone struct {
+	ID              uuid.UUID      `json:"id"`
+	Name            string         `json:"name"`
+	PincodePrefixes []string       `json:"pincode_prefixes"`
+	States          []string       `json:"states"`
+	Serviceable     bool           `json:"serviceable"`
+	FreeAboveINR    *int           `json:"free_above_inr"`
+	CODSurchargeINR int            `json:"cod_surcharge_inr"`
+	Active          bool           `json:"active"`
+	Rates           []ShippingRate `json:"rates"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+}
+
+// ShippingRate charges RateINR for orders weighing up to MaxWeightGrams; a
+// nil MaxWeightGrams covers any weight.
+type ShippingRate struct {
+	MaxWeightGrams *int `json:"max_weight_grams"`
+	RateINR        int  `json:"rate_inr"`
+}
+
+type ShippingZoneInput struct {
+	Name            string
+	PincodePrefixes []string
+	States          []string // state codes
+	Serviceable     bool
+	FreeAboveINR    *int
+	CODSurchargeINR int
+	Active          bool
+	Rates           []ShippingRate
+}
+
+// ShippingOptions are the checkout inputs to shipping charges.
+type ShippingOptions struct {
+	// FlatINR is charged when no shipping zones are set up.
+	FlatINR        int
+	CashOnDelivery bool
+}
+
+// shippingQuote is the shipping charged on an order. RateINR includes
+// CODSurchargeINR.
+type shippingQuote struct {
+	ZoneID          *uuid.UUID
+	WeightGrams     int
+	RateINR         int
+	CODSurchargeINR int
+}
+
+const shippingZoneColumns = `
+SELECT z.id, z.name, z.pincode_prefixes, z.states, z.serviceable, z.free_above_inr, z.cod_surcharge_inr,
+       z.active, z.created_at, z.updated_at,
+       COALESCE(ARRAY(SELECT r.max_weight_grams FROM shipping_rates r WHERE r.zone_id = z.id ORDER BY r.max_weight_grams ASC NULLS LAST), '{}'),
+       COALESCE(ARRAY(SELECT r.rate_inr FROM shipping_rates r WHERE r.zone_id = z.id ORDER BY r.max_weight_grams ASC NULLS LAST), '{}')
+FROM shipping_zones z`
+
+type queryer interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func listShippingZones(ctx context.Context, q queryer, onlyActive bool) ([]ShippingZone, error) {
+	rows, err := q.Query(ctx, shippingZoneColumns+`
+WHERE z.active OR NOT $1
+ORDER BY z.created_at ASC
+`, onlyActive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ShippingZone{}
+	for rows.Next() {
+		var z ShippingZone
+		var weights []*int
+		var rates []int
+		if err := rows.Scan(&z.ID, &z.Name, &z.PincodePrefixes, &z.States, &z.Serviceable, &z.FreeAboveINR, &z.CODSurchargeINR,
+			&z.Active, &z.CreatedAt, &z.UpdatedAt, &weights, &rates); err != nil {
+			return nil, err
+		}
+		z.Rates = make([]ShippingRate, len(rates))
+		for i := range rates {
+			z.Rates[i] = ShippingRate{MaxWeightGrams: weights[i], RateINR: rates[i]}
+		}
+		out = append(out, z)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) AdminListShippingZones(ctx context.Context) ([]ShippingZone, error) {
+	return listShippingZones(ctx, s.db, false)
+}
+
+func (s *Store) AdminCreateShippingZone(ctx context.Context, in ShippingZoneInput) (uuid.UUID, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id uuid.UUID
+	err = tx.QueryRow(ctx, `
+INSERT INTO shipping_zones (name, pincode_prefixes, states, serviceable, free_above_inr, cod_surcharge_inr, active)
+VALUES ($1,$2,$3,$4,$5,$6,$7)
+RETURNING id
+`, in.Name, nonNilStrings(in.PincodePrefixes), nonNilStrings(in.States), in.Serviceable, in.FreeAboveINR, in.CODSurchargeINR, in.Active).Scan(&id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := setShippingRates(ctx, tx, id, in.Rates); err != nil {
+		return uuid.Nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, err
+	}
+	return id, nil
+}
+
+// AdminUpdateShippingZone replaces a zone's settings and rates. Orders keep
+// the shipping they were charged.
+func (s *Store) AdminUpdateShippingZone(ctx context.Context, zoneID uuid.UUID, in ShippingZoneInput) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	ct, err := tx.Exec(ctx, `
+UPDATE shipping_zones
+SET name=$2, pincode_prefixes=$3, states=$4, serviceable=$5, free_above_inr=$6, cod_surcharge_inr=$7, active=$8, updated_at=now()
+WHERE id=$1
+`, zoneID, in.Name, nonNilStrings(in.PincodePrefixes), nonNilStrings(in.States), in.Serviceable, in.FreeAboveINR, in.CODSurchargeINR, in.Active)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	if err := setShippingRates(ctx, tx, zoneID, in.Rates); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *Store) AdminDeleteShippingZone(ctx context.Context, zoneID uuid.UUID) error {
+	ct, err := s.db.Exec(ctx, `DELETE FROM shipping_zones WHERE id=$1`, zoneID)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func setShippingRates(ctx context.Context, tx pgx.Tx, zoneID uuid.UUID, rates []ShippingRate) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM shipping_rates WHERE zone_id=$1`, zoneID); err != nil {
+		return err
+	}
+	for _, r := range rates {
+		_, err := tx.Exec(ctx, `
+INSERT INTO shipping_rates (zone_id, max_weight_grams, rate_inr)
+VALUES ($1,$2,$3)
+`, zoneID, r.MaxWeightGrams, r.RateINR)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// matchShippingZone finds the zone of an address among zones ordered oldest
+// first.
+func matchShippingZone(zones []ShippingZone, pincode, stateCode string) (ShippingZone, bool) {
+	best, bestLen := -1, 0
+	for i, z := range zones {
+		for _, p := range z.PincodePrefixes {
+			if len(p) > bestLen && pincode != "" && strings.HasPrefix(pincode, p) {
+				best, bestLen = i, len(p)
+			}
+		}
+	}
+	if best >= 0 {
+		return zones[best], true
+	}
+	for _, z := range zones {
+		for _, st := range z.States {
+			if st == stateCode {
+				return z, true
+			}
+		}
+	}
+	return ShippingZone{}, false
+}
+
+// rateFor returns the zone's rate for an order weighing weightGrams. Rates
+// are loaded lightest first, with the unbounded rate last.
+func (z ShippingZone) rateFor(weightGrams int) (int, bool) {
+	for _, r := range z.Rates {
+		if r.MaxWeightGrams == nil || weightGrams <= *r.MaxWeightGrams {
+			return r.RateINR, true
+		}
+	}
+	return 0, false
+}
+
+// quoteShipping prices shipping for an order worth orderValueINR after
+// discounts. Without any active zone the flat rate applies.
+func quoteShipping(ctx context.Context, tx pgx.Tx, pincode, stateCode string, weightGrams, orderValueINR int, opts ShippingOptions) (shippingQuote, error) {
+	q := shippingQuote{WeightGrams: weightGrams}
+	zones, err := listShippingZones(ctx, tx, true)
+	if err != nil {
+		return q, err
+	}
+	if len(zones) == 0 {
+		q.RateINR = opts.FlatINR
+		return q, nil
+	}
+	z, ok := matchShippingZone(zones, pincode, stateCode)
+	if !ok || !z.Serviceable {
+		return q, fmt.Errorf("%w: we do not deliver to pincode %s", ErrNotServiceable, pincode)
+	}
+	rate, ok := z.rateFor(weightGrams)
+	if !ok {
+		return q, fmt.Errorf("%w: the order is too heavy to ship to pincode %s", ErrNotServiceable, pincode)
+	}
+	q.ZoneID = &z.ID
+	if z.FreeAboveINR == nil || orderValueINR < *z.FreeAboveINR {
+		q.RateINR = rate
+	}
+	if opts.CashOnDelivery {
+		q.CODSurchargeINR = z.CODSurchargeINR
+		q.RateINR += z.CODSurchargeINR
+	}
+	return q, nil
+}
+
@@ -4,15 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"clothes-shop/api/internal/gst"
 )
 
 var ErrNotFound = errors.New("not found")
 var ErrInsufficientStock = errors.New("insufficient stock")
+var ErrCartNotOpen = errors.New("cart is not open")
+var ErrProductUnavailable = errors.New("product is not available")
 
 type Store struct {
 	db *pgxpool.Pool
@@ -48,14 +53,17 @@ LIMIT 1
 }
 
 type Product struct {
-	ID          uuid.UUID `json:"id"`
-	Slug        string    `json:"slug"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Variants    []Variant `json:"variants"`
+	ID          uuid.UUID  `json:"id"`
+	Slug        string     `json:"slug"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	HSNCode     string     `json:"hsn_code"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Categories  []Category `json:"categories"`
+	Images      []Image    `json:"images"`
+	Variants    []Variant  `json:"variants"`
 }
 
 type Variant struct {
@@ -67,26 +75,39 @@ type Variant struct {
 	Color            string    `json:"color"`
 	PriceINR         int       `json:"price_inr"`
 	CompareAtPriceINR *int      `json:"compare_at_price_inr,omitempty"`
+	WeightGrams      int       `json:"weight_grams"`
 	OnHand           int       `json:"on_hand"`
 	Reserved         int       `json:"reserved"`
+	Images           []Image   `json:"images"`
 }
 
-func (s *Store) ListProductsWithVariants(ctx context.Context, onlyActive bool) ([]Product, error) {
+// ListProductsWithVariants lists products with their variants. An empty
+// categorySlug lists products from every category.
+func (s *Store) ListProductsWithVariants(ctx context.Context, onlyActive bool, categorySlug string) ([]Product, error) {
 	where := "TRUE"
 	if onlyActive {
 		where = "p.status = 'active'"
 	}
+	args := []any{}
+	if categorySlug != "" {
+		args = append(args, categorySlug)
+		where += ` AND EXISTS (
+  SELECT 1 FROM product_categories pc
+  JOIN categories c ON c.id = pc.category_id
+  WHERE pc.product_id = p.id AND c.slug = $1
+)`
+	}
 	rows, err := s.db.Query(ctx, fmt.Sprintf(`
 SELECT
-  p.id, p.slug, p.name, p.description, p.status, p.created_at, p.updated_at,
-  v.id, v.product_id, v.sku, v.title, v.size, v.color, v.price_inr, v.compare_at_price_inr,
+  p.id, p.slug, p.name, p.description, p.status, p.hsn_code, p.created_at, p.updated_at,
+  v.id, v.product_id, v.sku, v.title, v.size, v.color, v.price_inr, v.compare_at_price_inr, v.weight_grams,
   COALESCE(i.on_hand, 0), COALESCE(i.reserved, 0)
 FROM products p
 JOIN product_variants v ON v.product_id = p.id
 LEFT JOIN inventory i ON i.variant_id = v.id
 WHERE %s
 ORDER BY p.created_at DESC, v.created_at ASC
-`, where))
+`, where), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -98,8 +119,8 @@ ORDER BY p.created_at DESC, v.created_at ASC
 		var p Product
 		var v Variant
 		if err := rows.Scan(
-			&p.ID, &p.Slug, &p.Name, &p.Description, &p.Status, &p.CreatedAt, &p.UpdatedAt,
-			&v.ID, &v.ProductID, &v.SKU, &v.Title, &v.Size, &v.Color, &v.PriceINR, &v.CompareAtPriceINR,
+			&p.ID, &p.Slug, &p.Name, &p.Description, &p.Status, &p.HSNCode, &p.CreatedAt, &p.UpdatedAt,
+			&v.ID, &v.ProductID, &v.SKU, &v.Title, &v.Size, &v.Color, &v.PriceINR, &v.CompareAtPriceINR, &v.WeightGrams,
 			&v.OnHand, &v.Reserved,
 		); err != nil {
 			return nil, err
@@ -116,9 +137,25 @@ ORDER BY p.created_at DESC, v.created_at ASC
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	out := make([]Product, 0, len(order))
+	cats, err := s.loadProductCategories(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	ptrs := make([]*Product, 0, len(order))
 	for _, id := range order {
-		out = append(out, *byID[id])
+		p := byID[id]
+		p.Categories = cats[id]
+		if p.Categories == nil {
+			p.Categories = []Category{}
+		}
+		ptrs = append(ptrs, p)
+	}
+	if err := s.attachImages(ctx, ptrs); err != nil {
+		return nil, err
+	}
+	out := make([]Product, 0, len(ptrs))
+	for _, p := range ptrs {
+		out = append(out, *p)
 	}
 	return out, nil
 }
@@ -126,8 +163,8 @@ ORDER BY p.created_at DESC, v.created_at ASC
 func (s *Store) GetProductBySlug(ctx context.Context, slug string) (Product, error) {
 	rows, err := s.db.Query(ctx, `
 SELECT
-  p.id, p.slug, p.name, p.description, p.status, p.created_at, p.updated_at,
-  v.id, v.product_id, v.sku, v.title, v.size, v.color, v.price_inr, v.compare_at_price_inr,
+  p.id, p.slug, p.name, p.description, p.status, p.hsn_code, p.created_at, p.updated_at,
+  v.id, v.product_id, v.sku, v.title, v.size, v.color, v.price_inr, v.compare_at_price_inr, v.weight_grams,
   COALESCE(i.on_hand, 0), COALESCE(i.reserved, 0)
 FROM products p
 JOIN product_variants v ON v.product_id = p.id
@@ -145,8 +182,8 @@ ORDER BY v.created_at ASC
 	for rows.Next() {
 		var v Variant
 		if err := rows.Scan(
-			&p.ID, &p.Slug, &p.Name, &p.Description, &p.Status, &p.CreatedAt, &p.UpdatedAt,
-			&v.ID, &v.ProductID, &v.SKU, &v.Title, &v.Size, &v.Color, &v.PriceINR, &v.CompareAtPriceINR,
+			&p.ID, &p.Slug, &p.Name, &p.Description, &p.Status, &p.HSNCode, &p.CreatedAt, &p.UpdatedAt,
+			&v.ID, &v.ProductID, &v.SKU, &v.Title, &v.Size, &v.Color, &v.PriceINR, &v.CompareAtPriceINR, &v.WeightGrams,
 			&v.OnHand, &v.Reserved,
 		); err != nil {
 			return Product{}, err
@@ -163,6 +200,17 @@ ORDER BY v.created_at ASC
 	if first {
 		return Product{}, ErrNotFound
 	}
+	cats, err := s.loadProductCategories(ctx, []uuid.UUID{p.ID})
+	if err != nil {
+		return Product{}, err
+	}
+	p.Categories = cats[p.ID]
+	if p.Categories == nil {
+		p.Categories = []Category{}
+	}
+	if err := s.attachImages(ctx, []*Product{&p}); err != nil {
+		return Product{}, err
+	}
 	return p, nil
 }
 
@@ -171,6 +219,8 @@ type CreateProductInput struct {
 	Name        string
 	Description string
 	Status      string
+	HSNCode     string
+	CategoryIDs []uuid.UUID
 	Variants    []CreateVariantInput
 }
 
@@ -181,6 +231,7 @@ type CreateVariantInput struct {
 	Color            string
 	PriceINR         int
 	CompareAtPriceINR *int
+	WeightGrams      int
 	OnHand           int
 }
 
@@ -194,10 +245,10 @@ func (s *Store) AdminCreateProduct(ctx context.Context, in CreateProductInput) (
 	var pid uuid.UUID
 	var createdAt, updatedAt time.Time
 	err = tx.QueryRow(ctx, `
-INSERT INTO products (slug, name, description, status)
-VALUES ($1, $2, $3, $4)
+INSERT INTO products (slug, name, description, status, hsn_code)
+VALUES ($1, $2, $3, $4, $5)
 RETURNING id, created_at, updated_at
-`, in.Slug, in.Name, in.Description, in.Status).Scan(&pid, &createdAt, &updatedAt)
+`, in.Slug, in.Name, in.Description, in.Status, in.HSNCode).Scan(&pid, &createdAt, &updatedAt)
 	if err != nil {
 		return Product{}, err
 	}
@@ -208,30 +259,43 @@ RETURNING id, created_at, updated_at
 		Name:        in.Name,
 		Description: in.Description,
 		Status:      in.Status,
+		HSNCode:     in.HSNCode,
 		CreatedAt:   createdAt,
 		UpdatedAt:   updatedAt,
+		Images:      []Image{},
 		Variants:    make([]Variant, 0, len(in.Variants)),
 	}
 
+	if err := setProductCategories(ctx, tx, pid, in.CategoryIDs); err != nil {
+		return Product{}, err
+	}
+
 	for _, v := range in.Variants {
 		var vid uuid.UUID
 		var vCreatedAt, vUpdatedAt time.Time
 		err := tx.QueryRow(ctx, `
-INSERT INTO product_variants (product_id, sku, title, size, color, price_inr, compare_at_price_inr)
-VALUES ($1,$2,$3,$4,$5,$6,$7)
+INSERT INTO product_variants (product_id, sku, title, size, color, price_inr, compare_at_price_inr, weight_grams)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
 RETURNING id, created_at, updated_at
-`, pid, v.SKU, v.Title, v.Size, v.Color, v.PriceINR, v.CompareAtPriceINR).Scan(&vid, &vCreatedAt, &vUpdatedAt)
+`, pid, v.SKU, v.Title, v.Size, v.Color, v.PriceINR, v.CompareAtPriceINR, v.WeightGrams).Scan(&vid, &vCreatedAt, &vUpdatedAt)
 		if err != nil {
 			return Product{}, err
 		}
 		_, err = tx.Exec(ctx, `
 INSERT INTO inventory (variant_id, on_hand, reserved)
-VALUES ($1, $2, 0)
-ON CONFLICT (variant_id) DO UPDATE SET on_hand = EXCLUDED.on_hand, reserved = 0, updated_at = now()
-`, vid, v.OnHand)
+VALUES ($1, 0, 0)
+`, vid)
 		if err != nil {
 			return Product{}, err
 		}
+		if _, _, err := moveInventory(ctx, tx, inventoryMove{
+			VariantID:   vid,
+			Reason:      MovementInitialStock,
+			DeltaOnHand: v.OnHand,
+			Note:        "product created",
+		}); err != nil {
+			return Product{}, err
+		}
 		out.Variants = append(out.Variants, Variant{
 			ID:               vid,
 			ProductID:        pid,
@@ -241,32 +305,61 @@ ON CONFLICT (variant_id) DO UPDATE SET on_hand = EXCLUDED.on_hand, reserved = 0,
 			Color:            v.Color,
 			PriceINR:         v.PriceINR,
 			CompareAtPriceINR: v.CompareAtPriceINR,
+			WeightGrams:      v.WeightGrams,
 			OnHand:           v.OnHand,
 			Reserved:         0,
+			Images:           []Image{},
 		})
 		_ = vCreatedAt
 		_ = vUpdatedAt
 	}
 
+	if err := refreshProductSearch(ctx, tx, []uuid.UUID{pid}); err != nil {
+		return Product{}, err
+	}
 	if err := tx.Commit(ctx); err != nil {
 		return Product{}, err
 	}
+	cats, err := s.loadProductCategories(ctx, []uuid.UUID{pid})
+	if err != nil {
+		return Product{}, err
+	}
+	out.Categories = cats[pid]
+	if out.Categories == nil {
+		out.Categories = []Category{}
+	}
 	return out, nil
 }
 
-func (s *Store) AdminUpdateProduct(ctx context.Context, productID uuid.UUID, slug, name, description, status string) error {
-	ct, err := s.db.Exec(ctx, `
+// AdminUpdateProduct updates a product. A nil hsnCode or categoryIDs leaves
+// that field untouched; an empty categoryIDs detaches it from every category.
+func (s *Store) AdminUpdateProduct(ctx context.Context, productID uuid.UUID, slug, name, description, status string, hsnCode *string, categoryIDs []uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	ct, err := tx.Exec(ctx, `
 UPDATE products
-SET slug=$2, name=$3, description=$4, status=$5, updated_at=now()
+SET slug=$2, name=$3, description=$4, status=$5, hsn_code=COALESCE($6, hsn_code), updated_at=now()
 WHERE id=$1
-`, productID, slug, name, description, status)
+`, productID, slug, name, description, status, hsnCode)
 	if err != nil {
 		return err
 	}
 	if ct.RowsAffected() == 0 {
 		return ErrNotFound
 	}
-	return nil
+	if categoryIDs != nil {
+		if err := setProductCategories(ctx, tx, productID, categoryIDs); err != nil {
+			return err
+		}
+	}
+	if err := refreshProductSearch(ctx, tx, []uuid.UUID{productID}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 type CreateVariantForProductInput struct {
@@ -276,6 +369,7 @@ type CreateVariantForProductInput struct {
 	Color            string
 	PriceINR         int
 	CompareAtPriceINR *int
+	WeightGrams      int
 	OnHand           int
 }
 
@@ -288,21 +382,32 @@ func (s *Store) AdminCreateVariant(ctx context.Context, productID uuid.UUID, in
 
 	var vid uuid.UUID
 	err = tx.QueryRow(ctx, `
-INSERT INTO product_variants (product_id, sku, title, size, color, price_inr, compare_at_price_inr)
-VALUES ($1,$2,$3,$4,$5,$6,$7)
+INSERT INTO product_variants (product_id, sku, title, size, color, price_inr, compare_at_price_inr, weight_grams)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
 RETURNING id
-`, productID, in.SKU, in.Title, in.Size, in.Color, in.PriceINR, in.CompareAtPriceINR).Scan(&vid)
+`, productID, in.SKU, in.Title, in.Size, in.Color, in.PriceINR, in.CompareAtPriceINR, in.WeightGrams).Scan(&vid)
 	if err != nil {
 		return Variant{}, err
 	}
 
 	_, err = tx.Exec(ctx, `
 INSERT INTO inventory (variant_id, on_hand, reserved)
-VALUES ($1, $2, 0)
-`, vid, in.OnHand)
+VALUES ($1, 0, 0)
+`, vid)
 	if err != nil {
 		return Variant{}, err
 	}
+	if _, _, err := moveInventory(ctx, tx, inventoryMove{
+		VariantID:   vid,
+		Reason:      MovementInitialStock,
+		DeltaOnHand: in.OnHand,
+		Note:        "variant created",
+	}); err != nil {
+		return Variant{}, err
+	}
+	if err := refreshProductSearch(ctx, tx, []uuid.UUID{productID}); err != nil {
+		return Variant{}, err
+	}
 
 	if err := tx.Commit(ctx); err != nil {
 		return Variant{}, err
@@ -316,56 +421,62 @@ VALUES ($1, $2, 0)
 		Color:            in.Color,
 		PriceINR:         in.PriceINR,
 		CompareAtPriceINR: in.CompareAtPriceINR,
+		WeightGrams:      in.WeightGrams,
 		OnHand:           in.OnHand,
 		Reserved:         0,
+		Images:           []Image{},
 	}, nil
 }
 
-func (s *Store) AdminUpdateVariant(ctx context.Context, variantID uuid.UUID, title, size, color string, priceINR int, compareAt *int) error {
-	ct, err := s.db.Exec(ctx, `
+// AdminUpdateVariant updates a variant. A nil weightGrams keeps the current
+// weight.
+func (s *Store) AdminUpdateVariant(ctx context.Context, variantID uuid.UUID, title, size, color string, priceINR int, compareAt, weightGrams *int) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var productID uuid.UUID
+	err = tx.QueryRow(ctx, `
 UPDATE product_variants
-SET title=$2, size=$3, color=$4, price_inr=$5, compare_at_price_inr=$6, updated_at=now()
+SET title=$2, size=$3, color=$4, price_inr=$5, compare_at_price_inr=$6, weight_grams=COALESCE($7, weight_grams), updated_at=now()
 WHERE id=$1
-`, variantID, title, size, color, priceINR, compareAt)
+RETURNING product_id
+`, variantID, title, size, color, priceINR, compareAt, weightGrams).Scan(&productID)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
 		return err
 	}
-	if ct.RowsAffected() == 0 {
-		return ErrNotFound
+	if err := refreshProductSearch(ctx, tx, []uuid.UUID{productID}); err != nil {
+		return err
 	}
-	return nil
+	return tx.Commit(ctx)
 }
 
-func (s *Store) AdminAdjustInventory(ctx context.Context, variantID uuid.UUID, delta int) (onHand int, reserved int, err error) {
+func (s *Store) AdminAdjustInventory(ctx context.Context, variantID uuid.UUID, delta int, actorUserID uuid.UUID, note string) (onHand int, reserved int, err error) {
 	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return 0, 0, err
 	}
 	defer tx.Rollback(ctx)
 
-	var curOnHand, curReserved int
-	if err := tx.QueryRow(ctx, `
-SELECT on_hand, reserved FROM inventory WHERE variant_id=$1 FOR UPDATE
-`, variantID).Scan(&curOnHand, &curReserved); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, 0, ErrNotFound
-		}
-		return 0, 0, err
-	}
-	newOnHand := curOnHand + delta
-	if newOnHand < 0 {
-		return 0, 0, errors.New("on_hand would go negative")
-	}
-	_, err = tx.Exec(ctx, `
-UPDATE inventory SET on_hand=$2, updated_at=now() WHERE variant_id=$1
-`, variantID, newOnHand)
+	onHand, reserved, err = moveInventory(ctx, tx, inventoryMove{
+		VariantID:   variantID,
+		Reason:      MovementAdjustment,
+		DeltaOnHand: delta,
+		ActorUserID: &actorUserID,
+		Note:        note,
+	})
 	if err != nil {
 		return 0, 0, err
 	}
 	if err := tx.Commit(ctx); err != nil {
 		return 0, 0, err
 	}
-	return newOnHand, curReserved, nil
+	return onHand, reserved, nil
 }
 
 type CartItem struct {
@@ -376,6 +487,21 @@ type CartItem struct {
 	UnitPrice int       `json:"unit_price_inr"`
 	Quantity  int       `json:"quantity"`
 	LineTotal int       `json:"line_total_inr"`
+	// Warnings lists what changed since the item was added; the line is
+	// still in the cart, but checkout may reject it or charge a new price.
+	Warnings []CartWarning `json:"warnings,omitempty"`
+}
+
+// Cart line warning codes.
+const (
+	CartWarningPriceChanged      = "price_changed"
+	CartWarningUnavailable       = "unavailable"
+	CartWarningInsufficientStock = "insufficient_stock"
+)
+
+type CartWarning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 type Cart struct {
@@ -393,26 +519,103 @@ func (s *Store) CreateCart(ctx context.Context) (uuid.UUID, error) {
 	return id, nil
 }
 
-func (s *Store) UpsertCartItem(ctx context.Context, cartID uuid.UUID, variantID uuid.UUID, qty int) error {
-	ct, err := s.db.Exec(ctx, `
-INSERT INTO cart_items (cart_id, variant_id, quantity)
-VALUES ($1,$2,$3)
-ON CONFLICT (cart_id, variant_id) DO UPDATE SET quantity = EXCLUDED.quantity, updated_at = now()
-`, cartID, variantID, qty)
+// UpsertCartItem sets the quantity of a variant in an open cart and returns the
+// quantity stored, which is capped at the stock available for sale. Only
+// variants of active products can be added.
+func (s *Store) UpsertCartItem(ctx context.Context, cartID uuid.UUID, variantID uuid.UUID, qty int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
-		return err
+		return 0, err
 	}
-	if ct.RowsAffected() == 0 {
-		return ErrNotFound
+	defer tx.Rollback(ctx)
+
+	if err := lockOpenCart(ctx, tx, cartID); err != nil {
+		return 0, err
 	}
-	return nil
+
+	var productStatus string
+	var price, available int
+	err = tx.QueryRow(ctx, `
+SELECT p.status, v.price_inr, COALESCE(i.on_hand - i.reserved, 0)
+FROM product_variants v
+JOIN products p ON p.id = v.product_id
+LEFT JOIN inventory i ON i.variant_id = v.id
+WHERE v.id=$1
+`, variantID).Scan(&productStatus, &price, &available)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	if productStatus != "active" {
+		return 0, ErrProductUnavailable
+	}
+	if available <= 0 {
+		return 0, ErrInsufficientStock
+	}
+	qty = min(qty, available)
+
+	_, err = tx.Exec(ctx, `
+INSERT INTO cart_items (cart_id, variant_id, quantity, unit_price_inr)
+VALUES ($1,$2,$3,$4)
+ON CONFLICT (cart_id, variant_id) DO UPDATE SET quantity = EXCLUDED.quantity, unit_price_inr = EXCLUDED.unit_price_inr, updated_at = now()
+`, cartID, variantID, qty, price)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE carts SET updated_at=now() WHERE id=$1`, cartID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return qty, nil
 }
 
 func (s *Store) DeleteCartItem(ctx context.Context, cartID, variantID uuid.UUID) error {
-	_, err := s.db.Exec(ctx, `DELETE FROM cart_items WHERE cart_id=$1 AND variant_id=$2`, cartID, variantID)
-	return err
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockOpenCart(ctx, tx, cartID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM cart_items WHERE cart_id=$1 AND variant_id=$2`, cartID, variantID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE carts SET updated_at=now() WHERE id=$1`, cartID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// lockOpenCart locks a cart for a change to its items or a checkout, failing
+// with ErrCartNotOpen once it has been checked out. An abandoned cart the
+// customer comes back to is reopened.
+func lockOpenCart(ctx context.Context, tx pgx.Tx, cartID uuid.UUID) error {
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT status FROM carts WHERE id=$1 FOR UPDATE`, cartID).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	switch status {
+	case "open":
+		return nil
+	case "abandoned":
+		_, err := tx.Exec(ctx, `UPDATE carts SET status='open', abandoned_at=NULL, updated_at=now() WHERE id=$1`, cartID)
+		return err
+	default:
+		return ErrCartNotOpen
+	}
 }
 
+// GetCart returns a cart at current prices. Lines whose price, product status
+// or stock changed since they were added carry warnings.
 func (s *Store) GetCart(ctx context.Context, cartID uuid.UUID) (Cart, error) {
 	row := s.db.QueryRow(ctx, `SELECT id, status FROM carts WHERE id=$1`, cartID)
 	var c Cart
@@ -430,10 +633,14 @@ SELECT
   p.name,
   v.title,
   v.price_inr,
-  ci.quantity
+  ci.quantity,
+  ci.unit_price_inr,
+  p.status,
+  COALESCE(i.on_hand - i.reserved, 0)
 FROM cart_items ci
 JOIN product_variants v ON v.id = ci.variant_id
 JOIN products p ON p.id = v.product_id
+LEFT JOIN inventory i ON i.variant_id = v.id
 WHERE ci.cart_id=$1
 ORDER BY ci.created_at ASC
 `, cartID)
@@ -446,11 +653,16 @@ ORDER BY ci.created_at ASC
 	sub := 0
 	for rows.Next() {
 		var it CartItem
-		if err := rows.Scan(&it.VariantID, &it.SKU, &it.Product, &it.Variant, &it.UnitPrice, &it.Quantity); err != nil {
+		var addedPrice, available int
+		var productStatus string
+		if err := rows.Scan(&it.VariantID, &it.SKU, &it.Product, &it.Variant, &it.UnitPrice, &it.Quantity, &addedPrice, &productStatus, &available); err != nil {
 			return Cart{}, err
 		}
 		it.LineTotal = it.UnitPrice * it.Quantity
 		sub += it.LineTotal
+		if c.Status == "open" {
+			it.Warnings = cartItemWarnings(it, addedPrice, productStatus, available)
+		}
 		c.Items = append(c.Items, it)
 	}
 	if err := rows.Err(); err != nil {
@@ -460,28 +672,86 @@ ORDER BY ci.created_at ASC
 	return c, nil
 }
 
+func cartItemWarnings(it CartItem, addedPrice int, productStatus string, available int) []CartWarning {
+	var out []CartWarning
+	if it.UnitPrice != addedPrice {
+		out = append(out, CartWarning{
+			Code:    CartWarningPriceChanged,
+			Message: fmt.Sprintf("price changed from %s to %s", formatINR(addedPrice), formatINR(it.UnitPrice)),
+		})
+	}
+	switch {
+	case productStatus != "active":
+		out = append(out, CartWarning{Code: CartWarningUnavailable, Message: "no longer available"})
+	case available <= 0:
+		out = append(out, CartWarning{Code: CartWarningInsufficientStock, Message: "out of stock"})
+	case available < it.Quantity:
+		out = append(out, CartWarning{Code: CartWarningInsufficientStock, Message: fmt.Sprintf("only %d left in stock", available)})
+	}
+	return out
+}
+
+// formatINR formats an amount in paise as rupees, e.g. "₹1299.00".
+func formatINR(paise int) string {
+	return fmt.Sprintf("₹%d.%02d", paise/100, paise%100)
+}
+
 type CheckoutCustomer struct {
-	Name    string
-	Phone   string
-	Email   string
-	Address map[string]any
+	Name  string
+	Phone string
+	Email string
+	// Address is the shipping address; its name and phone default to the
+	// customer's.
+	Address Address
+	UserID  *uuid.UUID // the logged-in customer; nil for guests
 }
 
 type CheckoutResult struct {
-	OrderID    uuid.UUID `json:"order_id"`
-	PaymentID  uuid.UUID `json:"payment_id"`
-	AmountINR  int       `json:"amount_inr"`
-	Currency   string    `json:"currency"`
-	Provider   string    `json:"provider"`
+	OrderID     uuid.UUID         `json:"order_id"`
+	PaymentID   uuid.UUID         `json:"payment_id"`
+	AmountINR   int               `json:"amount_inr"`
+	Currency    string            `json:"currency"`
+	Provider    string            `json:"provider"`
+	DiscountINR int               `json:"discount_inr"`
+	Discounts   []AppliedDiscount `json:"discounts"`
+	// ProviderOrderID is the provider's order for the payment, if one was
+	// created already (only set by PendingCartCheckout).
+	ProviderOrderID string `json:"-"`
 }
 
-func (s *Store) CheckoutFromCart(ctx context.Context, cartID uuid.UUID, customer CheckoutCustomer, shippingFlatINR int, taxRateBps int) (CheckoutResult, error) {
+// CheckoutFromCart turns a cart into a pending_payment order with reserved
+// stock and a payment for the given provider; a cash-on-delivery order is
+// confirmed right away. The discount code (optional) and any automatic
+// promotion are taken off before tax. Shipping follows the shipping zone of
+// the address; invalid addresses fail with ErrInvalidAddress and those that
+// cannot be shipped to with ErrNotServiceable. GST is charged per line by HSN
+// code and value per unit, as CGST+SGST when shipping within the seller's
+// state and IGST otherwise; shipping is taxed at the highest line rate.
+func (s *Store) CheckoutFromCart(ctx context.Context, cartID uuid.UUID, customer CheckoutCustomer, provider, discountCode string, shippingOpts ShippingOptions, gstSettings GSTSettings) (CheckoutResult, error) {
+	addr := customer.Address
+	if strings.TrimSpace(addr.Name) == "" {
+		addr.Name = customer.Name
+	}
+	if strings.TrimSpace(addr.Phone) == "" {
+		addr.Phone = customer.Phone
+	}
+	addr, err := addr.Normalize()
+	if err != nil {
+		return CheckoutResult{}, err
+	}
+	pos, _ := gst.LookupState(addr.State)
+	interState := gst.InterState(gstSettings.SellerState, pos.Code)
+
 	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return CheckoutResult{}, err
 	}
 	defer tx.Rollback(ctx)
 
+	if err := lockOpenCart(ctx, tx, cartID); err != nil {
+		return CheckoutResult{}, err
+	}
+
 	// Load cart items with price and lock inventory rows for reservation.
 	rows, err := tx.Query(ctx, `
 SELECT
@@ -490,7 +760,11 @@ SELECT
   p.name,
   v.title,
   v.price_inr,
-  ci.quantity
+  ci.quantity,
+  p.status,
+  p.id,
+  p.hsn_code,
+  v.weight_grams
 FROM cart_items ci
 JOIN product_variants v ON v.id = ci.variant_id
 JOIN products p ON p.id = v.product_id
@@ -509,16 +783,26 @@ ORDER BY ci.created_at ASC
 		vtitle    string
 		unit      int
 		qty       int
+		productID uuid.UUID
+		hsn       string
+		weight    int
 	}
 	lines := []line{}
 	subtotal := 0
+	weight := 0
+	inactive := false
 	for rows.Next() {
 		var l line
-		if err := rows.Scan(&l.variantID, &l.sku, &l.pname, &l.vtitle, &l.unit, &l.qty); err != nil {
+		var productStatus string
+		if err := rows.Scan(&l.variantID, &l.sku, &l.pname, &l.vtitle, &l.unit, &l.qty, &productStatus, &l.productID, &l.hsn, &l.weight); err != nil {
 			return CheckoutResult{}, err
 		}
+		if productStatus != "active" {
+			inactive = true
+		}
 		lines = append(lines, l)
 		subtotal += l.unit * l.qty
+		weight += l.weight * l.qty
 	}
 	if err := rows.Err(); err != nil {
 		return CheckoutResult{}, err
@@ -526,59 +810,131 @@ ORDER BY ci.created_at ASC
 	if len(lines) == 0 {
 		return CheckoutResult{}, errors.New("cart is empty")
 	}
+	if inactive {
+		return CheckoutResult{}, ErrProductUnavailable
+	}
 
-	shipping := shippingFlatINR
-	taxBase := subtotal + shipping
-	tax := (taxBase*taxRateBps + 5000) / 10000
-	total := subtotal + shipping + tax
+	dlines := make([]discountLine, len(lines))
+	for i, l := range lines {
+		dlines[i] = discountLine{productID: l.productID, total: l.unit * l.qty}
+	}
+	discounts, err := applyDiscounts(ctx, tx, discountCode, customer.Phone, dlines)
+	if err != nil {
+		return CheckoutResult{}, err
+	}
+	discount := 0
+	for _, d := range discounts {
+		discount += d.AmountINR
+	}
+
+	quote, err := quoteShipping(ctx, tx, addr.Pincode, pos.Code, weight, subtotal-discount, shippingOpts)
+	if err != nil {
+		return CheckoutResult{}, err
+	}
+
+	rates, err := loadGSTRates(ctx, tx)
+	if err != nil {
+		return CheckoutResult{}, err
+	}
+	lineTax := make([]gst.Tax, len(lines))
+	var cgst, sgst, igst, shippingRate int
+	for i, l := range lines {
+		taxable := dlines[i].total - dlines[i].discount
+		rate := lineGSTRate(rates, gstSettings.FallbackRateBps, l.hsn, taxable, l.qty)
+		lineTax[i] = gst.Compute(taxable, rate, interState)
+		cgst += lineTax[i].CGSTINR
+		sgst += lineTax[i].SGSTINR
+		igst += lineTax[i].IGSTINR
+		shippingRate = max(shippingRate, rate)
+	}
+	shipping := quote.RateINR
+	shippingTax := gst.Compute(shipping, shippingRate, interState)
+	cgst += shippingTax.CGSTINR
+	sgst += shippingTax.SGSTINR
+	igst += shippingTax.IGSTINR
+	tax := cgst + sgst + igst
+	total := subtotal - discount + shipping + tax
 
 	var orderID uuid.UUID
 	err = tx.QueryRow(ctx, `
-INSERT INTO orders (status, currency, subtotal_inr, shipping_inr, tax_inr, total_inr, customer_name, customer_phone, customer_email, shipping_address)
-VALUES ('pending_payment','INR',$1,$2,$3,$4,$5,$6,$7,$8)
+INSERT INTO orders (
+  status, currency, subtotal_inr, discount_inr, shipping_inr, tax_inr, total_inr,
+  customer_name, customer_phone, customer_email, shipping_address,
+  seller_state, place_of_supply, cgst_inr, sgst_inr, igst_inr,
+  shipping_gst_rate_bps, shipping_cgst_inr, shipping_sgst_inr, shipping_igst_inr,
+  shipping_zone_id, shipping_weight_grams, cod_surcharge_inr, customer_user_id, cart_id
+)
+VALUES ('draft','INR',$1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,
+  -- A guest order is linked to the customer whose verified phone it gives.
+  COALESCE($22::uuid, (
+    SELECT id FROM users
+    WHERE phone_verified_at IS NOT NULL AND right(phone, 10) = right(regexp_replace($7, '\D', '', 'g'), 10)
+  )),
+  $23
+)
 RETURNING id
-`, subtotal, shipping, tax, total, customer.Name, customer.Phone, customer.Email, customer.Address).Scan(&orderID)
+`, subtotal, discount, shipping, tax, total,
+		customer.Name, customer.Phone, customer.Email, addr,
+		gstSettings.SellerState, pos.Code, cgst, sgst, igst,
+		shippingTax.RateBps, shippingTax.CGSTINR, shippingTax.SGSTINR, shippingTax.IGSTINR,
+		quote.ZoneID, quote.WeightGrams, quote.CODSurchargeINR, customer.UserID, cartID,
+	).Scan(&orderID)
 	if err != nil {
 		return CheckoutResult{}, err
 	}
+	actor := Actor{Source: ActorSourceCheckout}
+	if err := recordStatusChange(ctx, tx, orderID, "order", "", OrderDraft, actor, ""); err != nil {
+		return CheckoutResult{}, err
+	}
 
-	for _, l := range lines {
+	for i, l := range lines {
 		lineTotal := l.unit * l.qty
+		t := lineTax[i]
 		_, err := tx.Exec(ctx, `
-INSERT INTO order_items (order_id, variant_id, sku, product_name, variant_title, unit_price_inr, quantity, line_total_inr)
-VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-`, orderID, l.variantID, l.sku, l.pname, l.vtitle, l.unit, l.qty, lineTotal)
+INSERT INTO order_items (
+  order_id, variant_id, sku, product_name, variant_title, unit_price_inr, quantity, line_total_inr, discount_inr,
+  hsn_code, taxable_value_inr, gst_rate_bps, cgst_inr, sgst_inr, igst_inr
+)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)
+`, orderID, l.variantID, l.sku, l.pname, l.vtitle, l.unit, l.qty, lineTotal, dlines[i].discount,
+			l.hsn, t.TaxableINR, t.RateBps, t.CGSTINR, t.SGSTINR, t.IGSTINR)
 		if err != nil {
 			return CheckoutResult{}, err
 		}
-
-		// Reserve inventory
-		var onHand, reserved int
-		if err := tx.QueryRow(ctx, `
-SELECT on_hand, reserved FROM inventory WHERE variant_id=$1 FOR UPDATE
-`, l.variantID).Scan(&onHand, &reserved); err != nil {
-			return CheckoutResult{}, err
-		}
-		if onHand-reserved < l.qty {
-			return CheckoutResult{}, ErrInsufficientStock
-		}
-		_, err = tx.Exec(ctx, `
-UPDATE inventory SET reserved = reserved + $2, updated_at=now() WHERE variant_id=$1
-`, l.variantID, l.qty)
+	}
+	for _, d := range discounts {
+		_, err := tx.Exec(ctx, `
+INSERT INTO order_discounts (order_id, discount_id, code, name, amount_inr)
+VALUES ($1,$2,$3,$4,$5)
+`, orderID, d.DiscountID, d.Code, d.Name, d.AmountINR)
 		if err != nil {
 			return CheckoutResult{}, err
 		}
 	}
 
+	// Reserves inventory for every line.
+	if _, err := transitionOrder(ctx, tx, orderID, OrderPendingPayment, actor, "checkout"); err != nil {
+		return CheckoutResult{}, err
+	}
+
 	var paymentID uuid.UUID
 	err = tx.QueryRow(ctx, `
 INSERT INTO payments (order_id, provider, status, amount_inr)
-VALUES ($1,'razorpay','created',$2)
+VALUES ($1,$2,'created',$3)
 RETURNING id
-`, orderID, total).Scan(&paymentID)
+`, orderID, provider, total).Scan(&paymentID)
 	if err != nil {
 		return CheckoutResult{}, err
 	}
+	if err := recordStatusChange(ctx, tx, orderID, "payment", "", PaymentCreated, actor, ""); err != nil {
+		return CheckoutResult{}, err
+	}
+	if shippingOpts.CashOnDelivery {
+		// Paid on delivery; the stock stays reserved until then.
+		if _, err := transitionOrder(ctx, tx, orderID, OrderConfirmed, actor, "cash on delivery"); err != nil {
+			return CheckoutResult{}, err
+		}
+	}
 
 	_, err = tx.Exec(ctx, `UPDATE carts SET status='checked_out', updated_at=now() WHERE id=$1`, cartID)
 	if err != nil {
@@ -589,15 +945,43 @@ RETURNING id
 		return CheckoutResult{}, err
 	}
 
+	if discounts == nil {
+		discounts = []AppliedDiscount{}
+	}
 	return CheckoutResult{
-		OrderID:   orderID,
-		PaymentID: paymentID,
-		AmountINR: total,
-		Currency:  "INR",
-		Provider:  "razorpay",
+		OrderID:     orderID,
+		PaymentID:   paymentID,
+		AmountINR:   total,
+		Currency:    "INR",
+		Provider:    provider,
+		DiscountINR: discount,
+		Discounts:   discounts,
 	}, nil
 }
 
+// PendingCartCheckout returns the order a checked-out cart was turned into
+// while its payment has not started, so a checkout retried after the payment
+// could not be set up gets the same order. Otherwise it fails with
+// ErrNotFound.
+func (s *Store) PendingCartCheckout(ctx context.Context, cartID uuid.UUID) (CheckoutResult, error) {
+	res := CheckoutResult{Discounts: []AppliedDiscount{}}
+	err := s.db.QueryRow(ctx, `
+SELECT o.id, p.id, p.amount_inr, o.currency, p.provider, o.discount_inr, p.razorpay_order_id
+FROM orders o
+JOIN payments p ON p.order_id = o.id
+WHERE o.cart_id = $1 AND o.status = 'pending_payment' AND p.status = 'created'
+ORDER BY o.created_at DESC
+LIMIT 1
+`, cartID).Scan(&res.OrderID, &res.PaymentID, &res.AmountINR, &res.Currency, &res.Provider, &res.DiscountINR, &res.ProviderOrderID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return CheckoutResult{}, ErrNotFound
+		}
+		return CheckoutResult{}, err
+	}
+	return res, nil
+}
+
 func (s *Store) SetPaymentRazorpayOrderID(ctx context.Context, paymentID uuid.UUID, razorpayOrderID string) error {
 	ct, err := s.db.Exec(ctx, `
 UPDATE payments
@@ -613,161 +997,173 @@ WHERE id=$1
 	return nil
 }
 
-func (s *Store) MarkPaymentAuthorized(ctx context.Context, razorpayOrderID, razorpayPaymentID, razorpaySignature string) error {
-	ct, err := s.db.Exec(ctx, `
-UPDATE payments
-SET status='authorized', razorpay_payment_id=$2, razorpay_signature=$3, updated_at=now()
-WHERE razorpay_order_id=$1 AND status IN ('created','authorized')
-`, razorpayOrderID, razorpayPaymentID, razorpaySignature)
-	if err != nil {
-		return err
-	}
-	if ct.RowsAffected() == 0 {
-		// Either not found or already in a terminal state; treat as idempotent.
-		return nil
+// PaymentStatus returns the status of a payment.
+func (s *Store) PaymentStatus(ctx context.Context, paymentID uuid.UUID) (string, error) {
+	var status string
+	if err := s.db.QueryRow(ctx, `SELECT status FROM payments WHERE id=$1`, paymentID).Scan(&status); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", err
 	}
-	return nil
+	return status, nil
 }
 
-func (s *Store) MarkPaymentCaptured(ctx context.Context, razorpayOrderID, razorpayPaymentID string) error {
+// MarkPaymentAuthorized records a verified Checkout signature. A payment that is
+// already captured is left as is.
+func (s *Store) MarkPaymentAuthorized(ctx context.Context, razorpayOrderID, razorpayPaymentID, razorpaySignature string, actor Actor) error {
 	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
-	var paymentID uuid.UUID
-	var orderID uuid.UUID
-	var payStatus string
-	if err := tx.QueryRow(ctx, `
-SELECT id, order_id, status
-FROM payments
-WHERE razorpay_order_id=$1
-FOR UPDATE
-`, razorpayOrderID).Scan(&paymentID, &orderID, &payStatus); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return ErrNotFound
-		}
+	paymentID, _, payStatus, err := lockPaymentByRazorpayOrderID(ctx, tx, razorpayOrderID)
+	if err != nil {
 		return err
 	}
-	if payStatus == "captured" {
+	if payStatus == PaymentCaptured {
 		return tx.Commit(ctx)
 	}
-
+	if _, err := transitionPayment(ctx, tx, paymentID, PaymentAuthorized, actor, ""); err != nil {
+		return err
+	}
 	_, err = tx.Exec(ctx, `
 UPDATE payments
-SET status='captured', razorpay_payment_id=$2, updated_at=now()
+SET razorpay_payment_id=$2,
+    razorpay_signature=CASE WHEN $3 = '' THEN razorpay_signature ELSE $3 END,
+    updated_at=now()
 WHERE id=$1
-`, paymentID, razorpayPaymentID)
+`, paymentID, razorpayPaymentID, razorpaySignature)
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec(ctx, `
-UPDATE orders
-SET status='paid', updated_at=now()
-WHERE id=$1 AND status='pending_payment'
-`, orderID)
+	return tx.Commit(ctx)
+}
+
+// MarkPaymentCaptured records a capture of amountINR (paise) in currency. A
+// capture matching the payment moves the order to paid; any other amount or
+// currency moves it to payment_mismatch for an admin to accept or refund, with
+// the stock still reserved. A capture of a payment that already failed, e.g.
+// after its order expired or was cancelled, is held in payment_mismatch too.
+func (s *Store) MarkPaymentCaptured(ctx context.Context, razorpayOrderID, razorpayPaymentID string, amountINR int, currency string, actor Actor) error {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	rows, err := tx.Query(ctx, `SELECT variant_id, quantity FROM order_items WHERE order_id=$1`, orderID)
+	paymentID, orderID, payStatus, err := lockPaymentByRazorpayOrderID(ctx, tx, razorpayOrderID)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var variantID uuid.UUID
-		var qty int
-		if err := rows.Scan(&variantID, &qty); err != nil {
+	if payStatus == PaymentCaptured {
+		return tx.Commit(ctx)
+	}
+
+	var expectedINR int
+	var expectedCurrency string
+	err = tx.QueryRow(ctx, `
+SELECT p.amount_inr, o.currency
+FROM payments p
+JOIN orders o ON o.id = p.order_id
+WHERE p.id=$1
+`, paymentID).Scan(&expectedINR, &expectedCurrency)
+	if err != nil {
+		return err
+	}
+
+	if _, err := transitionPayment(ctx, tx, paymentID, PaymentCaptured, actor, ""); err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+UPDATE payments
+SET razorpay_payment_id=$2, captured_amount_inr=$3, captured_currency=$4, updated_at=now()
+WHERE id=$1
+`, paymentID, razorpayPaymentID, amountINR, currency)
+	if err != nil {
+		return err
+	}
+
+	if payStatus == PaymentFailed {
+		note := fmt.Sprintf("captured %d %s after the payment failed", amountINR, currency)
+		if _, err := transitionOrder(ctx, tx, orderID, OrderPaymentMismatch, actor, note); err != nil {
 			return err
 		}
-		_, err = tx.Exec(ctx, `
-UPDATE inventory
-SET on_hand = on_hand - $2,
-    reserved = GREATEST(0, reserved - $2),
-    updated_at=now()
-WHERE variant_id=$1
-`, variantID, qty)
-		if err != nil {
+		return tx.Commit(ctx)
+	}
+	if amountINR != expectedINR || !strings.EqualFold(currency, expectedCurrency) {
+		note := fmt.Sprintf("captured %d %s, expected %d %s", amountINR, currency, expectedINR, expectedCurrency)
+		if _, err := transitionOrder(ctx, tx, orderID, OrderPaymentMismatch, actor, note); err != nil {
 			return err
 		}
+		return tx.Commit(ctx)
 	}
-	if err := rows.Err(); err != nil {
+	// Commits the reserved stock.
+	if _, err := transitionOrder(ctx, tx, orderID, OrderPaid, actor, "payment captured"); err != nil {
 		return err
 	}
 	return tx.Commit(ctx)
 }
 
-func (s *Store) MarkPaymentFailed(ctx context.Context, razorpayOrderID, razorpayPaymentID string) error {
+// MarkPaymentFailed fails a payment and, if its order is still awaiting
+// payment, fails the order and releases its reservation. Failures reported
+// after a capture (e.g. for an earlier attempt) are ignored.
+func (s *Store) MarkPaymentFailed(ctx context.Context, razorpayOrderID, razorpayPaymentID string, actor Actor) error {
 	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
-	var paymentID uuid.UUID
-	var orderID uuid.UUID
-	var payStatus string
-	if err := tx.QueryRow(ctx, `
-SELECT id, order_id, status
-FROM payments
-WHERE razorpay_order_id=$1
-FOR UPDATE
-`, razorpayOrderID).Scan(&paymentID, &orderID, &payStatus); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return ErrNotFound
-		}
+	paymentID, orderID, payStatus, err := lockPaymentByRazorpayOrderID(ctx, tx, razorpayOrderID)
+	if err != nil {
 		return err
 	}
-	if payStatus == "failed" || payStatus == "captured" {
+	if payStatus == PaymentFailed || payStatus == PaymentCaptured || payStatus == PaymentRefunded {
 		return tx.Commit(ctx)
 	}
-
+	if _, err := transitionPayment(ctx, tx, paymentID, PaymentFailed, actor, ""); err != nil {
+		return err
+	}
 	_, err = tx.Exec(ctx, `
 UPDATE payments
-SET status='failed', razorpay_payment_id=$2, updated_at=now()
+SET razorpay_payment_id=$2, updated_at=now()
 WHERE id=$1
 `, paymentID, razorpayPaymentID)
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec(ctx, `
-UPDATE orders
-SET status='failed', updated_at=now()
-WHERE id=$1 AND status='pending_payment'
-`, orderID)
-	if err != nil {
-		return err
-	}
 
-	rows, err := tx.Query(ctx, `SELECT variant_id, quantity FROM order_items WHERE order_id=$1`, orderID)
-	if err != nil {
+	var orderStatus string
+	if err := tx.QueryRow(ctx, `SELECT status FROM orders WHERE id=$1 FOR UPDATE`, orderID).Scan(&orderStatus); err != nil {
 		return err
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var variantID uuid.UUID
-		var qty int
-		if err := rows.Scan(&variantID, &qty); err != nil {
-			return err
-		}
-		_, err = tx.Exec(ctx, `
-UPDATE inventory
-SET reserved = GREATEST(0, reserved - $2),
-    updated_at=now()
-WHERE variant_id=$1
-`, variantID, qty)
-		if err != nil {
+	if orderStatus == OrderPendingPayment {
+		// Releases the reserved stock.
+		if _, err := transitionOrder(ctx, tx, orderID, OrderFailed, actor, "payment failed"); err != nil {
 			return err
 		}
 	}
-	if err := rows.Err(); err != nil {
-		return err
-	}
 	return tx.Commit(ctx)
 }
 
+func lockPaymentByRazorpayOrderID(ctx context.Context, tx pgx.Tx, razorpayOrderID string) (paymentID, orderID uuid.UUID, status string, err error) {
+	err = tx.QueryRow(ctx, `
+SELECT id, order_id, status
+FROM payments
+WHERE razorpay_order_id=$1
+FOR UPDATE
+`, razorpayOrderID).Scan(&paymentID, &orderID, &status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, uuid.Nil, "", ErrNotFound
+		}
+		return uuid.Nil, uuid.Nil, "", err
+	}
+	return paymentID, orderID, status, nil
+}
+
 type OrderSummary struct {
 	ID        uuid.UUID `json:"id"`
 	Status    string    `json:"status"`
@@ -804,29 +1200,42 @@ type OrderDetail struct {
 	ID             uuid.UUID        `json:"id"`
 	Status         string           `json:"status"`
 	SubtotalINR    int              `json:"subtotal_inr"`
+	DiscountINR    int              `json:"discount_inr"`
 	ShippingINR    int              `json:"shipping_inr"`
+	CODSurchargeINR int             `json:"cod_surcharge_inr"` // included in shipping_inr
 	TaxINR         int              `json:"tax_inr"`
 	TotalINR       int              `json:"total_inr"`
 	CustomerName   string           `json:"customer_name"`
 	CustomerPhone  string           `json:"customer_phone"`
 	CustomerEmail  string           `json:"customer_email"`
-	ShippingAddr   map[string]any   `json:"shipping_address"`
+	ShippingAddr   Address          `json:"shipping_address"`
 	Items          []CartItem       `json:"items"`
+	Discounts      []AppliedDiscount `json:"discounts"`
+	Tax            OrderTax         `json:"tax"`
 	PaymentStatus  string           `json:"payment_status"`
+	PaymentProvider string          `json:"payment_provider"`
 	RazorpayOrderID string          `json:"razorpay_order_id"`
+	Refunds        []Refund         `json:"refunds"`
+	Fulfillment     []LineFulfillment `json:"fulfillment"`
+	Shipments       []Shipment        `json:"shipments"`
+	Returns         []Return          `json:"returns"`
+	// ExchangeForReturnID is set on exchange orders, which ship the
+	// replacements of a return at no charge.
+	ExchangeForReturnID *uuid.UUID `json:"exchange_for_return_id,omitempty"`
+	StatusHistory  []StatusChange   `json:"status_history"`
 	CreatedAt      time.Time        `json:"created_at"`
 }
 
 func (s *Store) AdminGetOrder(ctx context.Context, orderID uuid.UUID) (OrderDetail, error) {
 	var o OrderDetail
 	err := s.db.QueryRow(ctx, `
-SELECT id, status, subtotal_inr, shipping_inr, tax_inr, total_inr,
-       customer_name, customer_phone, customer_email, shipping_address, created_at
+SELECT id, status, subtotal_inr, discount_inr, shipping_inr, cod_surcharge_inr, tax_inr, total_inr,
+       customer_name, customer_phone, customer_email, shipping_address, exchange_for_return_id, created_at
 FROM orders
 WHERE id=$1
 `, orderID).Scan(
-		&o.ID, &o.Status, &o.SubtotalINR, &o.ShippingINR, &o.TaxINR, &o.TotalINR,
-		&o.CustomerName, &o.CustomerPhone, &o.CustomerEmail, &o.ShippingAddr, &o.CreatedAt,
+		&o.ID, &o.Status, &o.SubtotalINR, &o.DiscountINR, &o.ShippingINR, &o.CODSurchargeINR, &o.TaxINR, &o.TotalINR,
+		&o.CustomerName, &o.CustomerPhone, &o.CustomerEmail, &o.ShippingAddr, &o.ExchangeForReturnID, &o.CreatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -836,10 +1245,10 @@ WHERE id=$1
 	}
 
 	err = s.db.QueryRow(ctx, `
-SELECT status, razorpay_order_id
+SELECT status, provider, razorpay_order_id
 FROM payments
 WHERE order_id=$1
-`, orderID).Scan(&o.PaymentStatus, &o.RazorpayOrderID)
+`, orderID).Scan(&o.PaymentStatus, &o.PaymentProvider, &o.RazorpayOrderID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			o.PaymentStatus = "missing"
@@ -870,6 +1279,35 @@ WHERE order_id=$1
 	if err := rows.Err(); err != nil {
 		return OrderDetail{}, err
 	}
+
+	o.Discounts, err = s.loadOrderDiscounts(ctx, orderID)
+	if err != nil {
+		return OrderDetail{}, err
+	}
+	o.Tax, err = s.loadOrderTax(ctx, orderID)
+	if err != nil {
+		return OrderDetail{}, err
+	}
+	o.Refunds, err = s.loadOrderRefunds(ctx, orderID)
+	if err != nil {
+		return OrderDetail{}, err
+	}
+	o.Fulfillment, err = loadLineFulfillment(ctx, s.db, orderID)
+	if err != nil {
+		return OrderDetail{}, err
+	}
+	o.Shipments, err = s.loadOrderShipments(ctx, orderID)
+	if err != nil {
+		return OrderDetail{}, err
+	}
+	o.Returns, err = s.loadOrderReturns(ctx, orderID)
+	if err != nil {
+		return OrderDetail{}, err
+	}
+	o.StatusHistory, err = s.loadStatusHistory(ctx, orderID)
+	if err != nil {
+		return OrderDetail{}, err
+	}
 	return o, nil
 }
 
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Webhook event statuses (webhook_events.status).
+const (
+	WebhookPending   = "pending"
+	WebhookProcessed = "processed"
+	WebhookFailed    = "failed"
+)
+
+type WebhookEvent struct {
+	ID            uuid.UUID       `json:"id"`
+	Provider      string          `json:"provider"`
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	ReceivedAt    time.Time       `json:"received_at"`
+	ProcessedAt   *time.Time      `json:"processed_at,omitempty"`
+}
+
+// RecordWebhookEvent stores a verified webhook for processing. A redelivery of
+// an event already stored is reported as a duplicate and left untouched.
+func (s *Store) RecordWebhookEvent(ctx context.Context, provider, eventID, eventType string, payload []byte) (duplicate bool, err error) {
+	ct, err := s.db.Exec(ctx, `
+INSERT INTO webhook_events (provider, event_id, event_type, payload)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (provider, event_id) DO NOTHING
+`, provider, eventID, eventType, payload)
+	if err != nil {
+		return false, err
+	}
+	return ct.RowsAffected() == 0, nil
+}
+
+// ClaimWebhookEvent takes the oldest due pending event and counts the attempt.
+// The event stays pending but is not due again for lease, so an instance that
+// dies mid-processing only delays it. ok is false when nothing is due.
+func (s *Store) ClaimWebhookEvent(ctx context.Context, lease time.Duration) (evt WebhookEvent, ok bool, err error) {
+	err = s.db.QueryRow(ctx, `
+UPDATE webhook_events
+SET attempts = attempts + 1, next_attempt_at = now() + make_interval(secs => $1)
+WHERE id = (
+  SELECT id FROM webhook_events
+  WHERE status = 'pending' AND next_attempt_at <= now()
+  ORDER BY next_attempt_at ASC
+  LIMIT 1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, provider, event_id, event_type, payload, status, attempts, last_error, next_attempt_at, received_at, processed_at
+`, lease.Seconds()).Scan(
+		&evt.ID, &evt.Provider, &evt.EventID, &evt.EventType, &evt.Payload, &evt.Status,
+		&evt.Attempts, &evt.LastError, &evt.NextAttemptAt, &evt.ReceivedAt, &evt.ProcessedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return WebhookEvent{}, false, nil
+		}
+		return WebhookEvent{}, false, err
+	}
+	return evt, true, nil
+}
+
+func (s *Store) MarkWebhookEventProcessed(ctx context.Context, id uuid.UUID) error {
+	_, err := s.db.Exec(ctx, `
+UPDATE webhook_events
+SET status='processed', last_error='', processed_at=now()
+WHERE id=$1
+`, id)
+	return err
+}
+
+// RetryWebhookEvent records a failed attempt and schedules the next one.
+func (s *Store) RetryWebhookEvent(ctx context.Context, id uuid.UUID, lastError string, delay time.Duration) error {
+	_, err := s.db.Exec(ctx, `
+UPDATE webhook_events
+SET last_error=$2, next_attempt_at=now() + make_interval(secs => $3)
+WHERE id=$1
+`, id, lastError, delay.Seconds())
+	return err
+}
+
+// MarkWebhookEventFailed gives up on an event until an admin replays it.
+func (s *Store) MarkWebhookEventFailed(ctx context.Context, id uuid.UUID, lastError string) error {
+	_, err := s.db.Exec(ctx, `
+UPDATE webhook_events
+SET status='failed', last_error=$2
+WHERE id=$1
+`, id, lastError)
+	return err
+}
+
+// ReplayWebhookEvent queues an event to be processed again from scratch.
+func (s *Store) ReplayWebhookEvent(ctx context.Context, id uuid.UUID) error {
+	ct, err := s.db.Exec(ctx, `
+UPDATE webhook_events
+SET status='pending', attempts=0, next_attempt_at=now(), processed_at=NULL
+WHERE id=$1
+`, id)
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type WebhookEventPage struct {
+	Events     []WebhookEvent `json:"events"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// AdminListWebhookEvents pages through received webhooks, newest first. An
+// empty status lists every event.
+func (s *Store) AdminListWebhookEvents(ctx context.Context, status string, limit int, cursor string) (WebhookEventPage, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	var args sqlArgs
+	conds := "TRUE"
+	if status != "" {
+		conds += " AND status = " + args.add(status)
+	}
+	if cursor != "" {
+		t, id, err := decodeTimeCursor(cursor)
+		if err != nil {
+			return WebhookEventPage{}, err
+		}
+		conds += " AND (received_at, id) < (" + args.add(t) + ", " + args.add(id) + ")"
+	}
+	rows, err := s.db.Query(ctx, `
+SELECT id, provider, event_id, event_type, payload, status, attempts, last_error, next_attempt_at, received_at, processed_at
+FROM webhook_events
+WHERE `+conds+`
+ORDER BY received_at DESC, id DESC
+LIMIT `+args.add(limit+1), args...)
+	if err != nil {
+		return WebhookEventPage{}, err
+	}
+	defer rows.Close()
+
+	page := WebhookEventPage{Events: []WebhookEvent{}}
+	for rows.Next() {
+		var e WebhookEvent
+		if err := rows.Scan(&e.ID, &e.Provider, &e.EventID, &e.EventType, &e.Payload, &e.Status, &e.Attempts, &e.LastError, &e.NextAttemptAt, &e.ReceivedAt, &e.ProcessedAt); err != nil {
+			return WebhookEventPage{}, err
+		}
+		page.Events = append(page.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return WebhookEventPage{}, err
+	}
+	if len(page.Events) > limit {
+		page.Events = page.Events[:limit]
+		last := page.Events[limit-1]
+		page.NextCursor = encodeTimeCursor(last.ReceivedAt, last.ID)
+	}
+	return page, nil
+}
+
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS product_categories_category_id_idx;
+
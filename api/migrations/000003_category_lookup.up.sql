@@ -0,0 +1,2 @@
+CREATE INDEX product_categories_category_id_idx ON product_categories(category_id);
+
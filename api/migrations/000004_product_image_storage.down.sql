@@ -0,0 +1,2 @@
+ALTER TABLE product_images DROP COLUMN IF EXISTS storage_key;
+
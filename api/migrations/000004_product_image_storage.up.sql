@@ -0,0 +1,2 @@
+ALTER TABLE product_images ADD COLUMN storage_key TEXT NOT NULL DEFAULT '';
+
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS product_variants_price_inr_idx;
+DROP INDEX IF EXISTS product_variants_color_idx;
+DROP INDEX IF EXISTS product_variants_size_idx;
+DROP INDEX IF EXISTS products_active_created_at_idx;
+
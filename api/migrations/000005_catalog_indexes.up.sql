@@ -0,0 +1,5 @@
+CREATE INDEX products_active_created_at_idx ON products(created_at DESC, id DESC) WHERE status = 'active';
+CREATE INDEX product_variants_size_idx ON product_variants(size);
+CREATE INDEX product_variants_color_idx ON product_variants(color);
+CREATE INDEX product_variants_price_inr_idx ON product_variants(price_inr);
+
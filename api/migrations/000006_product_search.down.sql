@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS products_search_text_trgm_idx;
+DROP INDEX IF EXISTS products_search_document_idx;
+ALTER TABLE products
+  DROP COLUMN IF EXISTS search_text,
+  DROP COLUMN IF EXISTS search_document;
+
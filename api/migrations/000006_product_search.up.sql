@@ -0,0 +1,26 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Maintained by the API whenever a product, its variants or its categories change.
+ALTER TABLE products
+  ADD COLUMN search_document TSVECTOR NOT NULL DEFAULT ''::tsvector,
+  ADD COLUMN search_text TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX products_search_document_idx ON products USING GIN (search_document);
+CREATE INDEX products_search_text_trgm_idx ON products USING GIN (search_text gin_trgm_ops);
+
+UPDATE products p SET
+  search_document =
+    setweight(to_tsvector('simple', p.name), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(d.skus, '')), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(d.colors, '') || ' ' || COALESCE(d.categories, '')), 'B') ||
+    setweight(to_tsvector('simple', p.description), 'C'),
+  search_text = lower(concat_ws(' ', p.name, d.skus, d.colors, d.categories))
+FROM (
+  SELECT p2.id,
+    (SELECT string_agg(v.sku, ' ') FROM product_variants v WHERE v.product_id = p2.id) AS skus,
+    (SELECT string_agg(DISTINCT v.color, ' ') FROM product_variants v WHERE v.product_id = p2.id) AS colors,
+    (SELECT string_agg(c.name, ' ') FROM product_categories pc JOIN categories c ON c.id = pc.category_id WHERE pc.product_id = p2.id) AS categories
+  FROM products p2
+) d
+WHERE p.id = d.id;
+
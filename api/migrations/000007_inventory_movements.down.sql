@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS inventory_movements;
+DROP FUNCTION IF EXISTS inventory_movements_append_only();
+
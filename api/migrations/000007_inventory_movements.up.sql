@@ -0,0 +1,32 @@
+-- Append-only ledger of every change to inventory.on_hand / inventory.reserved.
+CREATE TABLE inventory_movements (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  variant_id UUID NOT NULL REFERENCES product_variants(id) ON DELETE RESTRICT,
+  reason TEXT NOT NULL CHECK (reason IN ('opening_balance','initial_stock','adjustment','reserve','release','sale')),
+  delta_on_hand INTEGER NOT NULL DEFAULT 0,
+  delta_reserved INTEGER NOT NULL DEFAULT 0,
+  order_id UUID NULL REFERENCES orders(id),
+  actor_user_id UUID NULL REFERENCES users(id),
+  note TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX inventory_movements_variant_id_idx ON inventory_movements(variant_id, created_at DESC, id DESC);
+CREATE INDEX inventory_movements_order_id_idx ON inventory_movements(order_id);
+
+CREATE FUNCTION inventory_movements_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'inventory_movements is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER inventory_movements_append_only
+BEFORE UPDATE OR DELETE ON inventory_movements
+FOR EACH ROW EXECUTE FUNCTION inventory_movements_append_only();
+
+-- Seed the ledger with current stock so it reconciles from day one.
+INSERT INTO inventory_movements (variant_id, reason, delta_on_hand, delta_reserved, note)
+SELECT variant_id, 'opening_balance', on_hand, reserved, 'ledger introduced'
+FROM inventory
+WHERE on_hand <> 0 OR reserved <> 0;
+
@@ -0,0 +1,23 @@
+CREATE TABLE order_status_history (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  subject TEXT NOT NULL CHECK (subject IN ('order','payment')),
+  from_status TEXT NULL,
+  to_status TEXT NOT NULL,
+  actor_user_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+  actor_source TEXT NOT NULL,
+  note TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX order_status_history_order_id_idx ON order_status_history(order_id, created_at);
+
+-- Existing orders start their history at their current status.
+INSERT INTO order_status_history (order_id, subject, from_status, to_status, actor_source, note, created_at)
+SELECT id, 'order', NULL, status, 'migration', 'history introduced', updated_at
+FROM orders;
+
+INSERT INTO order_status_history (order_id, subject, from_status, to_status, actor_source, note, created_at)
+SELECT order_id, 'payment', NULL, status, 'migration', 'history introduced', updated_at
+FROM payments;
+
@@ -0,0 +1,5 @@
+-- The ledger is append-only, so existing restock rows are kept and only new ones are rejected.
+ALTER TABLE inventory_movements DROP CONSTRAINT inventory_movements_reason_check;
+ALTER TABLE inventory_movements ADD CONSTRAINT inventory_movements_reason_check
+  CHECK (reason IN ('opening_balance','initial_stock','adjustment','reserve','release','sale')) NOT VALID;
+
@@ -0,0 +1,5 @@
+-- Refunded goods can be put back into stock.
+ALTER TABLE inventory_movements DROP CONSTRAINT inventory_movements_reason_check;
+ALTER TABLE inventory_movements ADD CONSTRAINT inventory_movements_reason_check
+  CHECK (reason IN ('opening_balance','initial_stock','adjustment','reserve','release','sale','restock'));
+
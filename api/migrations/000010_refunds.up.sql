@@ -0,0 +1,16 @@
+CREATE TABLE refunds (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','processed','failed')),
+  amount_inr INTEGER NOT NULL CHECK (amount_inr > 0),
+  razorpay_refund_id TEXT NULL UNIQUE,
+  restock BOOLEAN NOT NULL DEFAULT false,
+  reason TEXT NOT NULL DEFAULT '',
+  failure_reason TEXT NOT NULL DEFAULT '',
+  actor_user_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX refunds_payment_id_idx ON refunds(payment_id);
+
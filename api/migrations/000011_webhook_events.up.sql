@@ -0,0 +1,19 @@
+-- Inbox of verified provider webhooks, processed asynchronously with retries.
+CREATE TABLE webhook_events (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  provider TEXT NOT NULL,
+  event_id TEXT NOT NULL,
+  event_type TEXT NOT NULL DEFAULT '',
+  payload JSONB NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','processed','failed')),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  last_error TEXT NOT NULL DEFAULT '',
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  received_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  processed_at TIMESTAMPTZ NULL,
+  UNIQUE (provider, event_id)
+);
+
+CREATE INDEX webhook_events_due_idx ON webhook_events(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_events_status_idx ON webhook_events(status, received_at DESC, id DESC);
+
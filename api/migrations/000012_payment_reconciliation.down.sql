@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS payment_reconciliation_issues;
+DROP INDEX IF EXISTS payments_unsettled_idx;
+ALTER TABLE payments DROP COLUMN IF EXISTS reconciled_at;
+
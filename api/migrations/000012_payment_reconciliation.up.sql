@@ -0,0 +1,24 @@
+ALTER TABLE payments ADD COLUMN reconciled_at TIMESTAMPTZ NULL;
+
+CREATE INDEX payments_unsettled_idx ON payments(updated_at) WHERE status IN ('created','authorized');
+
+-- Differences between local payments and Razorpay found by the reconciliation
+-- worker. A re-run finding the same issue only bumps last_seen_at.
+CREATE TABLE payment_reconciliation_issues (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+  kind TEXT NOT NULL CHECK (kind IN ('amount_mismatch','unknown_payment','order_not_found','transition_rejected')),
+  razorpay_payment_id TEXT NOT NULL DEFAULT '',
+  expected_amount_inr INTEGER NOT NULL DEFAULT 0,
+  actual_amount_inr INTEGER NOT NULL DEFAULT 0,
+  currency TEXT NOT NULL DEFAULT '',
+  detail TEXT NOT NULL DEFAULT '',
+  first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  resolved_at TIMESTAMPTZ NULL,
+  resolved_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+  UNIQUE (payment_id, kind, razorpay_payment_id)
+);
+
+CREATE INDEX payment_reconciliation_issues_open_idx ON payment_reconciliation_issues(last_seen_at DESC) WHERE resolved_at IS NULL;
+
@@ -0,0 +1,6 @@
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_provider_check;
+
+ALTER TABLE orders DROP CONSTRAINT orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+  CHECK (status IN ('draft','pending_payment','paid','failed','cancelled','fulfilled','refunded')) NOT VALID;
+
@@ -0,0 +1,7 @@
+-- Cash-on-delivery orders are confirmed at checkout and paid when delivered.
+ALTER TABLE orders DROP CONSTRAINT orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+  CHECK (status IN ('draft','pending_payment','confirmed','paid','failed','cancelled','fulfilled','refunded'));
+
+ALTER TABLE payments ADD CONSTRAINT payments_provider_check CHECK (provider IN ('razorpay','cod'));
+
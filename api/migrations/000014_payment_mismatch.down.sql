@@ -0,0 +1,8 @@
+ALTER TABLE payments
+  DROP COLUMN IF EXISTS captured_currency,
+  DROP COLUMN IF EXISTS captured_amount_inr;
+
+ALTER TABLE orders DROP CONSTRAINT orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+  CHECK (status IN ('draft','pending_payment','confirmed','paid','failed','cancelled','fulfilled','refunded')) NOT VALID;
+
@@ -0,0 +1,11 @@
+-- Captures whose amount or currency differ from the order wait for admin review.
+ALTER TABLE orders DROP CONSTRAINT orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+  CHECK (status IN ('draft','pending_payment','confirmed','payment_mismatch','paid','failed','cancelled','fulfilled','refunded'));
+
+-- What the provider actually captured; NULL until captured (or for captures
+-- recorded before this migration, which were not checked).
+ALTER TABLE payments
+  ADD COLUMN captured_amount_inr INTEGER NULL,
+  ADD COLUMN captured_currency TEXT NULL;
+
@@ -0,0 +1,16 @@
+-- Responses of requests sent with an Idempotency-Key, replayed on retries.
+-- A row without response_status belongs to a request still being handled.
+CREATE TABLE idempotency_keys (
+  scope TEXT NOT NULL,
+  key TEXT NOT NULL,
+  request_hash TEXT NOT NULL,
+  response_status INTEGER NULL,
+  response_content_type TEXT NOT NULL DEFAULT '',
+  response_body BYTEA NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ NULL,
+  PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys(created_at);
+
@@ -0,0 +1,2 @@
+ALTER TABLE cart_items DROP COLUMN IF EXISTS unit_price_inr;
+
@@ -0,0 +1,10 @@
+-- Price of a cart line when it was last added, to warn about later changes.
+ALTER TABLE cart_items ADD COLUMN unit_price_inr INTEGER NULL;
+
+UPDATE cart_items ci
+SET unit_price_inr = v.price_inr
+FROM product_variants v
+WHERE v.id = ci.variant_id;
+
+ALTER TABLE cart_items ALTER COLUMN unit_price_inr SET NOT NULL;
+
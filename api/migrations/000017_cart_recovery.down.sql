@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS carts_recovery_due_idx;
+DROP INDEX IF EXISTS carts_open_updated_at_idx;
+
+ALTER TABLE carts
+  DROP COLUMN IF EXISTS recovery_sent_at,
+  DROP COLUMN IF EXISTS abandoned_at,
+  DROP COLUMN IF EXISTS contact_email,
+  DROP COLUMN IF EXISTS contact_phone,
+  DROP COLUMN IF EXISTS contact_name;
+
@@ -0,0 +1,11 @@
+-- Contact details entered at checkout and abandoned-cart recovery state.
+ALTER TABLE carts
+  ADD COLUMN contact_name TEXT NOT NULL DEFAULT '',
+  ADD COLUMN contact_phone TEXT NOT NULL DEFAULT '',
+  ADD COLUMN contact_email TEXT NOT NULL DEFAULT '',
+  ADD COLUMN abandoned_at TIMESTAMPTZ NULL,
+  ADD COLUMN recovery_sent_at TIMESTAMPTZ NULL;
+
+CREATE INDEX carts_open_updated_at_idx ON carts(updated_at) WHERE status = 'open';
+CREATE INDEX carts_recovery_due_idx ON carts(abandoned_at) WHERE status = 'abandoned' AND recovery_sent_at IS NULL;
+
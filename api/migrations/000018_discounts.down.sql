@@ -0,0 +1,8 @@
+ALTER TABLE order_items DROP COLUMN IF EXISTS discount_inr;
+ALTER TABLE orders DROP COLUMN IF EXISTS discount_inr;
+
+DROP TABLE IF EXISTS order_discounts;
+DROP TABLE IF EXISTS discount_categories;
+DROP TABLE IF EXISTS discount_products;
+DROP TABLE IF EXISTS discounts;
+
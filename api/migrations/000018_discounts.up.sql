@@ -0,0 +1,54 @@
+-- Coupon codes and automatic promotions, and the discounts applied to orders.
+CREATE TABLE discounts (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  -- NULL for automatic promotions, which apply without a code.
+  code TEXT NULL,
+  name TEXT NOT NULL,
+  kind TEXT NOT NULL CHECK (kind IN ('percent','fixed')),
+  -- Percent (1-100) for percent discounts, paise for fixed ones.
+  value INTEGER NOT NULL CHECK (value > 0),
+  max_discount_inr INTEGER NULL CHECK (max_discount_inr IS NULL OR max_discount_inr > 0),
+  min_order_inr INTEGER NOT NULL DEFAULT 0 CHECK (min_order_inr >= 0),
+  usage_limit INTEGER NULL CHECK (usage_limit IS NULL OR usage_limit > 0),
+  per_phone_limit INTEGER NULL CHECK (per_phone_limit IS NULL OR per_phone_limit > 0),
+  starts_at TIMESTAMPTZ NULL,
+  ends_at TIMESTAMPTZ NULL,
+  active BOOLEAN NOT NULL DEFAULT true,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (kind <> 'percent' OR value <= 100),
+  CHECK (starts_at IS NULL OR ends_at IS NULL OR starts_at < ends_at)
+);
+
+CREATE UNIQUE INDEX discounts_code_key ON discounts(upper(code)) WHERE code IS NOT NULL;
+CREATE INDEX discounts_automatic_idx ON discounts(active) WHERE code IS NULL;
+
+-- A discount with products or categories only applies to those lines.
+CREATE TABLE discount_products (
+  discount_id UUID NOT NULL REFERENCES discounts(id) ON DELETE CASCADE,
+  product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+  PRIMARY KEY (discount_id, product_id)
+);
+
+CREATE TABLE discount_categories (
+  discount_id UUID NOT NULL REFERENCES discounts(id) ON DELETE CASCADE,
+  category_id UUID NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+  PRIMARY KEY (discount_id, category_id)
+);
+
+CREATE TABLE order_discounts (
+  order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  discount_id UUID NOT NULL REFERENCES discounts(id) ON DELETE RESTRICT,
+  code TEXT NULL,
+  name TEXT NOT NULL,
+  amount_inr INTEGER NOT NULL CHECK (amount_inr > 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (order_id, discount_id)
+);
+
+CREATE INDEX order_discounts_discount_id_idx ON order_discounts(discount_id);
+
+ALTER TABLE orders ADD COLUMN discount_inr INTEGER NOT NULL DEFAULT 0 CHECK (discount_inr >= 0);
+-- Share of the order discount on each line; tax is charged on the rest.
+ALTER TABLE order_items ADD COLUMN discount_inr INTEGER NOT NULL DEFAULT 0 CHECK (discount_inr >= 0);
+
@@ -0,0 +1,23 @@
+ALTER TABLE order_items
+  DROP COLUMN IF EXISTS igst_inr,
+  DROP COLUMN IF EXISTS sgst_inr,
+  DROP COLUMN IF EXISTS cgst_inr,
+  DROP COLUMN IF EXISTS gst_rate_bps,
+  DROP COLUMN IF EXISTS taxable_value_inr,
+  DROP COLUMN IF EXISTS hsn_code;
+
+ALTER TABLE orders
+  DROP COLUMN IF EXISTS shipping_igst_inr,
+  DROP COLUMN IF EXISTS shipping_sgst_inr,
+  DROP COLUMN IF EXISTS shipping_cgst_inr,
+  DROP COLUMN IF EXISTS shipping_gst_rate_bps,
+  DROP COLUMN IF EXISTS igst_inr,
+  DROP COLUMN IF EXISTS sgst_inr,
+  DROP COLUMN IF EXISTS cgst_inr,
+  DROP COLUMN IF EXISTS place_of_supply,
+  DROP COLUMN IF EXISTS seller_state;
+
+DROP TABLE IF EXISTS gst_rates;
+
+ALTER TABLE products DROP COLUMN IF EXISTS hsn_code;
+
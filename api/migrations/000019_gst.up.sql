@@ -0,0 +1,38 @@
+-- GST by HSN code and price slab, split into CGST/SGST or IGST by place of supply.
+ALTER TABLE products ADD COLUMN hsn_code TEXT NOT NULL DEFAULT '';
+
+-- Slab rates by HSN prefix; the longest matching prefix wins. rate_bps applies
+-- while the value per unit is at most threshold_inr (paise), above_rate_bps above.
+CREATE TABLE gst_rates (
+  hsn_prefix TEXT PRIMARY KEY,
+  description TEXT NOT NULL DEFAULT '',
+  threshold_inr INTEGER NOT NULL DEFAULT 0 CHECK (threshold_inr >= 0),
+  rate_bps INTEGER NOT NULL CHECK (rate_bps >= 0),
+  above_rate_bps INTEGER NOT NULL CHECK (above_rate_bps >= 0),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO gst_rates (hsn_prefix, description, threshold_inr, rate_bps, above_rate_bps) VALUES
+  ('61', 'Apparel and clothing accessories, knitted or crocheted', 100000, 500, 1200),
+  ('62', 'Apparel and clothing accessories, not knitted or crocheted', 100000, 500, 1200),
+  ('63', 'Other made up textile articles', 100000, 500, 1200);
+
+ALTER TABLE orders
+  ADD COLUMN seller_state TEXT NOT NULL DEFAULT '',
+  ADD COLUMN place_of_supply TEXT NOT NULL DEFAULT '',
+  ADD COLUMN cgst_inr INTEGER NOT NULL DEFAULT 0 CHECK (cgst_inr >= 0),
+  ADD COLUMN sgst_inr INTEGER NOT NULL DEFAULT 0 CHECK (sgst_inr >= 0),
+  ADD COLUMN igst_inr INTEGER NOT NULL DEFAULT 0 CHECK (igst_inr >= 0),
+  ADD COLUMN shipping_gst_rate_bps INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN shipping_cgst_inr INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN shipping_sgst_inr INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN shipping_igst_inr INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE order_items
+  ADD COLUMN hsn_code TEXT NOT NULL DEFAULT '',
+  ADD COLUMN taxable_value_inr INTEGER NOT NULL DEFAULT 0 CHECK (taxable_value_inr >= 0),
+  ADD COLUMN gst_rate_bps INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN cgst_inr INTEGER NOT NULL DEFAULT 0 CHECK (cgst_inr >= 0),
+  ADD COLUMN sgst_inr INTEGER NOT NULL DEFAULT 0 CHECK (sgst_inr >= 0),
+  ADD COLUMN igst_inr INTEGER NOT NULL DEFAULT 0 CHECK (igst_inr >= 0);
+
@@ -0,0 +1,21 @@
+-- GST tax invoices, numbered consecutively within each financial year.
+CREATE TABLE invoice_sequences (
+  financial_year TEXT PRIMARY KEY, -- e.g. '2026-27'
+  last_number INTEGER NOT NULL CHECK (last_number > 0)
+);
+
+CREATE TABLE invoices (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id UUID NOT NULL UNIQUE REFERENCES orders(id) ON DELETE RESTRICT,
+  number TEXT NOT NULL UNIQUE CHECK (length(number) <= 16),
+  financial_year TEXT NOT NULL,
+  sequence INTEGER NOT NULL CHECK (sequence > 0),
+  seller_gstin TEXT NOT NULL,
+  pdf BYTEA NOT NULL,
+  issued_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  notified_at TIMESTAMPTZ,
+  UNIQUE (financial_year, sequence)
+);
+
+CREATE INDEX invoices_notify_idx ON invoices (issued_at) WHERE notified_at IS NULL;
+
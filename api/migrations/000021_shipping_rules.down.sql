@@ -0,0 +1,10 @@
+ALTER TABLE orders
+  DROP COLUMN IF EXISTS cod_surcharge_inr,
+  DROP COLUMN IF EXISTS shipping_weight_grams,
+  DROP COLUMN IF EXISTS shipping_zone_id;
+
+DROP TABLE IF EXISTS shipping_rates;
+DROP TABLE IF EXISTS shipping_zones;
+
+ALTER TABLE product_variants DROP COLUMN IF EXISTS weight_grams;
+
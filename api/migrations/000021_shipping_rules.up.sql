@@ -0,0 +1,37 @@
+-- Shipping zones with weight-based rates, free-shipping thresholds, COD
+-- surcharges and non-serviceable areas.
+ALTER TABLE product_variants ADD COLUMN weight_grams INTEGER NOT NULL DEFAULT 0 CHECK (weight_grams >= 0);
+
+CREATE TABLE shipping_zones (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  name TEXT NOT NULL,
+  -- An address is in the zone with the longest matching pincode prefix, or
+  -- else the first zone listing its state (two-letter codes).
+  pincode_prefixes TEXT[] NOT NULL DEFAULT '{}',
+  states TEXT[] NOT NULL DEFAULT '{}',
+  -- Checkout is refused for addresses in a zone that is not serviceable.
+  serviceable BOOLEAN NOT NULL DEFAULT true,
+  free_above_inr INTEGER NULL CHECK (free_above_inr IS NULL OR free_above_inr >= 0),
+  cod_surcharge_inr INTEGER NOT NULL DEFAULT 0 CHECK (cod_surcharge_inr >= 0),
+  active BOOLEAN NOT NULL DEFAULT true,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (cardinality(pincode_prefixes) > 0 OR cardinality(states) > 0)
+);
+
+-- Rates by total order weight; the lowest max_weight_grams the order fits
+-- under applies, and NULL covers any weight.
+CREATE TABLE shipping_rates (
+  zone_id UUID NOT NULL REFERENCES shipping_zones(id) ON DELETE CASCADE,
+  max_weight_grams INTEGER NULL CHECK (max_weight_grams IS NULL OR max_weight_grams > 0),
+  rate_inr INTEGER NOT NULL CHECK (rate_inr >= 0)
+);
+
+CREATE UNIQUE INDEX shipping_rates_zone_weight_key ON shipping_rates(zone_id, COALESCE(max_weight_grams, 0));
+
+ALTER TABLE orders
+  ADD COLUMN shipping_zone_id UUID NULL REFERENCES shipping_zones(id) ON DELETE SET NULL,
+  ADD COLUMN shipping_weight_grams INTEGER NOT NULL DEFAULT 0,
+  -- Part of shipping_inr charged for cash on delivery.
+  ADD COLUMN cod_surcharge_inr INTEGER NOT NULL DEFAULT 0 CHECK (cod_surcharge_inr >= 0);
+
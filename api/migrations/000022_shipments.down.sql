@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS shipment_items;
+DROP TABLE IF EXISTS shipments;
+
+ALTER TABLE orders DROP CONSTRAINT orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+  CHECK (status IN ('draft','pending_payment','confirmed','payment_mismatch','paid','failed','cancelled','fulfilled','refunded')) NOT VALID;
+
@@ -0,0 +1,39 @@
+-- Orders move through partially_shipped and shipped as their items are
+-- shipped, and become fulfilled once everything is delivered.
+ALTER TABLE orders DROP CONSTRAINT orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+  CHECK (status IN ('draft','pending_payment','confirmed','payment_mismatch','paid','partially_shipped','shipped','failed','cancelled','fulfilled','refunded'));
+
+CREATE TABLE shipments (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+  status TEXT NOT NULL DEFAULT 'shipped' CHECK (status IN ('shipped','delivered')),
+  carrier TEXT NOT NULL,
+  tracking_number TEXT NOT NULL DEFAULT '',
+  note TEXT NOT NULL DEFAULT '',
+  shipped_at TIMESTAMPTZ NOT NULL,
+  delivered_at TIMESTAMPTZ NULL,
+  actor_user_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK ((status = 'delivered') = (delivered_at IS NOT NULL))
+);
+
+CREATE INDEX shipments_order_id_idx ON shipments(order_id, shipped_at);
+
+-- An AWB identifies one consignment of a carrier.
+CREATE UNIQUE INDEX shipments_tracking_number_key ON shipments(lower(carrier), tracking_number)
+  WHERE tracking_number <> '';
+
+-- Order lines are identified by order and variant, as in order_items.
+CREATE TABLE shipment_items (
+  shipment_id UUID NOT NULL REFERENCES shipments(id) ON DELETE CASCADE,
+  order_id UUID NOT NULL,
+  variant_id UUID NOT NULL,
+  quantity INTEGER NOT NULL CHECK (quantity > 0),
+  PRIMARY KEY (shipment_id, variant_id),
+  FOREIGN KEY (order_id, variant_id) REFERENCES order_items(order_id, variant_id) ON DELETE CASCADE
+);
+
+CREATE INDEX shipment_items_order_line_idx ON shipment_items(order_id, variant_id);
+
@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS shipments_provider_tracking_idx;
+
+ALTER TABLE shipments
+  DROP COLUMN IF EXISTS cancelled_at,
+  DROP COLUMN IF EXISTS tracking_updated_at,
+  DROP COLUMN IF EXISTS tracking_detail,
+  DROP COLUMN IF EXISTS tracking_status,
+  DROP COLUMN IF EXISTS label_pdf,
+  DROP COLUMN IF EXISTS provider_shipment_id,
+  DROP COLUMN IF EXISTS provider_order_id,
+  DROP COLUMN IF EXISTS provider;
+
+ALTER TABLE shipments DROP CONSTRAINT shipments_status_check;
+ALTER TABLE shipments ADD CONSTRAINT shipments_status_check
+  CHECK (status IN ('shipped','delivered')) NOT VALID;
+
@@ -0,0 +1,20 @@
+-- Shipments booked with a courier aggregator keep the aggregator's ids, the
+-- label and the latest tracking status. Cancelled shipments no longer count
+-- towards what has been shipped.
+ALTER TABLE shipments DROP CONSTRAINT shipments_status_check;
+ALTER TABLE shipments ADD CONSTRAINT shipments_status_check
+  CHECK (status IN ('shipped','delivered','cancelled'));
+
+ALTER TABLE shipments
+  ADD COLUMN provider TEXT NOT NULL DEFAULT '',
+  ADD COLUMN provider_order_id TEXT NOT NULL DEFAULT '',
+  ADD COLUMN provider_shipment_id TEXT NOT NULL DEFAULT '',
+  ADD COLUMN label_pdf BYTEA NULL,
+  ADD COLUMN tracking_status TEXT NOT NULL DEFAULT '',
+  ADD COLUMN tracking_detail TEXT NOT NULL DEFAULT '',
+  ADD COLUMN tracking_updated_at TIMESTAMPTZ NULL,
+  ADD COLUMN cancelled_at TIMESTAMPTZ NULL;
+
+CREATE INDEX shipments_provider_tracking_idx ON shipments(provider, tracking_number)
+  WHERE provider <> '';
+
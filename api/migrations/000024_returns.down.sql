@@ -0,0 +1,4 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS exchange_for_return_id;
+DROP TABLE IF EXISTS return_items;
+DROP TABLE IF EXISTS returns;
+
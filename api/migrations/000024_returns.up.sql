@@ -0,0 +1,49 @@
+-- Returns (RMA) of delivered order lines. A return is requested, approved,
+-- received and inspected; inspection settles it with a refund, store credit
+-- (a single-use discount code) or an exchange order for other variants of
+-- the same products.
+CREATE TABLE returns (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  order_id UUID NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+  status TEXT NOT NULL DEFAULT 'requested' CHECK (status IN ('requested','approved','rejected','received','completed','cancelled')),
+  resolution TEXT NOT NULL CHECK (resolution IN ('refund','store_credit','exchange')),
+  reason TEXT NOT NULL,
+  opened_by TEXT NOT NULL CHECK (opened_by IN ('customer','admin')),
+  -- Admin notes on approval, rejection, inspection or cancellation.
+  note TEXT NOT NULL DEFAULT '',
+  -- Value of the accepted items (paise), set on completion.
+  amount_inr INTEGER NOT NULL DEFAULT 0 CHECK (amount_inr >= 0),
+  refund_id UUID NULL REFERENCES refunds(id) ON DELETE RESTRICT,
+  credit_discount_id UUID NULL REFERENCES discounts(id) ON DELETE RESTRICT,
+  exchange_order_id UUID NULL REFERENCES orders(id) ON DELETE RESTRICT,
+  actor_user_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+  approved_at TIMESTAMPTZ NULL,
+  received_at TIMESTAMPTZ NULL,
+  closed_at TIMESTAMPTZ NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX returns_order_id_idx ON returns(order_id);
+CREATE INDEX returns_status_created_at_idx ON returns(status, created_at DESC);
+
+CREATE TABLE return_items (
+  return_id UUID NOT NULL REFERENCES returns(id) ON DELETE CASCADE,
+  order_id UUID NOT NULL,
+  variant_id UUID NOT NULL,
+  quantity INTEGER NOT NULL CHECK (quantity > 0),
+  -- The variant wanted instead, for exchanges.
+  exchange_variant_id UUID NULL REFERENCES product_variants(id) ON DELETE RESTRICT,
+  -- Set on inspection; items not accepted go back to the customer.
+  accepted_quantity INTEGER NULL CHECK (accepted_quantity >= 0 AND accepted_quantity <= quantity),
+  restocked_quantity INTEGER NOT NULL DEFAULT 0 CHECK (restocked_quantity >= 0),
+  PRIMARY KEY (return_id, variant_id),
+  FOREIGN KEY (order_id, variant_id) REFERENCES order_items(order_id, variant_id) ON DELETE RESTRICT,
+  CHECK (restocked_quantity <= COALESCE(accepted_quantity, 0))
+);
+
+CREATE INDEX return_items_order_variant_idx ON return_items(order_id, variant_id);
+
+-- Exchange orders ship the replacements of a return at no charge.
+ALTER TABLE orders ADD COLUMN exchange_for_return_id UUID NULL REFERENCES returns(id) ON DELETE RESTRICT;
+
@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS orders_customer_phone_digits_idx;
+DROP INDEX IF EXISTS orders_customer_user_idx;
+ALTER TABLE orders DROP COLUMN IF EXISTS customer_user_id;
+DROP TABLE IF EXISTS phone_otps;
+DELETE FROM users WHERE email IS NULL;
+ALTER TABLE users
+  DROP CONSTRAINT IF EXISTS users_email_or_phone,
+  DROP COLUMN IF EXISTS phone_verified_at,
+  DROP COLUMN IF EXISTS name,
+  DROP COLUMN IF EXISTS phone;
+UPDATE users SET password_hash = '' WHERE password_hash IS NULL;
+ALTER TABLE users
+  ALTER COLUMN password_hash SET NOT NULL,
+  ALTER COLUMN email SET NOT NULL;
+
@@ -0,0 +1,31 @@
+-- Customers sign up and log in with a one-time code sent to their phone;
+-- they have no email or password.
+ALTER TABLE users
+  ALTER COLUMN email DROP NOT NULL,
+  ALTER COLUMN password_hash DROP NOT NULL,
+  ADD COLUMN phone TEXT UNIQUE, -- +91 and the 10-digit mobile number
+  ADD COLUMN name TEXT NOT NULL DEFAULT '',
+  ADD COLUMN phone_verified_at TIMESTAMPTZ,
+  ADD CONSTRAINT users_email_or_phone CHECK (email IS NOT NULL OR phone IS NOT NULL);
+
+CREATE TABLE phone_otps (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  phone TEXT NOT NULL,
+  code_hash TEXT NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  expires_at TIMESTAMPTZ NOT NULL,
+  consumed_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX phone_otps_phone_idx ON phone_otps (phone, created_at DESC);
+
+-- Orders of a customer account: placed while logged in, or placed as a guest
+-- with the account's phone number and linked when it was verified.
+ALTER TABLE orders ADD COLUMN customer_user_id UUID REFERENCES users(id);
+
+CREATE INDEX orders_customer_user_idx ON orders (customer_user_id, created_at DESC);
+-- Guest orders are matched on the last 10 digits of the checkout phone.
+CREATE INDEX orders_customer_phone_digits_idx ON orders (right(regexp_replace(customer_phone, '\D', '', 'g'), 10))
+  WHERE customer_user_id IS NULL;
+
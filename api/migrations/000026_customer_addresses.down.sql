@@ -0,0 +1,11 @@
+UPDATE orders
+SET shipping_address = jsonb_strip_nulls(
+  (shipping_address - 'line1' - 'line2') || jsonb_build_object(
+    'address1', shipping_address->'line1',
+    'address2', shipping_address->'line2'
+  )
+)
+WHERE shipping_address ? 'line1' OR shipping_address ? 'line2';
+
+DROP TABLE IF EXISTS customer_addresses;
+
@@ -0,0 +1,42 @@
+CREATE TABLE customer_addresses (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  label TEXT NOT NULL DEFAULT '',
+  name TEXT NOT NULL,
+  line1 TEXT NOT NULL,
+  line2 TEXT NOT NULL DEFAULT '',
+  city TEXT NOT NULL,
+  state TEXT NOT NULL, -- two-letter state/UT code
+  pincode TEXT NOT NULL CHECK (pincode ~ '^[1-9][0-9]{5}$'),
+  phone TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX customer_addresses_user_idx ON customer_addresses (user_id, created_at);
+
+-- Shipping addresses were stored as sent by the storefront, with address1
+-- and address2; typed addresses call them line1 and line2.
+UPDATE orders
+SET shipping_address = jsonb_strip_nulls(
+  (shipping_address - 'address1' - 'address2') || jsonb_build_object(
+    'line1', COALESCE(shipping_address->'line1', shipping_address->'address1'),
+    'line2', COALESCE(shipping_address->'line2', shipping_address->'address2')
+  )
+)
+WHERE shipping_address ? 'address1' OR shipping_address ? 'address2';
+
+-- Fields of a typed address are strings; the storefront sent some as numbers
+-- (e.g. a pincode of 560001).
+UPDATE orders o
+SET shipping_address = o.shipping_address || s.fields
+FROM (
+  SELECT orders.id, jsonb_object_agg(f.key, to_jsonb(f.value #>> '{}')) AS fields
+  FROM orders,
+       jsonb_each(CASE WHEN jsonb_typeof(orders.shipping_address) = 'object' THEN orders.shipping_address ELSE '{}'::jsonb END) f
+  WHERE f.key IN ('name', 'line1', 'line2', 'city', 'state', 'pincode', 'phone')
+    AND jsonb_typeof(f.value) IN ('number', 'boolean')
+  GROUP BY orders.id
+) s
+WHERE s.id = o.id;
+
@@ -0,0 +1,4 @@
+-- A claim on an Idempotency-Key is a lease: when the request holding it dies
+-- without releasing the key, a retry takes it over once locked_until passes.
+ALTER TABLE idempotency_keys ADD COLUMN locked_until TIMESTAMPTZ NOT NULL DEFAULT now();
+
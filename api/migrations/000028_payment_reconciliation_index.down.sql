@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS payments_unsettled_idx;
+CREATE INDEX payments_unsettled_idx ON payments(updated_at) WHERE status IN ('created','authorized');
@@ -0,0 +1,5 @@
+-- Reconciliation also rechecks recently failed Razorpay payments; the index
+-- predicate matches the status and provider filter of its query.
+DROP INDEX IF EXISTS payments_unsettled_idx;
+CREATE INDEX payments_unsettled_idx ON payments(updated_at)
+  WHERE provider = 'razorpay' AND status IN ('created','authorized','failed');
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS orders_cart_idx;
+ALTER TABLE orders DROP COLUMN IF EXISTS cart_id;
@@ -0,0 +1,5 @@
+-- The cart an order was checked out from, so a retried checkout of the cart
+-- finds its order.
+ALTER TABLE orders ADD COLUMN cart_id UUID NULL REFERENCES carts(id) ON DELETE SET NULL;
+
+CREATE INDEX orders_cart_idx ON orders(cart_id) WHERE cart_id IS NOT NULL;
@@ -0,0 +1,2 @@
+-- Refunds Razorpay keeps pending are looked up again only after the others.
+ALTER TABLE refunds ADD COLUMN reconciled_at TIMESTAMPTZ NULL;
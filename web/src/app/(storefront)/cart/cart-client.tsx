@@ -7,12 +7,15 @@ import {
   checkoutFromCart,
   deleteCartItem,
   fetchCart,
+  recoverCart,
+  saveCartContact,
   upsertCartItem,
   verifyRazorpayPayment
 } from "@/lib/api";
 import {
   clearStoredCartId,
-  getStoredCartId
+  getStoredCartId,
+  setStoredCartId
 } from "@/lib/cart";
 import { formatINR } from "@/lib/money";
 
@@ -34,6 +37,25 @@ export default function CartClient() {
   }
 
   useEffect(() => {
+    // Recovery links from abandoned-cart reminders carry ?recover=<token>.
+    const token = new URLSearchParams(window.location.search).get("recover");
+    if (token) {
+      window.history.replaceState(null, "", window.location.pathname);
+      setStatus("loading");
+      recoverCart(token)
+        .then((c) => {
+          setStoredCartId(c.id);
+          setCartId(c.id);
+          setCart(c);
+          setStatus("ready");
+        })
+        .catch((e) => {
+          setError(e instanceof Error ? e.message : "Failed to restore cart");
+          setStatus("error");
+        });
+      return;
+    }
+
     const cid = getStoredCartId();
     setCartId(cid);
     if (!cid) {
@@ -73,18 +95,34 @@ export default function CartClient() {
     });
   }
 
+  function rememberContact(form: HTMLFormElement | null) {
+    if (!cartId || !form) return;
+    const fd = new FormData(form);
+    const customer_name = String(fd.get("name") ?? "").trim();
+    const customer_phone = String(fd.get("phone") ?? "").trim();
+    const customer_email = String(fd.get("email") ?? "").trim();
+    if (!customer_phone && !customer_email) return;
+    // Best effort: only used to remind the customer about an abandoned cart.
+    saveCartContact(cartId, {
+      customer_name,
+      customer_phone,
+      customer_email: customer_email || undefined
+    }).catch(() => {});
+  }
+
   async function submitCheckout(form: HTMLFormElement) {
     if (!cartId) return;
     const fd = new FormData(form);
     const customer_name = String(fd.get("name") ?? "").trim();
     const customer_phone = String(fd.get("phone") ?? "").trim();
     const customer_email = String(fd.get("email") ?? "").trim();
-    const address1 = String(fd.get("address1") ?? "").trim();
+    const line1 = String(fd.get("line1") ?? "").trim();
+    const line2 = String(fd.get("line2") ?? "").trim();
     const city = String(fd.get("city") ?? "").trim();
     const state = String(fd.get("state") ?? "").trim();
     const pincode = String(fd.get("pincode") ?? "").trim();
 
-    if (!customer_name || !customer_phone || !address1 || !city || !state || !pincode) {
+    if (!customer_name || !customer_phone || !line1 || !city || !state || !pincode) {
       setError("Please fill name/phone and full address.");
       return;
     }
@@ -96,7 +134,7 @@ export default function CartClient() {
           customer_name,
           customer_phone,
           customer_email: customer_email || undefined,
-          shipping_address: { address1, city, state, pincode }
+          shipping_address: { line1, line2, city, state, pincode }
         });
         if (res.razorpay?.order_id && res.razorpay?.key_id) {
           await openRazorpayCheckout({
@@ -264,17 +302,24 @@ export default function CartClient() {
             <input
               className="rounded-lg border border-vexo-gray/80 px-4 py-2.5 text-vexo-black placeholder:text-vexo-brown/60 focus:border-vexo-teal focus:outline-none focus:ring-2 focus:ring-vexo-teal/20"
               name="phone"
+              onBlur={(e) => rememberContact(e.currentTarget.form)}
               placeholder="Phone"
             />
             <input
               className="rounded-lg border border-vexo-gray/80 px-4 py-2.5 text-vexo-black placeholder:text-vexo-brown/60 focus:border-vexo-teal focus:outline-none focus:ring-2 focus:ring-vexo-teal/20"
               name="email"
+              onBlur={(e) => rememberContact(e.currentTarget.form)}
               placeholder="Email (optional)"
             />
             <input
               className="rounded-lg border border-vexo-gray/80 px-4 py-2.5 text-vexo-black placeholder:text-vexo-brown/60 focus:border-vexo-teal focus:outline-none focus:ring-2 focus:ring-vexo-teal/20"
-              name="address1"
-              placeholder="Address line"
+              name="line1"
+              placeholder="House / flat, street"
+            />
+            <input
+              className="rounded-lg border border-vexo-gray/80 px-4 py-2.5 text-vexo-black placeholder:text-vexo-brown/60 focus:border-vexo-teal focus:outline-none focus:ring-2 focus:ring-vexo-teal/20"
+              name="line2"
+              placeholder="Area, landmark (optional)"
             />
             <div className="grid gap-3 sm:grid-cols-3">
               <input
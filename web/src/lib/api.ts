@@ -39,6 +39,16 @@ export type Cart = {
   subtotal_inr: number;
 };
 
+export type ShippingAddress = {
+  name?: string; // defaults to customer_name
+  line1: string;
+  line2?: string;
+  city: string;
+  state: string; // Indian state/UT name or code
+  pincode: string;
+  phone?: string; // defaults to customer_phone
+};
+
 export type CheckoutResult = {
   order_id: string;
   payment_id: string;
@@ -122,12 +132,29 @@ export async function deleteCartItem(
   });
 }
 
+export async function saveCartContact(
+  cartId: string,
+  input: { customer_name: string; customer_phone: string; customer_email?: string }
+): Promise<void> {
+  await apiFetch(`/v1/cart/${cartId}/contact`, {
+    method: "PUT",
+    body: JSON.stringify(input)
+  });
+}
+
+export async function recoverCart(token: string): Promise<Cart> {
+  return await apiFetch<Cart>("/v1/cart/recover", {
+    method: "POST",
+    body: JSON.stringify({ token })
+  });
+}
+
 export async function checkoutFromCart(input: {
   cart_id: string;
   customer_name: string;
   customer_phone: string;
   customer_email?: string;
-  shipping_address: Record<string, unknown>;
+  shipping_address: ShippingAddress;
 }): Promise<CheckoutResult> {
   return await apiFetch<CheckoutResult>("/v1/checkout", {
     method: "POST",